@@ -93,9 +93,11 @@ def go_tool(*args):
     # Modify the environment so that the Go tool will find the project files
     # using the `GOPATH` environment variable. Note that setting the `PWD`
     # environment is necessary, because the `cwd` is always resolved to a
-    # real path by the operating system.
+    # real path by the operating system. The project uses 'dep' and the
+    # 'GOPATH', so modules are disabled.
     env = dict(os.environ)
     env["GOPATH"] = go_path
+    env["GO111MODULE"] = "off"
     env["PWD"] = project_link
 
     # Run the Go tool and wait till it finishes:
@@ -0,0 +1,602 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-stomp/stomp"
+	"github.com/go-stomp/stomp/frame"
+	"github.com/go-stomp/stomp/server"
+	"github.com/golang/glog"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// defaultPriority is the priority of the messages that don't have a priority header.
+const defaultPriority = 4
+
+// defaultMaxPending is the maximum number of delayed messages sent by a connection that can be
+// waiting for delivery at the same time.
+const defaultMaxPending = 1000
+
+// autoDeleteHeader is the header of the subscriptions to queues that should be deleted when
+// their last subscriber unsubscribes, the same that RabbitMQ uses.
+const autoDeleteHeader = "auto-delete"
+
+// deliveryStorage is an in-memory queue storage that emulates the priority and the expiration of
+// messages. Messages with higher priority are placed before the messages with lower priority,
+// and expired messages are discarded instead of being delivered. Messages sent to queues that
+// were deleted are discarded as well, till the queues are created again.
+type deliveryStorage struct {
+	mutex   sync.Mutex
+	queues  map[string][]*frame.Frame
+	deleted map[string]bool
+}
+
+// Make sure we implement the queue storage interface of the server.
+var _ server.QueueStorage = &deliveryStorage{}
+
+// newDeliveryStorage creates an empty queue storage.
+func newDeliveryStorage() *deliveryStorage {
+	return &deliveryStorage{
+		queues:  make(map[string][]*frame.Frame),
+		deleted: make(map[string]bool),
+	}
+}
+
+// Create creates a queue that was deleted, so that it accepts messages again.
+func (s *deliveryStorage) Create(queue string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.deleted, queue)
+}
+
+// Delete discards the messages of a queue, and the messages sent to it later.
+func (s *deliveryStorage) Delete(queue string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.queues, queue)
+	s.deleted[queue] = true
+}
+
+// Enqueue adds a message after the messages of the queue with the same or higher priority.
+func (s *deliveryStorage) Enqueue(queue string, f *frame.Frame) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.deleted[queue] {
+		return nil
+	}
+	frames := s.queues[queue]
+	priority := framePriority(f)
+	position := len(frames)
+	for position > 0 && framePriority(frames[position-1]) < priority {
+		position--
+	}
+	frames = append(frames, nil)
+	copy(frames[position+1:], frames[position:])
+	frames[position] = f
+	s.queues[queue] = frames
+	return nil
+}
+
+// Requeue adds a message to the head of the queue, because it wasn't acknowledged.
+func (s *deliveryStorage) Requeue(queue string, f *frame.Frame) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.deleted[queue] {
+		return nil
+	}
+	s.queues[queue] = append([]*frame.Frame{f}, s.queues[queue]...)
+	return nil
+}
+
+// Dequeue removes the first message of the queue that didn't expire.
+func (s *deliveryStorage) Dequeue(queue string) (*frame.Frame, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	frames := s.queues[queue]
+	for len(frames) > 0 {
+		f := frames[0]
+		frames = frames[1:]
+		if !frameExpired(f, now) {
+			s.queues[queue] = frames
+			return f, nil
+		}
+	}
+	delete(s.queues, queue)
+	return nil, nil
+}
+
+// Start is called when the server starts.
+func (s *deliveryStorage) Start() {
+}
+
+// Stop is called when the server stops.
+func (s *deliveryStorage) Stop() {
+}
+
+// deliveryListener accepts connections for the server, and emulates the delayed delivery and
+// the expiration of the messages sent by the clients. Messages that expired are discarded, and
+// delayed messages are held and sent later through an internal connection to the server, so
+// that they are delivered even if the client that sent them disconnects.
+//
+// Only the messages of the clients that were authenticated are intercepted, and each connection
+// can only have a limited number of delayed messages waiting. The connections that send more are
+// closed with an error.
+//
+// The listener also emulates the queues that are deleted automatically: the queues subscribed
+// to with the auto-delete header are deleted from the storage when their last subscriber
+// unsubscribes or disconnects.
+type deliveryListener struct {
+	net.Listener
+
+	// Storage of the queues of the server:
+	storage *deliveryStorage
+
+	// Number of subscribers of each queue that is deleted automatically:
+	subscribers      map[string]int
+	subscribersMutex sync.Mutex
+
+	// Authenticator used to check the credentials of the clients, nil if all the clients are
+	// accepted:
+	authenticator server.Authenticator
+
+	// Credentials of the internal connection:
+	userName     string
+	userPassword string
+
+	// Maximum number of delayed messages waiting for each connection:
+	maxPending int
+
+	// Connections accepted by the wrapped listener, and internal connections:
+	accepted chan acceptResult
+	internal chan net.Conn
+
+	// Internal connection used to send the delayed messages:
+	mutex     sync.Mutex
+	scheduler *stomp.Conn
+
+	// Counter used to generate identifiers for the transactions that request receipts:
+	transactions int64
+}
+
+// acceptResult is the result of accepting a connection with the wrapped listener.
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+// newDeliveryListener wraps a listener, and starts accepting connections. The storage and the
+// authenticator should be the ones used by the server.
+func newDeliveryListener(listener net.Listener, storage *deliveryStorage,
+	authenticator server.Authenticator, userName, userPassword string) *deliveryListener {
+	l := &deliveryListener{
+		Listener:      listener,
+		storage:       storage,
+		subscribers:   make(map[string]int),
+		authenticator: authenticator,
+		userName:      userName,
+		userPassword:  userPassword,
+		maxPending:    defaultMaxPending,
+		accepted:      make(chan acceptResult),
+		internal:      make(chan net.Conn, 1),
+	}
+	go l.acceptLoop()
+	return l
+}
+
+// acceptLoop accepts connections with the wrapped listener till it fails.
+func (l *deliveryListener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		l.accepted <- acceptResult{conn: conn, err: err}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Accept waits for the next connection, either from a client or internal.
+func (l *deliveryListener) Accept() (conn net.Conn, err error) {
+	select {
+	case conn = <-l.internal:
+	case result := <-l.accepted:
+		conn, err = result.conn, result.err
+		if err == nil {
+			conn = l.filter(conn)
+		}
+	}
+	return
+}
+
+// deliveryConn is a client connection whose frames are read through a filter.
+type deliveryConn struct {
+	net.Conn
+	listener *deliveryListener
+	reader   *io.PipeReader
+
+	// Indicates if the client sent a CONNECT frame with valid credentials. Only used by the
+	// filter.
+	connected bool
+
+	// Queues deleted automatically that the connection is subscribed to, indexed by the
+	// identifier of the subscription. Only used by the filter.
+	autoDelete map[string]string
+
+	// Number of delayed messages of the connection waiting for delivery:
+	pending      int
+	pendingMutex sync.Mutex
+
+	// Serializes the frames written by the server and the error written by the filter, and
+	// discards the frames written after the error:
+	writeMutex sync.Mutex
+	rejected   bool
+}
+
+// Read reads the filtered frames sent by the client.
+func (c *deliveryConn) Read(data []byte) (int, error) {
+	return c.reader.Read(data)
+}
+
+// Write writes the frames sent by the server, unless the connection was rejected.
+func (c *deliveryConn) Write(data []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	if c.rejected {
+		return 0, io.ErrClosedPipe
+	}
+	return c.Conn.Write(data)
+}
+
+// Close closes the connection and the filter.
+func (c *deliveryConn) Close() error {
+	c.reader.Close()
+	return c.Conn.Close()
+}
+
+// filter returns a connection that reads the frames sent by the client after intercepting the
+// messages that expired or that are delayed.
+func (l *deliveryListener) filter(conn net.Conn) net.Conn {
+	reader, writer := io.Pipe()
+	c := &deliveryConn{
+		Conn:       conn,
+		listener:   l,
+		reader:     reader,
+		autoDelete: make(map[string]string),
+	}
+	go func() {
+		defer c.unsubscribeAll()
+		frames := frame.NewReader(conn)
+		filtered := frame.NewWriter(writer)
+		for {
+			f, err := frames.Read()
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+			forwards, err := c.intercept(f)
+			if err != nil {
+				c.reject(f, err)
+				writer.CloseWithError(err)
+				return
+			}
+			for _, forward := range forwards {
+				err = filtered.Write(forward)
+				if err != nil {
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+	return c
+}
+
+// intercept returns the frames that should be forwarded to the server instead of the given
+// frame. Expired messages are discarded and delayed messages are scheduled, and in both cases
+// the frames returned only request the receipt that the client may be waiting for. Frames sent
+// before the client is authenticated are forwarded unchanged, so that the server rejects them.
+// The subscriptions to queues deleted automatically are tracked.
+func (c *deliveryConn) intercept(f *frame.Frame) (frames []*frame.Frame, err error) {
+	frames = []*frame.Frame{f}
+	if f == nil {
+		return
+	}
+
+	// Check the credentials the same way as the server:
+	if f.Command == frame.CONNECT || f.Command == frame.STOMP {
+		authenticator := c.listener.authenticator
+		login, _ := f.Header.Contains(frame.Login)
+		passcode, _ := f.Header.Contains(frame.Passcode)
+		c.connected = authenticator == nil || authenticator.Authenticate(login, passcode)
+		return
+	}
+
+	// Forward other frames, and messages in transactions:
+	if !c.connected {
+		return
+	}
+	switch f.Command {
+	case frame.SUBSCRIBE:
+		c.subscribe(f)
+		return
+	case frame.UNSUBSCRIBE:
+		// The server doesn't send the receipts of the UNSUBSCRIBE frames, that the clients
+		// wait for:
+		c.unsubscribe(f.Header.Get(frame.Id))
+		frames = append(frames, c.listener.receipt(f)...)
+		return
+	}
+	if f.Command != frame.SEND || f.Header.Get(frame.Transaction) != "" {
+		return
+	}
+
+	now := time.Now()
+	if frameExpired(f, now) {
+		glog.Infof(
+			"Discarding expired message sent to destination '%s'",
+			f.Header.Get(frame.Destination),
+		)
+		frames = c.listener.receipt(f)
+		return
+	}
+	due := frameDue(f, now)
+	if due.After(now) {
+		err = c.hold()
+		if err != nil {
+			return
+		}
+		glog.Infof(
+			"Delaying message sent to destination '%s' till %s",
+			f.Header.Get(frame.Destination),
+			due.Format(time.RFC3339),
+		)
+		time.AfterFunc(due.Sub(now), func() {
+			c.release()
+			c.listener.deliver(f)
+		})
+		frames = c.listener.receipt(f)
+	}
+	return
+}
+
+// subscribe counts the subscriber of a queue that is deleted automatically, and creates it again
+// if it was deleted.
+func (c *deliveryConn) subscribe(f *frame.Frame) {
+	id := f.Header.Get(frame.Id)
+	queue := f.Header.Get(frame.Destination)
+	if f.Header.Get(autoDeleteHeader) != "true" || c.autoDelete[id] != "" {
+		return
+	}
+	c.autoDelete[id] = queue
+
+	l := c.listener
+	l.subscribersMutex.Lock()
+	defer l.subscribersMutex.Unlock()
+	if l.subscribers[queue] == 0 {
+		l.storage.Create(queue)
+	}
+	l.subscribers[queue]++
+}
+
+// unsubscribe discounts the subscriber of a queue that is deleted automatically, and deletes the
+// queue if it was the last one.
+func (c *deliveryConn) unsubscribe(id string) {
+	queue, ok := c.autoDelete[id]
+	if !ok {
+		return
+	}
+	delete(c.autoDelete, id)
+
+	l := c.listener
+	l.subscribersMutex.Lock()
+	defer l.subscribersMutex.Unlock()
+	l.subscribers[queue]--
+	if l.subscribers[queue] == 0 {
+		delete(l.subscribers, queue)
+		glog.Infof("Deleting queue '%s' because it has no subscribers", queue)
+		l.storage.Delete(queue)
+	}
+}
+
+// unsubscribeAll discounts the subscribers of the connection when it is closed.
+func (c *deliveryConn) unsubscribeAll() {
+	for id := range c.autoDelete {
+		c.unsubscribe(id)
+	}
+}
+
+// hold counts a delayed message of the connection, or returns an error if the connection
+// already has the maximum number of delayed messages waiting.
+func (c *deliveryConn) hold() error {
+	c.pendingMutex.Lock()
+	defer c.pendingMutex.Unlock()
+	if c.pending >= c.listener.maxPending {
+		return fmt.Errorf(
+			"Connection has more than %d delayed messages waiting",
+			c.listener.maxPending,
+		)
+	}
+	c.pending++
+	return nil
+}
+
+// release discounts a delayed message of the connection once it is delivered.
+func (c *deliveryConn) release() {
+	c.pendingMutex.Lock()
+	c.pending--
+	c.pendingMutex.Unlock()
+}
+
+// reject sends an error to the client, and closes the connection.
+func (c *deliveryConn) reject(f *frame.Frame, err error) {
+	glog.Warningf("Closing connection from '%s': %s", c.RemoteAddr(), err.Error())
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	c.rejected = true
+	response := frame.New(frame.ERROR, frame.Message, err.Error())
+	if receipt, ok := f.Header.Contains(frame.Receipt); ok {
+		response.Header.Add(frame.ReceiptId, receipt)
+	}
+	frame.NewWriter(c.Conn).Write(response)
+	c.Conn.Close()
+}
+
+// receipt returns the frames that make the server send the receipt requested by a message that
+// isn't forwarded: an empty transaction that requests the receipt when it begins.
+func (l *deliveryListener) receipt(f *frame.Frame) []*frame.Frame {
+	receipt := f.Header.Get(frame.Receipt)
+	if receipt == "" {
+		return nil
+	}
+	l.mutex.Lock()
+	l.transactions++
+	transaction := fmt.Sprintf("delivery-%d", l.transactions)
+	l.mutex.Unlock()
+	return []*frame.Frame{
+		frame.New(frame.BEGIN, frame.Transaction, transaction, frame.Receipt, receipt),
+		frame.New(frame.ABORT, frame.Transaction, transaction),
+	}
+}
+
+// deliver sends a delayed message through the internal connection, unless it expired while it
+// was waiting.
+func (l *deliveryListener) deliver(f *frame.Frame) {
+	destination := f.Header.Get(frame.Destination)
+	if frameExpired(f, time.Now()) {
+		glog.Infof(
+			"Discarding expired message sent to destination '%s'",
+			destination,
+		)
+		return
+	}
+
+	// Copy the headers of the message, except the ones that the connection adds:
+	var options []func(*frame.Frame) error
+	for i := 0; i < f.Header.Len(); i++ {
+		key, value := f.Header.GetAt(i)
+		switch key {
+		case frame.Destination, frame.ContentType, frame.ContentLength, frame.Receipt:
+			continue
+		}
+		options = append(options, stomp.SendOpt.Header(key, value))
+	}
+
+	conn, err := l.connect()
+	if err == nil {
+		err = conn.Send(destination, f.Header.Get(frame.ContentType), f.Body, options...)
+	}
+	if err != nil {
+		glog.Errorf(
+			"Can't deliver delayed message to destination '%s': %s",
+			destination,
+			err.Error(),
+		)
+		l.disconnect(conn)
+	}
+}
+
+// connect returns the internal connection used to send delayed messages, creating it if needed.
+func (l *deliveryListener) connect() (conn *stomp.Conn, err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.scheduler != nil {
+		conn = l.scheduler
+		return
+	}
+
+	var options []func(*stomp.Conn) error
+	if l.userName != "" {
+		options = append(options, stomp.ConnOpt.Login(l.userName, l.userPassword))
+	}
+	local, remote := net.Pipe()
+	l.internal <- remote
+	conn, err = stomp.Connect(local, options...)
+	if err != nil {
+		local.Close()
+		return
+	}
+	l.scheduler = conn
+	return
+}
+
+// disconnect discards the internal connection after a failure, so that the next delayed
+// message creates a new one.
+func (l *deliveryListener) disconnect(conn *stomp.Conn) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if conn != nil && l.scheduler == conn {
+		conn.MustDisconnect()
+		l.scheduler = nil
+	}
+}
+
+// framePriority returns the priority of a message.
+func framePriority(f *frame.Frame) int {
+	priority, err := strconv.Atoi(f.Header.Get(client.PriorityHeader))
+	if err != nil {
+		return defaultPriority
+	}
+	return priority
+}
+
+// frameExpired checks if a message expired.
+func frameExpired(f *frame.Frame, now time.Time) bool {
+	expires, ok := frameTime(f, client.ExpiresHeader)
+	return ok && !expires.After(now)
+}
+
+// frameDue returns the time when a message should be delivered.
+func frameDue(f *frame.Frame, now time.Time) time.Time {
+	if due, ok := frameTime(f, client.ScheduledDeliveryHeader); ok {
+		return due
+	}
+	for _, key := range []string{client.ScheduledDelayHeader, client.DelayHeader} {
+		delay, err := strconv.ParseInt(f.Header.Get(key), 10, 64)
+		if err == nil {
+			return now.Add(time.Duration(delay) * time.Millisecond)
+		}
+	}
+	return now
+}
+
+// frameTime returns the time contained in a header of a message, in milliseconds since the
+// epoch. Zero means no time, like in the expiration header of JMS.
+func frameTime(f *frame.Frame, key string) (t time.Time, ok bool) {
+	value, err := strconv.ParseInt(f.Header.Get(key), 10, 64)
+	if err != nil || value <= 0 {
+		return
+	}
+	t = time.Unix(0, value*int64(time.Millisecond))
+	ok = true
+	return
+}
@@ -0,0 +1,389 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-stomp/stomp"
+	"github.com/go-stomp/stomp/frame"
+	"github.com/go-stomp/stomp/server"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// message creates a SEND frame with the given body and additional headers.
+func message(body string, headers ...string) *frame.Frame {
+	f := frame.New(frame.SEND, append([]string{frame.Destination, "/queue/test"}, headers...)...)
+	f.Body = []byte(body)
+	return f
+}
+
+// millis returns the given time in milliseconds since the epoch, as used in the headers.
+func millis(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
+
+func TestStoragePriority(t *testing.T) {
+	storage := newDeliveryStorage()
+
+	// Messages with higher priority go first, and messages with the same priority keep the
+	// order in which they were sent:
+	storage.Enqueue("test", message("low", client.PriorityHeader, "1"))
+	storage.Enqueue("test", message("default"))
+	storage.Enqueue("test", message("high", client.PriorityHeader, "9"))
+	storage.Enqueue("test", message("high again", client.PriorityHeader, "9"))
+	storage.Enqueue("test", message("medium", client.PriorityHeader, "4"))
+
+	// Messages that weren't acknowledged go back to the head of the queue:
+	storage.Requeue("test", message("requeued", client.PriorityHeader, "0"))
+
+	expected := []string{"requeued", "high", "high again", "default", "medium", "low"}
+	for _, body := range expected {
+		f, err := storage.Dequeue("test")
+		if err != nil {
+			t.Fatalf("Can't dequeue: %s", err.Error())
+		}
+		if f == nil {
+			t.Fatalf("Expected message '%s', the queue is empty", body)
+		}
+		if string(f.Body) != body {
+			t.Errorf("Expected message '%s', got '%s'", body, string(f.Body))
+		}
+	}
+	if f, _ := storage.Dequeue("test"); f != nil {
+		t.Errorf("Expected the queue to be empty, got '%s'", string(f.Body))
+	}
+}
+
+func TestStorageExpiration(t *testing.T) {
+	storage := newDeliveryStorage()
+
+	// Zero means that the message never expires:
+	now := time.Now()
+	storage.Enqueue("test", message("expired", client.ExpiresHeader, millis(now.Add(-time.Second))))
+	storage.Enqueue("test", message("never", client.ExpiresHeader, "0"))
+	storage.Enqueue("test", message("later", client.ExpiresHeader, millis(now.Add(time.Hour))))
+	storage.Enqueue("test", message("expiring", client.ExpiresHeader, millis(now.Add(50*time.Millisecond))))
+	time.Sleep(100 * time.Millisecond)
+
+	for _, body := range []string{"never", "later"} {
+		f, _ := storage.Dequeue("test")
+		if f == nil {
+			t.Fatalf("Expected message '%s', the queue is empty", body)
+		}
+		if string(f.Body) != body {
+			t.Errorf("Expected message '%s', got '%s'", body, string(f.Body))
+		}
+	}
+	if f, _ := storage.Dequeue("test"); f != nil {
+		t.Errorf("Expected the expired messages to be discarded, got '%s'", string(f.Body))
+	}
+}
+
+func TestFrameDue(t *testing.T) {
+	now := time.Now()
+	at := now.Add(time.Hour).Truncate(time.Millisecond)
+	tests := []struct {
+		name     string
+		f        *frame.Frame
+		expected time.Time
+	}{
+		{"none", message("body"), now},
+		{"schedule", message("body", client.ScheduledDeliveryHeader, millis(at)), at},
+		{"activemq", message("body", client.ScheduledDelayHeader, "1500"), now.Add(1500 * time.Millisecond)},
+		{"rabbitmq", message("body", client.DelayHeader, "200"), now.Add(200 * time.Millisecond)},
+		{"invalid", message("body", client.DelayHeader, "soon"), now},
+	}
+	for _, test := range tests {
+		due := frameDue(test.f, now)
+		if !due.Equal(test.expected) {
+			t.Errorf("Expected %s message to be due at %s, got %s", test.name, test.expected, due)
+		}
+	}
+}
+
+func TestIntercept(t *testing.T) {
+	c := &deliveryConn{
+		listener:  &deliveryListener{maxPending: defaultMaxPending},
+		connected: true,
+	}
+	expired := millis(time.Now().Add(-time.Second))
+
+	// Frames that aren't messages, and messages in transactions, are forwarded unchanged:
+	forwarded := []*frame.Frame{
+		nil,
+		frame.New(frame.SUBSCRIBE, frame.Destination, "/queue/test", frame.Id, "0"),
+		message("current", frame.Receipt, "1"),
+		message("transaction", frame.Transaction, "tx", client.ExpiresHeader, expired),
+	}
+	for _, f := range forwarded {
+		frames, _ := c.intercept(f)
+		if len(frames) != 1 || frames[0] != f {
+			t.Errorf("Expected frame %v to be forwarded, got %v", f, frames)
+		}
+	}
+
+	// Expired and delayed messages are held, only their receipts reach the server:
+	held := []*frame.Frame{
+		message("expired", client.ExpiresHeader, expired),
+		message("delayed", client.ScheduledDelayHeader, strconv.Itoa(int(time.Hour/time.Millisecond))),
+	}
+	for i, f := range held {
+		if frames, _ := c.intercept(f); len(frames) != 0 {
+			t.Errorf("Expected message '%s' without receipt to be held, got %v", f.Body, frames)
+		}
+
+		receipt := strconv.Itoa(i)
+		f.Header.Set(frame.Receipt, receipt)
+		frames, _ := c.intercept(f)
+		if len(frames) != 2 {
+			t.Fatalf("Expected a transaction for the receipt of '%s', got %v", f.Body, frames)
+		}
+		begin, abort := frames[0], frames[1]
+		if begin.Command != frame.BEGIN || begin.Header.Get(frame.Receipt) != receipt {
+			t.Errorf("Expected a BEGIN frame with receipt '%s', got %v", receipt, begin)
+		}
+		transaction := begin.Header.Get(frame.Transaction)
+		if abort.Command != frame.ABORT || abort.Header.Get(frame.Transaction) != transaction {
+			t.Errorf("Expected an ABORT frame for transaction '%s', got %v", transaction, abort)
+		}
+	}
+}
+
+// startServer starts a server with the delivery emulation, that accepts only the given
+// credentials, and returns its listener.
+func startServer(t *testing.T, userName, userPassword string) *deliveryListener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Can't listen: %s", err.Error())
+	}
+	authenticator := myAuthenticator{
+		userName:     userName,
+		userPasscode: userPassword,
+	}
+	storage := newDeliveryStorage()
+	l := newDeliveryListener(listener, storage, authenticator, userName, userPassword)
+	brokerServer := server.Server{
+		Authenticator: authenticator,
+		QueueStorage:  storage,
+	}
+	go brokerServer.Serve(l)
+	return l
+}
+
+// subscribe connects to the server and subscribes to the test queue.
+func subscribe(t *testing.T, l *deliveryListener, options ...func(*stomp.Conn) error) (
+	*stomp.Conn, *stomp.Subscription) {
+	conn, err := stomp.Dial("tcp", l.Addr().String(), options...)
+	if err != nil {
+		t.Fatalf("Can't connect: %s", err.Error())
+	}
+	subscription, err := conn.Subscribe("/queue/test", stomp.AckAuto)
+	if err != nil {
+		t.Fatalf("Can't subscribe: %s", err.Error())
+	}
+	return conn, subscription
+}
+
+func TestDelayedDelivery(t *testing.T) {
+	l := startServer(t, "", "")
+	defer l.Close()
+	conn, subscription := subscribe(t, l)
+	defer conn.MustDisconnect()
+
+	// The server sends the receipts of the messages that it holds or discards, so sending
+	// them doesn't block:
+	sent := time.Now()
+	messages := []struct {
+		body   string
+		header string
+		value  string
+	}{
+		{"expired", client.ExpiresHeader, millis(sent.Add(-time.Second))},
+		{"delayed", client.DelayHeader, "300"},
+		{"current", client.PriorityHeader, "4"},
+	}
+	for _, m := range messages {
+		err := conn.Send(
+			"/queue/test", "text/plain", []byte(m.body),
+			stomp.SendOpt.Receipt,
+			stomp.SendOpt.Header(m.header, m.value),
+		)
+		if err != nil {
+			t.Fatalf("Can't send message '%s': %s", m.body, err.Error())
+		}
+	}
+
+	// The current message arrives first, then the delayed one once it is due, and the expired
+	// one never:
+	for _, body := range []string{"current", "delayed"} {
+		select {
+		case received := <-subscription.C:
+			if received.Err != nil {
+				t.Fatalf("Received error: %s", received.Err.Error())
+			}
+			if string(received.Body) != body {
+				t.Errorf("Expected message '%s', got '%s'", body, string(received.Body))
+			}
+			if body == "delayed" && time.Since(sent) < 300*time.Millisecond {
+				t.Errorf("Delayed message arrived after %s", time.Since(sent))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for message '%s'", body)
+		}
+	}
+	select {
+	case received := <-subscription.C:
+		t.Errorf("Expected no more messages, got '%s'", string(received.Body))
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestUnauthenticatedDelivery(t *testing.T) {
+	l := startServer(t, "user", "secret")
+	defer l.Close()
+	conn, subscription := subscribe(t, l, stomp.ConnOpt.Login("user", "secret"))
+	defer conn.MustDisconnect()
+
+	// Send a delayed message without connecting, and with the wrong credentials:
+	for _, connect := range []*frame.Frame{
+		nil,
+		frame.New(frame.CONNECT, frame.Login, "user", frame.Passcode, "guess"),
+	} {
+		raw, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("Can't connect: %s", err.Error())
+		}
+		defer raw.Close()
+		writer := frame.NewWriter(raw)
+		if connect != nil {
+			writer.Write(connect)
+		}
+		writer.Write(message("forged", client.DelayHeader, "100"))
+	}
+
+	// The server rejects the messages instead of the filter delaying them:
+	select {
+	case received := <-subscription.C:
+		t.Errorf("Expected no messages, got '%s'", string(received.Body))
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestPendingLimit(t *testing.T) {
+	l := startServer(t, "", "")
+	defer l.Close()
+	l.maxPending = 1
+	conn, subscription := subscribe(t, l)
+	defer conn.MustDisconnect()
+
+	// The second delayed message exceeds the limit, so the connection is closed with an error:
+	sender, err := stomp.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Can't connect: %s", err.Error())
+	}
+	for i, body := range []string{"first", "second"} {
+		err = sender.Send(
+			"/queue/test", "text/plain", []byte(body),
+			stomp.SendOpt.Receipt,
+			stomp.SendOpt.Header(client.DelayHeader, "100"),
+		)
+		if i == 0 && err != nil {
+			t.Fatalf("Can't send message '%s': %s", body, err.Error())
+		}
+		if i == 1 && err == nil {
+			t.Errorf("Message '%s' was accepted over the limit", body)
+		}
+	}
+
+	// The message accepted is still delivered:
+	select {
+	case received := <-subscription.C:
+		if string(received.Body) != "first" {
+			t.Errorf("Expected message 'first', got '%s'", string(received.Body))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the message")
+	}
+	select {
+	case received := <-subscription.C:
+		t.Errorf("Expected no more messages, got '%s'", string(received.Body))
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestAutoDelete(t *testing.T) {
+	l := startServer(t, "", "")
+	defer l.Close()
+	conn, err := stomp.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Can't connect: %s", err.Error())
+	}
+	defer conn.MustDisconnect()
+
+	// The messages sent after the last subscriber unsubscribes are discarded:
+	queue := "/queue/private"
+	subscription, err := conn.Subscribe(
+		queue, stomp.AckAuto,
+		stomp.SubscribeOpt.Header(autoDeleteHeader, "true"),
+	)
+	if err != nil {
+		t.Fatalf("Can't subscribe: %s", err.Error())
+	}
+	err = subscription.Unsubscribe()
+	if err != nil {
+		t.Fatalf("Can't unsubscribe: %s", err.Error())
+	}
+	err = conn.Send(queue, "text/plain", []byte("late"), stomp.SendOpt.Receipt)
+	if err != nil {
+		t.Fatalf("Can't send message: %s", err.Error())
+	}
+	l.storage.mutex.Lock()
+	frames := len(l.storage.queues[queue])
+	l.storage.mutex.Unlock()
+	if frames != 0 {
+		t.Errorf("Expected the deleted queue to be empty, it has %d messages", frames)
+	}
+
+	// Subscribing again creates the queue:
+	subscription, err = conn.Subscribe(
+		queue, stomp.AckAuto,
+		stomp.SubscribeOpt.Header(autoDeleteHeader, "true"),
+	)
+	if err != nil {
+		t.Fatalf("Can't subscribe: %s", err.Error())
+	}
+	err = conn.Send(queue, "text/plain", []byte("current"), stomp.SendOpt.Receipt)
+	if err != nil {
+		t.Fatalf("Can't send message: %s", err.Error())
+	}
+	select {
+	case received := <-subscription.C:
+		if received.Err != nil {
+			t.Fatalf("Received error: %s", received.Err.Error())
+		}
+		if string(received.Body) != "current" {
+			t.Errorf("Expected message 'current', got '%s'", string(received.Body))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for message 'current'")
+	}
+}
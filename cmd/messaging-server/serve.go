@@ -18,6 +18,7 @@ package main
 
 import (
 	"fmt"
+	"net"
 
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
@@ -62,9 +63,13 @@ func runServe(cmd *cobra.Command, args []string) {
 	brokerAthenticator := myAuthenticator{
 		userName:     userName,
 		userPasscode: userPassword}
+	brokerStorage := newDeliveryStorage()
 	brokerServer := server.Server{
 		Addr:          brokerAddress,      // TCP address to listen on, DefaultAddr if empty
 		Authenticator: brokerAthenticator, // Authenticates login/passcodes. If nil no authentication is performed
+
+		// Emulate the priority and the expiration of the messages waiting in queues:
+		QueueStorage: brokerStorage,
 	}
 
 	// Indicate we are running.
@@ -74,9 +79,20 @@ func runServe(cmd *cobra.Command, args []string) {
 		brokerAthenticator.Message(),
 	)
 
-	// ListenAndServe listens on the TCP network address and handle requests on
-	// the incoming connections.
-	err := brokerServer.ListenAndServe()
+	// Listen on the TCP network address, and handle requests on the incoming connections,
+	// emulating the delayed delivery and the expiration of the messages they send.
+	listener, err := net.Listen("tcp", brokerAddress)
+	if err == nil {
+		err = brokerServer.Serve(
+			newDeliveryListener(
+				listener,
+				brokerStorage,
+				brokerAthenticator,
+				userName,
+				userPassword,
+			),
+		)
+	}
 	if err != nil {
 		glog.Errorf(
 			"Can't start server on '%s': %s",
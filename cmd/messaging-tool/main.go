@@ -33,6 +33,7 @@ var (
 	userPassword    string
 	useTLS          bool
 	insecureTLS     bool
+	metricsAddress  string
 
 	// Main command:
 	rootCmd = &cobra.Command{
@@ -93,6 +94,13 @@ func init() {
 		false,
 		"Don't check the server TLS certificate and host name.",
 	)
+	flags.StringVar(
+		&metricsAddress,
+		"metrics-address",
+		"",
+		"The address where the Prometheus metrics will be served, for example ':9090'. If "+
+			"this option isn't given then metrics aren't collected.",
+	)
 
 	// Register the subcommands:
 	rootCmd.AddCommand(sendCmd)
@@ -17,9 +17,16 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
 
+	"github.com/container-mgmt/messaging-library/pkg/cli"
 	"github.com/container-mgmt/messaging-library/pkg/client"
 	"github.com/container-mgmt/messaging-library/pkg/connections/stomp"
 )
@@ -31,6 +38,52 @@ var receiveCmd = &cobra.Command{
 	Run:   runReceive,
 }
 
+var (
+	shutdownTimeout time.Duration
+	selector        string
+	brokerSelector  bool
+	clientID        string
+	durableName     string
+)
+
+func init() {
+	flags := receiveCmd.Flags()
+	flags.DurationVar(
+		&shutdownTimeout,
+		"shutdown-timeout",
+		30*time.Second,
+		"The maximum time to wait for the messages in progress when shutting down.",
+	)
+	flags.StringVar(
+		&selector,
+		"selector",
+		"",
+		"An expression that selects the messages to receive, for example "+
+			"\"kind = 'Event' AND priority > 5\". If this option isn't given then all "+
+			"the messages will be received.",
+	)
+	flags.BoolVar(
+		&brokerSelector,
+		"broker-selector",
+		false,
+		"Send the selector to the broker too. Use it only when all the identifiers of the "+
+			"selector are headers.",
+	)
+	flags.StringVar(
+		&clientID,
+		"client-id",
+		"",
+		"The identifier of the client, required by some brokers for durable subscriptions.",
+	)
+	flags.StringVar(
+		&durableName,
+		"durable-name",
+		"",
+		"The name of a durable subscription. If this option is given then the broker will "+
+			"keep the messages sent while the tool isn't running.",
+	)
+}
+
 func callback(message client.Message, destination string) (err error) {
 	if message.Err != nil {
 		err = message.Err
@@ -60,7 +113,7 @@ func runReceive(cmd *cobra.Command, args []string) {
 	}
 
 	// Set the clients variables before we can open it.
-	c, err = stomp.NewConnection(&client.ConnectionSpec{
+	spec := &client.ConnectionSpec{
 		// Global options:
 		BrokerHost:   brokerHost,
 		BrokerPort:   brokerPort,
@@ -68,7 +121,13 @@ func runReceive(cmd *cobra.Command, args []string) {
 		UserPassword: userPassword,
 		UseTLS:       useTLS,
 		InsecureTLS:  insecureTLS,
-	})
+		ClientID:     clientID,
+
+		// Write the log messages of the library using glog:
+		Logger: cli.GlogLogger{},
+	}
+	cli.Instrument(spec, metricsAddress)
+	c, err = stomp.NewConnection(spec)
 	if err != nil {
 		glog.Errorf(
 			"Can't connect to message broker at host '%s' and port %d: %s",
@@ -86,9 +145,13 @@ func runReceive(cmd *cobra.Command, args []string) {
 	)
 
 	// Receive messages:
-	err = c.Subscribe(destinationName, callback)
-	defer c.Unsubscribe(destinationName)
-
+	err = c.SubscribeWithSpec(client.SubscriptionSpec{
+		Destination:    destinationName,
+		Callback:       callback,
+		Selector:       selector,
+		BrokerSelector: brokerSelector,
+		DurableName:    durableName,
+	})
 	if err != nil {
 		glog.Errorf(
 			"Can't subscribe to destination '%s': %s",
@@ -102,9 +165,26 @@ func runReceive(cmd *cobra.Command, args []string) {
 		destinationName,
 	)
 
-	// wait for messages
-	done := make(chan bool, 1)
-	<-done
-
+	// Wait for messages till we are asked to stop:
+	waitForShutdown(c)
 	return
 }
+
+// waitForShutdown waits for a termination signal, and then shuts down the connection
+// gracefully, waiting for the messages in progress to be handled.
+func waitForShutdown(c client.Connection) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	received := <-signals
+	glog.Infof("Received signal '%s', shutting down", received)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := c.Shutdown(ctx)
+	if err != nil {
+		glog.Errorf(
+			"Can't shutdown gracefully: %s",
+			err.Error(),
+		)
+	}
+}
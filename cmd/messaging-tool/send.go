@@ -23,7 +23,9 @@ import (
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
 
+	"github.com/container-mgmt/messaging-library/pkg/cli"
 	"github.com/container-mgmt/messaging-library/pkg/client"
+	"github.com/container-mgmt/messaging-library/pkg/compression"
 	"github.com/container-mgmt/messaging-library/pkg/connections/stomp"
 )
 
@@ -31,6 +33,8 @@ var (
 	contentType  string
 	messageBody  string
 	messageCount int
+	delivery     client.DeliveryOptions
+	encoding     string
 )
 
 var sendCmd = &cobra.Command{
@@ -63,6 +67,39 @@ func init() {
 		1,
 		"The number of messages to send.",
 	)
+	flags.BoolVar(
+		&delivery.NonPersistent,
+		"non-persistent",
+		false,
+		"Don't ask the broker to store the messages.",
+	)
+	flags.IntVar(
+		&delivery.Priority,
+		"priority",
+		0,
+		"The priority of the messages, from 1 (lowest) to 9 (highest). If this option isn't "+
+			"given then the default priority of the broker will be used.",
+	)
+	flags.DurationVar(
+		&delivery.TimeToLive,
+		"ttl",
+		0,
+		"The time after which the broker discards the messages if they weren't delivered. "+
+			"If this option isn't given then the messages never expire.",
+	)
+	flags.DurationVar(
+		&delivery.Delay,
+		"delay",
+		0,
+		"The time that the broker waits before delivering the messages.",
+	)
+	flags.StringVar(
+		&encoding,
+		"compression",
+		"",
+		"The algorithm used to compress the messages: 'gzip', 'zstd' or 'snappy'. If this "+
+			"option isn't given then the messages won't be compressed.",
+	)
 }
 
 func runSend(cmd *cobra.Command, args []string) {
@@ -76,8 +113,19 @@ func runSend(cmd *cobra.Command, args []string) {
 		return
 	}
 
+	// Check the compression algorithm:
+	var compressor compression.Compressor
+	if encoding != "" {
+		var ok bool
+		compressor, ok = compression.Lookup(encoding)
+		if !ok {
+			glog.Errorf("Unsupported compression algorithm '%s'", encoding)
+			return
+		}
+	}
+
 	// Set the clients variables before we can open it.
-	c, err = stomp.NewConnection(&client.ConnectionSpec{
+	spec := &client.ConnectionSpec{
 		// Global options:
 		BrokerHost:   brokerHost,
 		BrokerPort:   brokerPort,
@@ -85,7 +133,17 @@ func runSend(cmd *cobra.Command, args []string) {
 		UserPassword: userPassword,
 		UseTLS:       useTLS,
 		InsecureTLS:  insecureTLS,
-	})
+
+		// Compress the messages if requested:
+		Compression: client.CompressionSpec{
+			Compressor: compressor,
+		},
+
+		// Write the log messages of the library using glog:
+		Logger: cli.GlogLogger{},
+	}
+	cli.Instrument(spec, metricsAddress)
+	c, err = stomp.NewConnection(spec)
 	if err != nil {
 		glog.Errorf(
 			"Can't connect to message broker at host '%s' and port %d: %s",
@@ -135,32 +193,48 @@ func runSend(cmd *cobra.Command, args []string) {
 	// Inform user about the message body.
 	glog.Infof("Message: %s", body)
 
-	// Send a message:
-	for i := 0; i < messageCount; i++ {
-		// Create a message with data object to send to the message broker,
-		// the data payload must be of type client.MessageData{}.
-		m := client.Message{
+	// Create the messages with data object to send to the message broker,
+	// the data payload must be of type client.MessageData{}.
+	messages := make([]client.Message, messageCount)
+	for i := range messages {
+		messages[i] = client.Message{
 			ContentType: contentType,
 			Data: client.MessageData{
 				"kind": "InfoMessage",
 				"spec": map[string]string{"message": body},
 			},
+			Delivery: delivery,
 		}
+	}
 
-		// Send message to messaging broker.
-		err = c.Publish(m, destinationName)
-		if err != nil {
+	// Send the messages in one batch, and wait for the broker to confirm them:
+	err = c.PublishBatchWithSpec(client.BatchSpec{
+		Destination: destinationName,
+		Messages:    messages,
+		WaitReceipt: true,
+	})
+	if batchErr, ok := err.(*client.BatchError); ok {
+		for _, i := range batchErr.Failed() {
 			glog.Errorf(
-				"Can't send message to destination '%s': %s",
+				"Can't send message %d to destination '%s': %s",
+				i,
 				destinationName,
-				err.Error(),
+				batchErr.Errors[i].Error(),
 			)
-			break
-		}
-		if messageCount > 1 {
-			glog.Infof("Message %d sent", i)
-		} else {
-			glog.Infof("Message sent")
 		}
+		return
+	}
+	if err != nil {
+		glog.Errorf(
+			"Can't send messages to destination '%s': %s",
+			destinationName,
+			err.Error(),
+		)
+		return
+	}
+	if messageCount > 1 {
+		glog.Infof("%d messages sent", messageCount)
+	} else {
+		glog.Infof("Message sent")
 	}
 }
@@ -34,6 +34,7 @@ var (
 	userPassword   string
 	useTLS         bool
 	insecureTLS    bool
+	metricsAddress string
 
 	// Main command:
 	rootCmd = &cobra.Command{
@@ -74,7 +75,8 @@ func init() {
 		&responsesQueue,
 		"responses-queue",
 		"",
-		"The name of the responses queue.",
+		"The name of the responses queue. If this option isn't given then a private "+
+			"responses queue will be created.",
 	)
 	flags.StringVar(
 		&userName,
@@ -100,6 +102,13 @@ func init() {
 		false,
 		"Don't check the server TLS certificate and host name.",
 	)
+	flags.StringVar(
+		&metricsAddress,
+		"metrics-address",
+		"",
+		"The address where the Prometheus metrics will be served, for example ':9090'. If "+
+			"this option isn't given then metrics aren't collected.",
+	)
 
 	// Register the subcommands:
 	rootCmd.AddCommand(requestCmd)
@@ -23,6 +23,7 @@ import (
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
 
+	"github.com/container-mgmt/messaging-library/pkg/cli"
 	"github.com/container-mgmt/messaging-library/pkg/client"
 	"github.com/container-mgmt/messaging-library/pkg/connections/stomp"
 )
@@ -91,13 +92,8 @@ func runRequest(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	if responsesQueue == "" {
-		glog.Errorf("The argument 'responses-queue' is mandatory")
-		return
-	}
-
 	// Set the clients variables before we can open it.
-	c, err = stomp.NewConnection(&client.ConnectionSpec{
+	spec := &client.ConnectionSpec{
 		// Global options:
 		BrokerHost:   brokerHost,
 		BrokerPort:   brokerPort,
@@ -105,7 +101,12 @@ func runRequest(cmd *cobra.Command, args []string) {
 		UserPassword: userPassword,
 		UseTLS:       useTLS,
 		InsecureTLS:  insecureTLS,
-	})
+
+		// Write the log messages of the library using glog:
+		Logger: cli.GlogLogger{},
+	}
+	cli.Instrument(spec, metricsAddress)
+	c, err = stomp.NewConnection(spec)
 	if err != nil {
 		glog.Errorf(
 			"Can't connect to message broker at host '%s' and port %d: %s",
@@ -127,6 +128,9 @@ func runRequest(cmd *cobra.Command, args []string) {
 		client.RequestorSpec{
 			RequestsQueue:  requestsQueue,
 			ResponsesQueue: responsesQueue,
+
+			// Without a responses queue we use a private one:
+			PrivateResponsesQueue: responsesQueue == "",
 		})
 
 	if err != nil {
@@ -17,9 +17,16 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
 
+	"github.com/container-mgmt/messaging-library/pkg/cli"
 	"github.com/container-mgmt/messaging-library/pkg/client"
 	"github.com/container-mgmt/messaging-library/pkg/connections/stomp"
 )
@@ -31,6 +38,18 @@ var respondCmd = &cobra.Command{
 	Run:   runRespond,
 }
 
+var shutdownTimeout time.Duration
+
+func init() {
+	flags := respondCmd.Flags()
+	flags.DurationVar(
+		&shutdownTimeout,
+		"shutdown-timeout",
+		30*time.Second,
+		"The maximum time to wait for the requests in progress when shutting down.",
+	)
+}
+
 func requestHandler(request client.Message) (response client.Message, err error) {
 	if request.Err != nil {
 		err = request.Err
@@ -65,7 +84,7 @@ func runRespond(cmd *cobra.Command, args []string) {
 	}
 
 	// Set the clients variables before we can open it.
-	c, err = stomp.NewConnection(&client.ConnectionSpec{
+	spec := &client.ConnectionSpec{
 		// Global options:
 		BrokerHost:   brokerHost,
 		BrokerPort:   brokerPort,
@@ -73,7 +92,12 @@ func runRespond(cmd *cobra.Command, args []string) {
 		UserPassword: userPassword,
 		UseTLS:       useTLS,
 		InsecureTLS:  insecureTLS,
-	})
+
+		// Write the log messages of the library using glog:
+		Logger: cli.GlogLogger{},
+	}
+	cli.Instrument(spec, metricsAddress)
+	c, err = stomp.NewConnection(spec)
 	if err != nil {
 		glog.Errorf(
 			"Can't connect to message broker at host '%s' and port %d: %s",
@@ -91,7 +115,7 @@ func runRespond(cmd *cobra.Command, args []string) {
 	)
 
 	// Create Responder
-	r, err := c.NewResponder(
+	_, err = c.NewResponder(
 		client.ResponderSpec{
 			RequestsQueue: requestsQueue,
 			Callback:      requestHandler,
@@ -106,15 +130,32 @@ func runRespond(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	defer r.Close()
-
 	glog.Infof(
 		"Created responder on  '%s' (Press Ctrl-C to exit)",
 		requestsQueue,
 	)
 
-	// wait for requests
-	done := make(chan bool, 1)
-	<-done
+	// Wait for requests till we are asked to stop, shutting down the connection also shuts
+	// down the responder:
+	waitForShutdown(c)
 	return
 }
+
+// waitForShutdown waits for a termination signal, and then shuts down the connection
+// gracefully, waiting for the requests in progress to be handled.
+func waitForShutdown(c client.Connection) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	received := <-signals
+	glog.Infof("Received signal '%s', shutting down", received)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := c.Shutdown(ctx)
+	if err != nil {
+		glog.Errorf(
+			"Can't shutdown gracefully: %s",
+			err.Error(),
+		)
+	}
+}
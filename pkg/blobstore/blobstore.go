@@ -0,0 +1,51 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package blobstore contains the stores used to keep the bodies of messages that are too large
+// to be sent through the broker.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// BlobStore stores blobs identified by keys.
+type BlobStore interface {
+	// Put stores a blob, replacing the blob with the same key if it exists.
+	Put(ctx context.Context, key string, data []byte) error
+
+	// Get returns a blob. If it doesn't exist the returned error is ErrNotFound.
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Delete removes a blob. Removing a blob that doesn't exist isn't an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// ErrNotFound is the error returned when a blob doesn't exist.
+var ErrNotFound = errors.New("Blob not found")
+
+// checkKey rejects the keys that could refer to blobs outside of the store, like keys that
+// contain path separators. Keys come from the headers of the messages received, so they can't be
+// trusted.
+func checkKey(key string) error {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+		return fmt.Errorf("Invalid blob key '%s'", key)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blobstore
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileStore is a blob store that keeps each blob in a file of a local directory. The directory
+// can be shared by several hosts, for example using NFS.
+type FileStore struct {
+	dir string
+}
+
+// Make sure we implement the blob store interface.
+var _ BlobStore = &FileStore{}
+
+// NewFileStore creates a store that keeps the blobs in the given directory, creating it if it
+// doesn't exist.
+func NewFileStore(dir string) (store *FileStore, err error) {
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return
+	}
+	store = &FileStore{
+		dir: dir,
+	}
+	return
+}
+
+// Put writes a blob to a temporary file and then renames it, so that readers never see
+// incomplete blobs.
+func (s *FileStore) Put(ctx context.Context, key string, data []byte) (err error) {
+	path, err := s.path(key)
+	if err != nil {
+		return
+	}
+	tmp, err := ioutil.TempFile(s.dir, ".tmp-")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return
+}
+
+// Get reads a blob.
+func (s *FileStore) Get(ctx context.Context, key string) (data []byte, err error) {
+	path, err := s.path(key)
+	if err != nil {
+		return
+	}
+	data, err = ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		err = ErrNotFound
+	}
+	return
+}
+
+// Delete removes a blob.
+func (s *FileStore) Delete(ctx context.Context, key string) (err error) {
+	path, err := s.path(key)
+	if err != nil {
+		return
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return
+}
+
+// path returns the path of the file of a blob, rejecting the keys that would refer to files
+// outside of the directory.
+func (s *FileStore) path(key string) (path string, err error) {
+	err = checkKey(key)
+	if err != nil {
+		return
+	}
+	if strings.HasPrefix(key, ".tmp-") {
+		err = fmt.Errorf("Invalid blob key '%s'", key)
+		return
+	}
+	path = filepath.Join(s.dir, key)
+	return
+}
@@ -0,0 +1,274 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Spec contains the details of a bucket of a service compatible with the S3 API, like Amazon
+// S3, Ceph or MinIO.
+type S3Spec struct {
+	// Endpoint is the URL of the service, for example "https://s3.amazonaws.com" or
+	// "http://localhost:9000". Buckets are addressed using path style URLs.
+	Endpoint string
+
+	// Region is the region of the bucket. The default is "us-east-1".
+	Region string
+
+	// Bucket is the name of the bucket.
+	Bucket string
+
+	// Prefix is added to the keys of the blobs, for example "messages/".
+	Prefix string
+
+	// AccessKey and SecretKey are the credentials used to sign the requests.
+	AccessKey string
+	SecretKey string
+
+	// HTTPClient is used to send the requests. The default is http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// S3Store is a blob store that keeps the blobs in a bucket of a service compatible with the S3
+// API. Requests are signed with AWS Signature Version 4.
+type S3Store struct {
+	spec     S3Spec
+	endpoint *url.URL
+}
+
+// Make sure we implement the blob store interface.
+var _ BlobStore = &S3Store{}
+
+// NewS3Store creates a store that keeps the blobs in the bucket of the given specification.
+func NewS3Store(spec S3Spec) (store *S3Store, err error) {
+	if spec.Bucket == "" {
+		err = fmt.Errorf("The bucket is mandatory")
+		return
+	}
+	endpoint, err := url.Parse(spec.Endpoint)
+	if err != nil {
+		return
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		err = fmt.Errorf("Endpoint '%s' isn't an absolute URL", spec.Endpoint)
+		return
+	}
+	if spec.Region == "" {
+		spec.Region = "us-east-1"
+	}
+	if spec.HTTPClient == nil {
+		spec.HTTPClient = http.DefaultClient
+	}
+	store = &S3Store{
+		spec:     spec,
+		endpoint: endpoint,
+	}
+	return
+}
+
+// Put uploads a blob.
+func (s *S3Store) Put(ctx context.Context, key string, data []byte) (err error) {
+	response, err := s.do(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		err = s.failure(response, key)
+	}
+	return
+}
+
+// Get downloads a blob.
+func (s *S3Store) Get(ctx context.Context, key string) (data []byte, err error) {
+	response, err := s.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusOK:
+		data, err = ioutil.ReadAll(response.Body)
+	case http.StatusNotFound:
+		err = ErrNotFound
+	default:
+		err = s.failure(response, key)
+	}
+	return
+}
+
+// Delete removes a blob.
+func (s *S3Store) Delete(ctx context.Context, key string) (err error) {
+	response, err := s.do(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+	default:
+		err = s.failure(response, key)
+	}
+	return
+}
+
+// do sends a signed request for a blob.
+func (s *S3Store) do(ctx context.Context, method, key string, body []byte) (response *http.Response,
+	err error) {
+	// Don't let keys escape the prefix:
+	err = checkKey(key)
+	if err != nil {
+		return
+	}
+
+	location := *s.endpoint
+	location.Path = strings.TrimSuffix(location.Path, "/") + "/" + s.spec.Bucket + "/" +
+		s.spec.Prefix + key
+	request, err := http.NewRequest(method, location.String(), bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	request = request.WithContext(ctx)
+
+	// Send the path encoded exactly like it is signed:
+	request.URL.RawPath = uriEncode(request.URL.Path)
+	signRequest(request, body, s.spec.Region, s.spec.AccessKey, s.spec.SecretKey, time.Now())
+	response, err = s.spec.HTTPClient.Do(request)
+	return
+}
+
+// failure returns the error for an unexpected response.
+func (s *S3Store) failure(response *http.Response, key string) error {
+	detail, _ := ioutil.ReadAll(response.Body)
+	return fmt.Errorf(
+		"Request for blob '%s' failed with status %d: %s",
+		key,
+		response.StatusCode,
+		strings.TrimSpace(string(detail)),
+	)
+}
+
+// Names of the headers used by the signature.
+const (
+	amzDateHeader    = "X-Amz-Date"
+	amzContentHeader = "X-Amz-Content-Sha256"
+)
+
+// signRequest adds the headers of AWS Signature Version 4 to a request.
+func signRequest(request *http.Request, body []byte, region, accessKey, secretKey string,
+	now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payload := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(payload[:])
+	request.Header.Set(amzDateHeader, amzDate)
+	request.Header.Set(amzContentHeader, payloadHash)
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	signedHeaders, canonicalRequest := canonicalRequest(request, payloadHash)
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey,
+		scope,
+		signedHeaders,
+		signature,
+	))
+}
+
+// canonicalRequest returns the signed headers and the canonical form of a request, as defined
+// by AWS Signature Version 4. All the headers of the request are signed.
+func canonicalRequest(request *http.Request, payloadHash string) (signedHeaders string,
+	canonical string) {
+	headers := map[string]string{
+		"host": request.URL.Host,
+	}
+	for name, values := range request.Header {
+		if name == "Authorization" {
+			continue
+		}
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var lines []string
+	for _, name := range names {
+		lines = append(lines, name+":"+headers[name]+"\n")
+	}
+	signedHeaders = strings.Join(names, ";")
+
+	canonical = strings.Join([]string{
+		request.Method,
+		uriEncode(request.URL.Path),
+		request.URL.Query().Encode(),
+		strings.Join(lines, ""),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	return
+}
+
+// uriEncode encodes a path as required by AWS Signature Version 4, keeping the slashes.
+func uriEncode(path string) string {
+	var buffer bytes.Buffer
+	for _, b := range []byte(path) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', b == '/':
+			buffer.WriteByte(b)
+		default:
+			fmt.Fprintf(&buffer, "%%%02X", b)
+		}
+	}
+	return buffer.String()
+}
+
+// hmacSHA256 calculates the HMAC-SHA256 of data.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
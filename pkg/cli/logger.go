@@ -0,0 +1,58 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cli contains the code shared by the command line tools, like the logger that writes the
+// log messages of the library and the server that exposes its metrics.
+package cli
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/golang/glog"
+)
+
+// GlogLogger is the implementation of the client.Logger interface that writes the log messages
+// of the library using glog, adding the fields to the text of the messages.
+type GlogLogger struct{}
+
+func (GlogLogger) Debug(msg string, keysAndValues ...interface{}) {
+	glog.V(1).Info(format(msg, keysAndValues))
+}
+
+func (GlogLogger) Info(msg string, keysAndValues ...interface{}) {
+	glog.Info(format(msg, keysAndValues))
+}
+
+func (GlogLogger) Warn(msg string, keysAndValues ...interface{}) {
+	glog.Warning(format(msg, keysAndValues))
+}
+
+func (GlogLogger) Error(msg string, keysAndValues ...interface{}) {
+	glog.Error(format(msg, keysAndValues))
+}
+
+// format adds the fields to the text of a log message, for example:
+//
+//	Received response to non existing request destination=my-queue request_id=1CuvbOhtq
+func format(msg string, keysAndValues []interface{}) string {
+	var buffer bytes.Buffer
+	buffer.WriteString(msg)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		fmt.Fprintf(&buffer, " %v=%v", keysAndValues[i], keysAndValues[i+1])
+	}
+	return buffer.String()
+}
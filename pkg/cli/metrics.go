@@ -0,0 +1,51 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"net/http"
+
+	"github.com/golang/glog"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+	"github.com/container-mgmt/messaging-library/pkg/metrics"
+)
+
+// Instrument adds the metrics collector to the connection specification and starts the HTTP
+// server that exposes the metrics at the given address, if it isn't empty.
+func Instrument(spec *client.ConnectionSpec, metricsAddress string) {
+	if metricsAddress == "" {
+		return
+	}
+
+	collector := metrics.NewCollector(metrics.CollectorSpec{})
+	collector.Instrument(spec)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler(collector))
+	go func() {
+		err := http.ListenAndServe(metricsAddress, mux)
+		if err != nil {
+			glog.Errorf(
+				"Can't serve metrics at address '%s': %s",
+				metricsAddress,
+				err.Error(),
+			)
+		}
+	}()
+	glog.Infof("Serving metrics at 'http://%s/metrics'", metricsAddress)
+}
@@ -0,0 +1,70 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+)
+
+// BatchSpec contains the details of a batch of messages sent with PublishBatchWithSpec.
+type BatchSpec struct {
+	// Destination is the destination of the messages.
+	Destination string
+
+	// Messages are the messages of the batch, sent in order.
+	Messages []Message
+
+	// WaitReceipt indicates that the connection should wait till the broker confirms that it
+	// received the batch. Brokers process the frames of a connection in order, so a single
+	// receipt requested after the last message confirms all the messages of the batch. The
+	// default is to return as soon as the messages are sent.
+	WaitReceipt bool
+}
+
+// BatchError is the error returned when some of the messages of a batch fail.
+type BatchError struct {
+	// Errors contains the error of each message of the batch, in the same order than the
+	// messages, or nil for the messages that didn't fail.
+	Errors []error
+}
+
+// Failed returns the positions of the messages that failed.
+func (e *BatchError) Failed() (positions []int) {
+	for i, err := range e.Errors {
+		if err != nil {
+			positions = append(positions, i)
+		}
+	}
+	return
+}
+
+// Error returns a description of the error, including the error of the first message that
+// failed.
+func (e *BatchError) Error() string {
+	failed := e.Failed()
+	if len(failed) == 0 {
+		return "No message of the batch failed"
+	}
+	first := failed[0]
+	return fmt.Sprintf(
+		"%d of %d messages of the batch failed, message %d: %s",
+		len(failed),
+		len(e.Errors),
+		first,
+		e.Errors[first].Error(),
+	)
+}
@@ -0,0 +1,64 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"time"
+)
+
+// Names of the message headers used to split large messages into chunks.
+const (
+	// ChunkGroupHeader contains the identifier shared by all the chunks of a message.
+	ChunkGroupHeader = "chunk-group-id"
+
+	// ChunkSequenceHeader contains the position of a chunk in the message, starting with one.
+	ChunkSequenceHeader = "chunk-sequence"
+
+	// ChunkTotalHeader contains the number of chunks of the message.
+	ChunkTotalHeader = "chunk-total"
+)
+
+// ChunkingSpec controls the splitting of large messages into chunks, so that they can be sent
+// through brokers that limit the size of frames. Chunks are always reassembled when received,
+// and delivered as a single message. The chunks are acknowledged once the message is handled,
+// so the prefetch limit of the subscriptions must be larger than the number of chunks.
+//
+// Only ActiveMQ and ActiveMQ Artemis deliver all the chunks sent to a queue to the same
+// consumer. With other brokers chunked messages should only be sent to topics or to queues with
+// a single consumer, as chunks spread among competing consumers never complete.
+//
+// For example, to split the bodies larger than 1 MiB:
+//
+//	spec := &client.ConnectionSpec{
+//	  Chunking: client.ChunkingSpec{
+//	    Size: 1024 * 1024,
+//	  },
+//	}
+type ChunkingSpec struct {
+	// Size is the maximum size in bytes of the body of each chunk. Bodies larger than this
+	// are split. The default is to not split bodies.
+	Size int
+
+	// Timeout is the maximum time to wait for the missing chunks of a message, after the
+	// first chunk is received. Incomplete messages are discarded after this time. The default
+	// is one minute.
+	Timeout time.Duration
+
+	// MaxMemory is the maximum number of bytes kept for incomplete messages. When it is
+	// exceeded the oldest incomplete messages are discarded. The default is 64 MiB.
+	MaxMemory int
+}
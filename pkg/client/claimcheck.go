@@ -0,0 +1,64 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"github.com/container-mgmt/messaging-library/pkg/blobstore"
+)
+
+// Names of the message headers used to find the body of a message when it is stored outside of
+// the broker.
+const (
+	// ClaimCheckHeader is the header containing the key of the blob that contains the body.
+	ClaimCheckHeader = "claim-check"
+
+	// ClaimCheckDigestHeader is the header containing the SHA-256 digest of the blob, encoded
+	// with base64, so that the blob can't be replaced or referenced by someone that doesn't
+	// know its contents.
+	ClaimCheckDigestHeader = "claim-check-digest"
+)
+
+// ClaimCheckSpec controls the claim-check pattern: the bodies of the published messages that
+// are larger than a threshold are kept in a blob store, and only the key of the blob is sent
+// through the broker. Received messages that contain a key are always fetched from the store of
+// the connection before they are delivered. When the connection signs messages, the signature
+// is verified before the blob is fetched.
+//
+// For example, to store the bodies larger than 10 MiB in a directory:
+//
+//	store, err := blobstore.NewFileStore("/var/lib/messages")
+//	spec := &client.ConnectionSpec{
+//	  ClaimCheck: client.ClaimCheckSpec{
+//	    Store:     store,
+//	    Threshold: 10 * 1024 * 1024,
+//	  },
+//	}
+type ClaimCheckSpec struct {
+	// Store keeps the bodies of the messages. The default is to send all the bodies through
+	// the broker.
+	Store blobstore.BlobStore
+
+	// Threshold is the size in bytes of the smallest body that is stored. The default is to
+	// store all the bodies.
+	Threshold int
+
+	// DeleteOnReceive removes the blobs once the messages are handled and acknowledged. Use
+	// it only when each message has a single consumer, for example with queues. Only the blobs
+	// of the messages that were received successfully are removed. The default is to keep the
+	// blobs, and leave their removal to the policies of the store.
+	DeleteOnReceive bool
+}
@@ -0,0 +1,52 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"github.com/container-mgmt/messaging-library/pkg/compression"
+)
+
+// ContentEncodingHeader is the header containing the algorithm used to compress the body of a
+// message, for example "gzip".
+const ContentEncodingHeader = "content-encoding"
+
+// CompressionSpec controls the compression of the bodies of the messages published by a
+// connection. Received messages are always decompressed, using the algorithm of their
+// content-encoding header, up to a maximum size.
+//
+// For example, to compress with gzip the messages larger than 64 KiB:
+//
+//	spec := &client.ConnectionSpec{
+//	  Compression: client.CompressionSpec{
+//	    Compressor: compression.Gzip,
+//	    Threshold:  64 * 1024,
+//	  },
+//	}
+type CompressionSpec struct {
+	// Compressor is the algorithm used to compress the bodies of the messages. The default is
+	// to not compress them. The Compression field of a message overrides it.
+	Compressor compression.Compressor
+
+	// Threshold is the size in bytes of the smallest body that is compressed. The default is
+	// to compress all the bodies.
+	Threshold int
+
+	// MaxDecompressedSize is the maximum size in bytes of the decompressed bodies of the
+	// messages received. Messages with larger bodies are delivered with an error. The default
+	// is 64 MiB.
+	MaxDecompressedSize int
+}
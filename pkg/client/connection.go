@@ -20,29 +20,34 @@ limitations under the License.
 // In this library we use the term destinations to describe both queues and topics.
 package client
 
+import (
+	"context"
+)
+
 // SubscriptionCallback is the callback function type used for subscription callback.
 // The callback function is used when subscribing to a destination, it is the
 // function that will triger in the event of a message or an error frame.
 //
 // For example:
-//   func callback(message client.Message, destination string) (err error) {
-//  	if message.Err != nil {
-//  		err = message.Err
-//  		glog.Errorf(
-//  			"Received error from destination '%s': %s",
-//  			destinationName,
-//  			err.Error(),
-//  		)
-//  		return
-//  	}
 //
-//  	glog.Infof(
-//  		"Received message from destination '%s':\n%v",
-//  		destination,
-//  		message.Data,
-//  	)
-//  	return
-//  }
+//	func callback(message client.Message, destination string) (err error) {
+//		if message.Err != nil {
+//			err = message.Err
+//			glog.Errorf(
+//				"Received error from destination '%s': %s",
+//				destinationName,
+//				err.Error(),
+//			)
+//			return
+//		}
+//
+//		glog.Infof(
+//			"Received message from destination '%s':\n%v",
+//			destination,
+//			message.Data,
+//		)
+//		return
+//	}
 type SubscriptionCallback func(m Message, destination string) error
 
 // Connection represents the logical connection between the program and the messaging system. This
@@ -53,12 +58,25 @@ type SubscriptionCallback func(m Message, destination string) error
 // is important to reuse it as much as possible, and to close it once it is no longer needed.
 //
 // For implementation example see:
-//   https://godoc.org/github.com/container-mgmt/messaging-library/pkg/connections/stomp
+//
+//	https://godoc.org/github.com/container-mgmt/messaging-library/pkg/connections/stomp
 type Connection interface {
 	// Close closes the connection, releasing all the resources that it uses. Once closed the
 	// connection can't be reused.
 	Close() error
 
+	// Shutdown closes the connection gracefully. It waits for the responses of the requests
+	// pending in its requestors, stops accepting new deliveries, waits for the messages already
+	// delivered to be handled and for the messages being published to be sent, and then closes
+	// the connection. If the context expires before that, the connection
+	// is closed immediately and the error of the context is returned.
+	//
+	// For example:
+	//   ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	//   defer cancel()
+	//   err = c.Shutdown(ctx)
+	Shutdown(ctx context.Context) error
+
 	// Publish sends a message to the messaging server, which in turn sends the
 	// message to the specified destination. If the messaging server fails to
 	// receive the message for any reason, the connection will close.
@@ -84,6 +102,22 @@ type Connection interface {
 	//   }
 	Publish(m Message, destination string) error
 
+	// PublishBatch sends a batch of messages to a destination without waiting for each message
+	// to be sent before sending the next one. If some of the messages fail the returned error
+	// is a *BatchError that contains the error of each message.
+	PublishBatch(messages []Message, destination string) error
+
+	// PublishBatchWithSpec sends a batch of messages, like PublishBatch, with the additional
+	// options of the specification, for example waiting for the broker to confirm the batch.
+	//
+	// For example:
+	//   err = c.PublishBatchWithSpec(client.BatchSpec{
+	//   	Destination: "my-queue",
+	//   	Messages:    messages,
+	//   	WaitReceipt: true,
+	//   })
+	PublishBatchWithSpec(spec BatchSpec) error
+
 	// Subscribe creates a subscription on the messaging server.
 	// The subscription has a destination, and messages sent to that destination
 	// will be received by this subscription.
@@ -91,9 +125,37 @@ type Connection interface {
 	// Once a message or an error is received, the callback function will be trigered.
 	Subscribe(destination string, callback SubscriptionCallback) error
 
+	// SubscribeWithSpec creates a subscription on the messaging server, like Subscribe, with
+	// the additional options of the specification, for example flow control.
+	//
+	// For example:
+	//   err = c.SubscribeWithSpec(client.SubscriptionSpec{
+	//   	Destination: "my-queue",
+	//   	Callback:    callback,
+	//   	FlowControl: client.FlowControl{
+	//   		Prefetch:   10,
+	//   		BufferSize: 100,
+	//   		Overflow:   client.OverflowDropOldest,
+	//   	},
+	//   })
+	SubscribeWithSpec(spec SubscriptionSpec) error
+
 	// Unsubscribe unsubscribes from a destination
 	Unsubscribe(destination string) error
 
+	// RemoveDurableSubscription removes a durable subscription permanently, so that the broker
+	// discards the messages kept for it. Unsubscribe only detaches from durable subscriptions.
+	// It returns an error if the broker doesn't confirm the removal in time.
+	RemoveDurableSubscription(destination string, name string) error
+
+	// AddEventListener adds a listener that will receive the events of the life cycle of the
+	// connection and of its subscriptions.
+	AddEventListener(listener EventListener)
+
+	// Health returns a report of the state of the connection, of its subscriptions and of the
+	// requests pending.
+	Health() Health
+
 	// Requestor API
 	NewRequestor(spec RequestorSpec) (r Requestor, err error)
 
@@ -24,4 +24,53 @@ type ConnectionSpec struct {
 	UserPassword string
 	UseTLS       bool
 	InsecureTLS  bool
+
+	// ClientID identifies the client to the broker. Some brokers require it to create durable
+	// subscriptions.
+	ClientID string
+
+	// PublishMiddleware is applied to all the messages sent by the connection, including
+	// requests and responses.
+	PublishMiddleware []PublishMiddleware
+
+	// SubscriptionMiddleware is applied to all the messages delivered to the connection,
+	// including requests and responses.
+	SubscriptionMiddleware []SubscriptionMiddleware
+
+	// Metrics receives the measurements of the connection and of its requestors. It is
+	// optional.
+	Metrics Metrics
+
+	// Logger is used to write the log messages of the connection and of its requestors and
+	// responders. The default is a logger that discards all the messages.
+	Logger Logger
+
+	// EventListeners receive the events of the connection, including the first
+	// ConnectedEvent, which is sent before the connection is returned.
+	EventListeners []EventListener
+
+	// PublishLimiters limit the rate of the messages published to each destination. The same
+	// limiter can be used for multiple destinations, so that they are limited together. The
+	// default is no limit.
+	PublishLimiters map[string]Limiter
+
+	// Compression controls the compression of the bodies of the published messages. The
+	// default is to not compress them.
+	Compression CompressionSpec
+
+	// Envelope controls the signing and the encryption of the bodies of the messages. The
+	// default is to neither sign nor encrypt them.
+	Envelope EnvelopeSpec
+
+	// Chunking controls the splitting of large messages into chunks. The default is to not
+	// split them.
+	Chunking ChunkingSpec
+
+	// ClaimCheck controls the storage of large bodies outside of the broker. The default is to
+	// send all the bodies through the broker.
+	ClaimCheck ClaimCheckSpec
+
+	// Validation controls the validation of the data of the messages with JSON schemas. The
+	// default is to not validate them.
+	Validation ValidationSpec
 }
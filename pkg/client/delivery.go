@@ -0,0 +1,83 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"time"
+)
+
+// DeliveryOptions controls how the broker delivers a message. The zero value is a persistent
+// message with the default priority of the broker, that never expires and that is delivered
+// immediately.
+//
+// For example, to send a message that is discarded if it isn't consumed in a minute:
+//
+//	m := client.Message{
+//	  Data: data,
+//	  Delivery: client.DeliveryOptions{
+//	    TimeToLive: time.Minute,
+//	  },
+//	}
+type DeliveryOptions struct {
+	// NonPersistent indicates that the broker doesn't need to store the message, so it may be
+	// lost if the broker restarts.
+	NonPersistent bool
+
+	// Priority is the priority of the message, from 1 (lowest) to 9 (highest). Messages with
+	// higher priority are delivered before the messages waiting in the same queue. Zero means
+	// the default priority of the broker, usually 4.
+	Priority int
+
+	// TimeToLive is the time after which the broker discards the message if it wasn't
+	// delivered yet. Zero means that the message never expires.
+	TimeToLive time.Duration
+
+	// Delay is the time that the broker waits before delivering the message. Zero means that
+	// the message is delivered immediately.
+	Delay time.Duration
+}
+
+// Names of the message headers used to request the delivery options. The persistence and the
+// priority use the same header in all the brokers, but the expiration and the delay don't, so
+// messages carry the variant of each broker.
+const (
+	// PersistentHeader indicates if the message should be stored by the broker.
+	PersistentHeader = "persistent"
+
+	// PriorityHeader contains the priority of the message.
+	PriorityHeader = "priority"
+
+	// ExpiresHeader contains the time when the message expires, in milliseconds since the
+	// epoch. Used by ActiveMQ and ActiveMQ Artemis.
+	ExpiresHeader = "expires"
+
+	// ExpirationHeader contains the time to live of the message, in milliseconds. Used by
+	// RabbitMQ.
+	ExpirationHeader = "expiration"
+
+	// ScheduledDelayHeader contains the delay of the message, in milliseconds. Used by
+	// ActiveMQ.
+	ScheduledDelayHeader = "AMQ_SCHEDULED_DELAY"
+
+	// ScheduledDeliveryHeader contains the time when the message should be delivered, in
+	// milliseconds since the epoch. Used by ActiveMQ Artemis.
+	ScheduledDeliveryHeader = "_AMQ_SCHED_DELIVERY"
+
+	// DelayHeader contains the delay of the message, in milliseconds. Used by the delayed
+	// message exchange plugin of RabbitMQ.
+	DelayHeader = "x-delay"
+)
@@ -0,0 +1,47 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"github.com/container-mgmt/messaging-library/pkg/envelope"
+)
+
+// EnvelopeSpec controls the signing and the encryption of the bodies of the messages sent and
+// received by a connection. When signing is enabled the messages received without a valid
+// signature are delivered with an error, and when encryption is enabled the messages received
+// unencrypted are delivered with an error too.
+//
+// For example, to sign with HMAC and encrypt with AES-GCM:
+//
+//	spec := &client.ConnectionSpec{
+//	  Envelope: client.EnvelopeSpec{
+//	    Keys:       keys,
+//	    Signing:    envelope.HMACSHA256,
+//	    Encryption: envelope.AESGCM,
+//	  },
+//	}
+type EnvelopeSpec struct {
+	// Keys supplies the keys used to sign, verify, encrypt and decrypt the messages.
+	Keys envelope.KeyProvider
+
+	// Signing is the algorithm used to sign the messages. The default is to not sign them.
+	Signing envelope.SigningAlgorithm
+
+	// Encryption is the algorithm used to encrypt the messages. The default is to not encrypt
+	// them.
+	Encryption envelope.EncryptionAlgorithm
+}
@@ -0,0 +1,68 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+// EventType is the type of the events of the life cycle of connections and subscriptions.
+type EventType string
+
+// Types of the events sent to the event listeners of connections.
+const (
+	// ConnectedEvent is sent when the connection to the broker is established.
+	ConnectedEvent EventType = "Connected"
+
+	// DisconnectedEvent is sent when the connection to the broker is closed, or lost. When the
+	// connection is lost the error of the event describes the reason.
+	DisconnectedEvent EventType = "Disconnected"
+
+	// ErrorFrameEvent is sent when the broker reports an error on a subscription.
+	ErrorFrameEvent EventType = "ErrorFrame"
+
+	// ReceiptTimeoutEvent is sent when the broker doesn't confirm an operation that requires a
+	// receipt in time, for example an unsubscription during shutdown.
+	ReceiptTimeoutEvent EventType = "ReceiptTimeout"
+)
+
+// Event describes something that happened to a connection or to one of its subscriptions.
+type Event struct {
+	// Type is the type of the event.
+	Type EventType
+
+	// Broker is the address of the broker, for example "localhost:61613".
+	Broker string
+
+	// Destination is the destination of the subscription, for the events that are related to a
+	// subscription.
+	Destination string
+
+	// Err is the error that caused the event, if any.
+	Err error
+}
+
+// EventListener is the function type used to receive the events of a connection. Listeners are
+// called synchronously, so they should return quickly.
+//
+// For example:
+//
+//	func listener(event client.Event) {
+//		switch event.Type {
+//		case client.ConnectedEvent:
+//			ready.Store(true)
+//		case client.DisconnectedEvent:
+//			ready.Store(false)
+//		}
+//	}
+type EventListener func(event Event)
@@ -0,0 +1,69 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"time"
+)
+
+// Health is the report of the state of a connection, used for example by liveness and readiness
+// probes.
+type Health struct {
+	// Connected indicates if the connection to the broker is alive.
+	Connected bool `json:"connected"`
+
+	// Broker is the address of the broker, for example "localhost:61613".
+	Broker string `json:"broker"`
+
+	// LastHeartbeat is the last time that data, either a message or a heart-beat, was received
+	// from the broker. It is zero if nothing was received yet.
+	LastHeartbeat time.Time `json:"lastHeartbeat"`
+
+	// Subscriptions are the reports of the subscriptions of the connection, including the ones
+	// of its requestors and responders.
+	Subscriptions []SubscriptionHealth `json:"subscriptions"`
+
+	// PendingRequests is the number of requests waiting for responses, for each requests
+	// queue.
+	PendingRequests map[string]int `json:"pendingRequests"`
+}
+
+// SubscriptionHealth is the report of the state of a subscription.
+type SubscriptionHealth struct {
+	// Destination is the destination of the subscription.
+	Destination string `json:"destination"`
+
+	// Active indicates if the subscription is receiving messages.
+	Active bool `json:"active"`
+
+	// LastDelivery is the last time that a message was delivered to the subscription. It is
+	// zero if no message was delivered yet.
+	LastDelivery time.Time `json:"lastDelivery"`
+}
+
+// Ready checks if the connection is alive and all its subscriptions are receiving messages.
+func (h Health) Ready() bool {
+	if !h.Connected {
+		return false
+	}
+	for _, subscription := range h.Subscriptions {
+		if !subscription.Active {
+			return false
+		}
+	}
+	return true
+}
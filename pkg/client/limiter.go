@@ -0,0 +1,43 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+
+	"golang.org/x/time/rate"
+)
+
+// Limiter limits the rate of an operation, for example the messages published to a destination,
+// or the messages handled by a subscription. The same limiter can be shared by multiple
+// destinations, so that they are limited together.
+//
+// The *rate.Limiter type of the golang.org/x/time/rate package implements this interface.
+type Limiter interface {
+	// Wait blocks till the operation is allowed, or till the context expires.
+	Wait(ctx context.Context) error
+}
+
+// NewLimiter creates a token bucket limiter that allows the given number of operations per
+// second, with bursts of up to the given size.
+//
+// For example, to allow 10 messages per second, with bursts of up to 5 messages:
+//
+//	limiter := client.NewLimiter(10, 5)
+func NewLimiter(perSecond float64, burst int) Limiter {
+	return rate.NewLimiter(rate.Limit(perSecond), burst)
+}
@@ -0,0 +1,107 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Names of the fields added to the log messages of the library.
+const (
+	// DestinationField is the name of the field containing the destination of a message.
+	DestinationField = "destination"
+
+	// RequestIDField is the name of the field containing the identifier of a request.
+	RequestIDField = "request_id"
+
+	// MessageIDField is the name of the field containing the identifier assigned to a message
+	// by the broker.
+	MessageIDField = "message_id"
+)
+
+// Logger is the interface used by connections to write log messages. The messages are
+// structured: besides the text, they contain a list of alternating field names and values.
+//
+// For example:
+//
+//	logger.Warn(
+//		"Received response to non existing request",
+//		client.DestinationField, "my-responses",
+//		client.RequestIDField, "1CuvbOhtqBBN5PALBOFINNkJFa0",
+//	)
+//
+// The *slog.Logger type of the standard library implements this interface.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+}
+
+// NewSlogLogger creates a logger that writes the log messages using the given slog logger. If
+// the given logger is nil the default slog logger is used.
+func NewSlogLogger(logger *slog.Logger) Logger {
+	return &slogLogger{logger: logger}
+}
+
+// slogLogger is the logger that writes to an slog logger.
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+func (l *slogLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.log(slog.LevelDebug, msg, keysAndValues)
+}
+
+func (l *slogLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.log(slog.LevelInfo, msg, keysAndValues)
+}
+
+func (l *slogLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.log(slog.LevelWarn, msg, keysAndValues)
+}
+
+func (l *slogLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.log(slog.LevelError, msg, keysAndValues)
+}
+
+func (l *slogLogger) log(level slog.Level, msg string, keysAndValues []interface{}) {
+	// Use the default logger when none was given, checking every time, as it may be changed
+	// after creating this logger:
+	logger := l.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.Log(context.Background(), level, msg, keysAndValues...)
+}
+
+// NopLogger is a logger that discards all the log messages. It is the logger used by connections
+// when the specification doesn't contain one.
+type NopLogger struct{}
+
+// Debug discards the message.
+func (NopLogger) Debug(msg string, keysAndValues ...interface{}) {}
+
+// Info discards the message.
+func (NopLogger) Info(msg string, keysAndValues ...interface{}) {}
+
+// Warn discards the message.
+func (NopLogger) Warn(msg string, keysAndValues ...interface{}) {}
+
+// Error discards the message.
+func (NopLogger) Error(msg string, keysAndValues ...interface{}) {}
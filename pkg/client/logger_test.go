@@ -0,0 +1,50 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := NewSlogLogger(slog.New(slog.NewJSONHandler(&buffer, nil)))
+
+	// Debug messages are discarded by the default level of the handler.
+	logger.Debug("Hidden")
+	logger.Warn("Ignoring message", DestinationField, "my-queue", RequestIDField, "42")
+
+	var record map[string]interface{}
+	err := json.Unmarshal(buffer.Bytes(), &record)
+	if err != nil {
+		t.Fatalf("Can't parse log record '%s': %s", buffer.String(), err.Error())
+	}
+	expected := map[string]interface{}{
+		"level":          "WARN",
+		"msg":            "Ignoring message",
+		DestinationField: "my-queue",
+		RequestIDField:   "42",
+	}
+	for key, value := range expected {
+		if record[key] != value {
+			t.Errorf("Expected field '%s' to be '%v', got '%v'", key, value, record[key])
+		}
+	}
+}
@@ -16,13 +16,21 @@ limitations under the License.
 
 package client
 
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/container-mgmt/messaging-library/pkg/compression"
+)
+
 // MessageData is the message payload data type.
 //
 // For example:
-//   data := client.MessageData{
-//    "kind": "InfoMessage",
-//    "spec": map[string]string{"message": body},
-//   }
+//
+//	data := client.MessageData{
+//		"kind": "InfoMessage",
+//		"spec": map[string]string{"message": body},
+//	}
 type MessageData map[string]interface{}
 
 // Message represents a message sent or received by a connection.
@@ -38,9 +46,70 @@ type Message struct {
 	// MIME content type.
 	ContentType string // MIME of the message, usually "application/json"
 
+	// Optional header entries. When publishing, these are sent as additional headers of the
+	// message. When received from the server, these are the header entries received with the
+	// message. The headers assigned by the broker on delivery, like `message-id` or
+	// `subscription`, aren't sent again when a received message is published.
+	Header map[string]string
+
+	// Optional context of the message. When publishing, this is the context of the caller,
+	// which middleware can use, for example, to propagate the trace of the caller in the
+	// headers of the message. When received from the server, this is the context created by
+	// the subscription middleware, if any. Responders use the context of the request as the
+	// context of the response, unless the handler sets one.
+	Context context.Context
+
+	// Optional delivery options of the message, used when publishing. The default is a
+	// persistent message delivered immediately.
+	Delivery DeliveryOptions
+
+	// Optional algorithm used to compress the body of the message when publishing, instead of
+	// the one of the connection. Bodies smaller than the threshold of the connection aren't
+	// compressed. Use compression.Identity to send the body uncompressed.
+	Compression compression.Compressor
+
 	// Indicates whether an error was received on the subscription.
 	// The error will contain details of the error. If the server
 	// sent an ERROR frame, then the Data, ContentType and Header fields
 	// will be populated according to the contents of the ERROR frame.
 	Err error
 }
+
+// IsDecodeError checks if the error of a received message was caused by a body that isn't a JSON
+// object. The raw body of those messages is available under the "byteArray" key of the data, so
+// codecs of other formats can still decode it.
+func IsDecodeError(err error) bool {
+	switch err.(type) {
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		return true
+	}
+	return false
+}
+
+// TolerateDecodeErrors wraps the callback of a codec of a format other than JSON. It clears the
+// error of the messages whose body isn't a JSON object, so that the callback decodes their raw
+// body, and keeps the other errors, for example the ones reported by the broker.
+func TolerateDecodeErrors(callback SubscriptionCallback) SubscriptionCallback {
+	return func(m Message, destination string) error {
+		if m.Err != nil && IsDecodeError(m.Err) {
+			m.Err = nil
+		}
+		return callback(m, destination)
+	}
+}
+
+// Names of the message headers used to correlate requests and responses, when the requestor
+// uses header correlation.
+const (
+	// CorrelationIDHeader is the header containing the identifier of the request.
+	CorrelationIDHeader = "correlation-id"
+
+	// ReplyToHeader is the header containing the destination where responses should be sent.
+	ReplyToHeader = "reply-to"
+
+	// KindHeader is the header containing the kind of the message, "Request" or "Response".
+	KindHeader = "kind"
+
+	// ResponderIDHeader is the header containing the identity of the responder.
+	ResponderIDHeader = "responder-id"
+)
@@ -0,0 +1,47 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"time"
+)
+
+// Metrics receives the measurements of the events that can't be observed using middleware, like
+// connections to the broker, the life cycle of requests and rate limiting. It is usually
+// implemented by a metrics collector, for example the one in the metrics package:
+//
+//	https://godoc.org/github.com/container-mgmt/messaging-library/pkg/metrics
+type Metrics interface {
+	// Connected is called each time that a connection to the broker is established.
+	Connected(broker string)
+
+	// RequestStarted is called when a requestor starts waiting for the responses of a request
+	// sent to the given destination.
+	RequestStarted(destination string)
+
+	// RequestFinished is called when a requestor stops waiting for the responses of a request
+	// sent to the given destination.
+	RequestFinished(destination string)
+
+	// ResponseReceived is called when a requestor receives a response to a request sent to the
+	// given destination, with the time elapsed since the request was sent.
+	ResponseReceived(destination string, roundTrip time.Duration)
+
+	// Throttled is called when publishing a message to a destination, or handling a message
+	// received from it, was delayed by a rate limiter, with the time spent waiting.
+	Throttled(destination string, wait time.Duration)
+}
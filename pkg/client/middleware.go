@@ -0,0 +1,93 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+// PublishHandler is the function type used to send a message to a destination.
+type PublishHandler func(m Message, destination string) error
+
+// PublishMiddleware wraps the function that sends messages. It is applied to all the messages
+// sent by a connection, including the requests sent by requestors and the responses sent by
+// responders.
+//
+// For example:
+//
+//	func tenant(next client.PublishHandler) client.PublishHandler {
+//		return func(m client.Message, destination string) error {
+//			m.Header = map[string]string{"tenant": "my-tenant"}
+//			return next(m, destination)
+//		}
+//	}
+type PublishMiddleware func(next PublishHandler) PublishHandler
+
+// SubscriptionMiddleware wraps the callback that receives messages. It is applied to all the
+// messages delivered to a connection, including the requests delivered to responders and the
+// responses delivered to requestors.
+type SubscriptionMiddleware func(next SubscriptionCallback) SubscriptionCallback
+
+// RequestMiddleware wraps a request handler with additional behavior, for example logging or
+// authorization, returning a new request handler.
+//
+// For example:
+//
+//	func logging(next client.RequestHandler) client.RequestHandler {
+//		return func(request client.Message) (client.Message, error) {
+//			glog.Infof("Received request:\n%v", request.Data)
+//			return next(request)
+//		}
+//	}
+type RequestMiddleware func(next RequestHandler) RequestHandler
+
+// ResponseMiddleware wraps a response handler with additional behavior, returning a new
+// response handler.
+type ResponseMiddleware func(next ResponseHandler) ResponseHandler
+
+// ChainPublish wraps a publish handler with middleware. The first middleware given is the
+// outermost one, so it is the first to see the messages.
+func ChainPublish(handler PublishHandler, middleware ...PublishMiddleware) PublishHandler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// ChainSubscription wraps a subscription callback with middleware. The first middleware given
+// is the outermost one, so it is the first to see the messages.
+func ChainSubscription(callback SubscriptionCallback,
+	middleware ...SubscriptionMiddleware) SubscriptionCallback {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		callback = middleware[i](callback)
+	}
+	return callback
+}
+
+// ChainRequest wraps a request handler with middleware. The first middleware given is the
+// outermost one, so it is the first to see the requests.
+func ChainRequest(handler RequestHandler, middleware ...RequestMiddleware) RequestHandler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// ChainResponse wraps a response handler with middleware. The first middleware given is the
+// outermost one, so it is the first to see the responses.
+func ChainResponse(handler ResponseHandler, middleware ...ResponseMiddleware) ResponseHandler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
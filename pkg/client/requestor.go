@@ -18,6 +18,11 @@ limitations under the License.
 // queues and topics.
 package client
 
+import (
+	"context"
+	"time"
+)
+
 // ResponseHandler is called when a response to a request is received
 // m is the response message
 // requestID is the id of the request this message responds
@@ -27,11 +32,91 @@ type ResponseHandler func(response Message, requestID string) error
 type RequestorSpec struct {
 	RequestsQueue  string
 	ResponsesQueue string
+
+	// PrivateResponsesQueue indicates that the requestor should create its own unique responses
+	// queue, instead of sharing the ResponsesQueue with other requestors. With ActiveMQ and
+	// RabbitMQ the responses queue is a temporary queue, which the broker deletes when the
+	// connection is closed. Otherwise it is a regular queue named after the
+	// ResponsesQueue (or "/queue/responses" if empty) followed by a unique suffix, that the
+	// broker deletes when the requestor is closed: RabbitMQ and the messaging server of this
+	// project because the subscription has the "auto-delete" header, and ActiveMQ Artemis
+	// because it deletes the queues that it created automatically once they have no consumers
+	// and no messages, unless configured otherwise. RabbitMQ also uses a regular queue when the
+	// connection has an envelope, because it changes the reply-to header of the requests sent to
+	// temporary queues.
+	PrivateResponsesQueue bool
+
+	// TemporaryQueuePrefix is the destination prefix that the broker uses for temporary queues,
+	// for example "/temp-queue/". It is used only for private responses queues. If empty the
+	// prefix is selected according to the broker.
+	TemporaryQueuePrefix string
+
+	// HeaderCorrelation indicates that the request identifier, the responses queue and the kind
+	// of the message should be sent as message headers (see CorrelationIDHeader, ReplyToHeader
+	// and KindHeader) instead of being added to the request data. This leaves the body of the
+	// request untouched, so it can be used with payloads that aren't JSON objects. Responses are
+	// accepted in both formats.
+	HeaderCorrelation bool
+
+	// Middleware is applied to the handlers of the responses received by the requestor. The
+	// responses collected by Gather also pass through it.
+	Middleware []ResponseMiddleware
+}
+
+// GatherSpec describes when a scatter-gather request stops collecting responses.
+// Collection stops as soon as one of the following happens:
+//   - The Timeout expires.
+//   - Expected responses were received.
+//   - Quorum responses were received, if Expected isn't set.
+//
+// The Timeout is required, so that Gather returns even if some responders never answer.
+type GatherSpec struct {
+	// Timeout is the maximum time to wait for responses.
+	Timeout time.Duration
+
+	// Expected is the number of responders expected to answer the request. Gather returns as
+	// soon as all of them answered, even if the Timeout didn't expire yet.
+	Expected int
+
+	// Quorum is the minimum number of responses required for the request to
+	// succeed. If the Timeout expires before the quorum is reached, Gather
+	// returns the responses collected so far together with an error. When
+	// Expected is also set, reaching the quorum doesn't stop the collection,
+	// and the quorum can't be larger than Expected.
+	Quorum int
+}
+
+// Response is a response collected by a scatter-gather request.
+type Response struct {
+	// ResponderID is the identity of the responder that sent the response.
+	ResponderID string
+
+	// Message is the response message.
+	Message Message
 }
 
 // Requestor is a specification of publish/subscribe mechanism
 // It allows sending direct response and supply a callback
 type Requestor interface {
 	Send(request Message, callback ResponseHandler) (requestID string, err error)
+
+	// Gather publishes the request once, typically to a topic, and collects all the responses
+	// correlated to it until the conditions described by the spec are met.
+	//
+	// For example:
+	//   responses, err := r.Gather(request, client.GatherSpec{
+	//     Timeout: 5 * time.Second,
+	//     Quorum:  3,
+	//   })
+	Gather(request Message, spec GatherSpec) (responses []Response, err error)
+
+	// Close closes the requestor. The pending requests fail: the handlers of the requests sent
+	// with Send receive a response with an error, and Gather returns an error.
 	Close() error
+
+	// Shutdown closes the requestor gracefully. It stops accepting new requests, and waits for
+	// the responses of the pending requests before closing. If the context expires before
+	// that, the requestor is closed anyway, the requests still pending fail as with Close, and
+	// the error of the context is returned.
+	Shutdown(ctx context.Context) error
 }
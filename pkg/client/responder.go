@@ -18,6 +18,10 @@ limitations under the License.
 // queues and topics.
 package client
 
+import (
+	"context"
+)
+
 // RequestHandler is called when a new request is received
 // m is the request message
 // requestID is the id of the request
@@ -27,9 +31,27 @@ type RequestHandler func(request Message) (response Message, err error)
 type ResponderSpec struct {
 	RequestsQueue string
 	Callback      RequestHandler
+
+	// ID is the identity of the responder, sent with every response so that scatter-gather
+	// requestors can tell responders apart. If empty a unique identity will be generated.
+	ID string
+
+	// Middleware is applied to the Callback.
+	Middleware []RequestMiddleware
+
+	// FlowControl limits the requests received by the responder.
+	FlowControl FlowControl
 }
 
-// Responder is a request server interface
+// Responder is a request server interface.
+//
+// Responders accept requests that carry the correlation fields either as message headers or
+// inside the request data, and send each response in the same format used by its request.
 type Responder interface {
 	Close() error
+
+	// Shutdown closes the responder gracefully. It stops accepting new requests, and waits for
+	// the requests already delivered to be handled and their responses sent. If the context
+	// expires before that, the error of the context is returned.
+	Shutdown(ctx context.Context) error
 }
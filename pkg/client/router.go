@@ -0,0 +1,173 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"sync"
+)
+
+// OperationHeader is the default name of the header, and of the request data field, containing
+// the name of the operation requested.
+const OperationHeader = "operation"
+
+// UnknownOperationCode is the error code of the response sent by a router when a request asks
+// for an operation that doesn't have a handler.
+const UnknownOperationCode = "UnknownOperation"
+
+// RouterSpec is a helper struct for building routers.
+type RouterSpec struct {
+	// OperationHeader is the name of the header containing the name of the operation. The
+	// default is "operation".
+	OperationHeader string
+
+	// OperationField is the name of the request data field containing the name of the
+	// operation, used when the request doesn't have the operation header. The default is
+	// "operation".
+	OperationField string
+
+	// NotFound is the handler called for requests with unknown operations. The default handler
+	// responds with an error response with the UnknownOperationCode code. Like the routes, it
+	// goes through the middleware of the router.
+	NotFound RequestHandler
+}
+
+// Router dispatches the requests received by a responder to the handlers registered for the
+// operations that they request.
+//
+// For example:
+//
+//	router := client.NewRouter(client.RouterSpec{})
+//	router.Use(logging)
+//	router.Handle("list", listHandler)
+//	router.Handle("delete", deleteHandler, authorize)
+//
+//	r, err := c.NewResponder(
+//		client.ResponderSpec{
+//			RequestsQueue: "requests-queue",
+//			Callback:      router.HandleRequest,
+//		})
+type Router struct {
+	operationHeader string
+	operationField  string
+	notFound        RequestHandler
+
+	// middleware applied to all the routes, and mapping between operation names and their
+	// handlers, both protected by the mutex
+	middleware  []RequestMiddleware
+	routes      map[string]RequestHandler
+	routesMutex sync.RWMutex
+}
+
+// NewRouter creates a new router without routes.
+func NewRouter(spec RouterSpec) *Router {
+	router := &Router{
+		operationHeader: spec.OperationHeader,
+		operationField:  spec.OperationField,
+		notFound:        spec.NotFound,
+		routes:          make(map[string]RequestHandler),
+	}
+
+	// Init the values that weren't given:
+	if router.operationHeader == "" {
+		router.operationHeader = OperationHeader
+	}
+	if router.operationField == "" {
+		router.operationField = OperationHeader
+	}
+	if router.notFound == nil {
+		router.notFound = router.unknownOperation
+	}
+
+	return router
+}
+
+// Use adds middleware that will be applied to all the routes of the router, and to the handler of
+// the unknown operations. The middleware is applied when the requests are dispatched, so it also
+// applies to the routes added before.
+func (r *Router) Use(middleware ...RequestMiddleware) {
+	r.routesMutex.Lock()
+	defer r.routesMutex.Unlock()
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// Handle registers the handler for an operation. The middleware given is applied only to this
+// route, inside the middleware of the router. The first middleware given is the outermost one.
+func (r *Router) Handle(operation string, handler RequestHandler, middleware ...RequestMiddleware) {
+	handler = ChainRequest(handler, middleware...)
+
+	r.routesMutex.Lock()
+	r.routes[operation] = handler
+	r.routesMutex.Unlock()
+}
+
+// HandleRequest dispatches a request to the handler of its operation. It is a RequestHandler,
+// so it can be used as the callback of a responder.
+func (r *Router) HandleRequest(request Message) (response Message, err error) {
+	operation := r.Operation(request)
+
+	r.routesMutex.RLock()
+	handler, ok := r.routes[operation]
+	middleware := r.middleware
+	r.routesMutex.RUnlock()
+	if !ok {
+		handler = r.notFound
+	}
+
+	return ChainRequest(handler, middleware...)(request)
+}
+
+// Operation returns the name of the operation requested, looking first in the operation header
+// and then in the operation field of the request data.
+func (r *Router) Operation(request Message) string {
+	if operation, ok := request.Header[r.operationHeader]; ok {
+		return operation
+	}
+	operation, _ := request.Data[r.operationField].(string)
+	return operation
+}
+
+// unknownOperation is the default handler for requests with unknown operations.
+func (r *Router) unknownOperation(request Message) (response Message, err error) {
+	response = ErrorResponse(
+		UnknownOperationCode,
+		fmt.Sprintf("Unknown operation '%s'", r.Operation(request)),
+	)
+	return
+}
+
+// ErrorResponse creates a response describing an error. The data of the response contains an
+// "error" object with the given code and reason.
+//
+// For example:
+//
+//	{
+//	  "error": {
+//	    "code": "UnknownOperation",
+//	    "reason": "Unknown operation 'delete'"
+//	  }
+//	}
+func ErrorResponse(code string, reason string) Message {
+	return Message{
+		Data: MessageData{
+			"error": map[string]interface{}{
+				"code":   code,
+				"reason": reason,
+			},
+		},
+	}
+}
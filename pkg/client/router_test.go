@@ -0,0 +1,107 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"testing"
+)
+
+// Request handler that responds with a fixed value.
+func valueHandler(value string) RequestHandler {
+	return func(request Message) (Message, error) {
+		return Message{Data: MessageData{"value": value}}, nil
+	}
+}
+
+// Middleware that records its name in the trace of the request.
+func traceMiddleware(name string, trace *[]string) RequestMiddleware {
+	return func(next RequestHandler) RequestHandler {
+		return func(request Message) (Message, error) {
+			*trace = append(*trace, name)
+			return next(request)
+		}
+	}
+}
+
+func TestRouterDispatch(t *testing.T) {
+	router := NewRouter(RouterSpec{})
+	router.Handle("list", valueHandler("listed"))
+	router.Handle("delete", valueHandler("deleted"))
+
+	// The operation can be given in the request data:
+	response, _ := router.HandleRequest(Message{Data: MessageData{"operation": "list"}})
+	if response.Data["value"] != "listed" {
+		t.Errorf("Received %v expected 'listed'", response.Data["value"])
+	}
+
+	// The header takes precedence over the request data:
+	response, _ = router.HandleRequest(Message{
+		Header: map[string]string{"operation": "delete"},
+		Data:   MessageData{"operation": "list"},
+	})
+	if response.Data["value"] != "deleted" {
+		t.Errorf("Received %v expected 'deleted'", response.Data["value"])
+	}
+}
+
+func TestRouterUnknownOperation(t *testing.T) {
+	router := NewRouter(RouterSpec{})
+
+	response, err := router.HandleRequest(Message{Data: MessageData{"operation": "list"}})
+	if err != nil {
+		t.Fatalf("Unknown operation returned an error: %s", err.Error())
+	}
+	details, _ := response.Data["error"].(map[string]interface{})
+	if details["code"] != UnknownOperationCode {
+		t.Errorf("Received %v expected an unknown operation error", response.Data)
+	}
+}
+
+func TestRouterMiddleware(t *testing.T) {
+	var trace []string
+
+	router := NewRouter(RouterSpec{})
+	router.Use(traceMiddleware("router", &trace))
+	router.Handle(
+		"list",
+		valueHandler("listed"),
+		traceMiddleware("first", &trace),
+		traceMiddleware("second", &trace),
+	)
+	router.Handle("delete", valueHandler("deleted"))
+
+	// Middleware added later also applies to the routes added before.
+	router.Use(traceMiddleware("late", &trace))
+
+	router.HandleRequest(Message{Data: MessageData{"operation": "list"}})
+	router.HandleRequest(Message{Data: MessageData{"operation": "delete"}})
+	router.HandleRequest(Message{Data: MessageData{"operation": "unknown"}})
+
+	expected := []string{
+		"router", "late", "first", "second",
+		"router", "late",
+		"router", "late",
+	}
+	if len(trace) != len(expected) {
+		t.Fatalf("Middleware called %v expected %v", trace, expected)
+	}
+	for i := range expected {
+		if trace[i] != expected[i] {
+			t.Fatalf("Middleware called %v expected %v", trace, expected)
+		}
+	}
+}
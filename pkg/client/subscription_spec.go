@@ -0,0 +1,83 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+// OverflowPolicy is the policy that decides what to do with the messages received when the
+// buffer of a subscription is full.
+type OverflowPolicy string
+
+// Overflow policies of subscriptions.
+const (
+	// OverflowBlock stops reading messages from the broker till there is space in the buffer.
+	OverflowBlock OverflowPolicy = "Block"
+
+	// OverflowDropOldest discards the oldest message of the buffer to make space for the new
+	// one.
+	OverflowDropOldest OverflowPolicy = "DropOldest"
+
+	// OverflowDropNewest discards the new message.
+	OverflowDropNewest OverflowPolicy = "DropNewest"
+)
+
+// FlowControl limits the messages that the broker sends to a subscription, and the messages that
+// are kept in memory waiting for the handler.
+type FlowControl struct {
+	// Prefetch is the maximum number of messages that the broker sends before they are
+	// acknowledged. When it is set, each message is acknowledged once its handler returns, or
+	// once it is discarded by the overflow policy. The default, zero, means no limit, and
+	// messages are acknowledged when they are sent by the broker.
+	Prefetch int
+
+	// BufferSize is the number of received messages kept in memory waiting for the handler.
+	// The default, zero, means that messages are handed to the handler directly, so the next
+	// message isn't read till the handler returns.
+	BufferSize int
+
+	// Overflow is the policy applied when the buffer is full. The default is OverflowBlock.
+	Overflow OverflowPolicy
+
+	// Limiter limits the rate of the messages handed to the handler. The default is no limit.
+	Limiter Limiter
+}
+
+// SubscriptionSpec is a helper struct for building subscriptions.
+type SubscriptionSpec struct {
+	Destination string
+	Callback    SubscriptionCallback
+
+	// Selector is an expression that decides which messages the subscription receives, for
+	// example "kind = 'Event' AND priority > 5". See the selector package for the syntax. The
+	// expression is evaluated by the client, so that all the brokers behave the same. The
+	// default is to receive all the messages.
+	Selector string
+
+	// BrokerSelector sends the Selector to the brokers that support selectors too, so that
+	// they don't send the messages that don't match. Brokers only see the headers of the
+	// messages, so use it only when all the identifiers of the expression are headers, as the
+	// broker would discard the messages selected by the fields of their data.
+	BrokerSelector bool
+
+	// DurableName is the name of a durable subscription. The broker keeps the messages sent to
+	// the destination while the subscription is detached, so they are received when a
+	// subscription with the same name is created again. Some brokers, like ActiveMQ, also
+	// require the ClientID of the connection specification. The default is a subscription
+	// that isn't durable.
+	DurableName string
+
+	// FlowControl limits the messages received by the subscription.
+	FlowControl FlowControl
+}
@@ -0,0 +1,70 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"github.com/container-mgmt/messaging-library/pkg/schema"
+)
+
+// Headers added to the messages sent to the dead letter destination of the validation.
+const (
+	// ValidationErrorHeader contains the description of the problems found in the message.
+	ValidationErrorHeader = "validation-error"
+
+	// OriginalDestinationHeader contains the destination where the message was received.
+	OriginalDestinationHeader = "original-destination"
+)
+
+// ValidationSpec controls the validation of the data of the messages with JSON schemas. Messages
+// are validated with the schema of their destination and with the schema of their kind, taken
+// from the KindHeader header or from the "kind" field of the data. Published messages that don't
+// match are rejected before they are sent. Received messages that don't match are delivered with
+// the validation error in the Err field, or sent to the dead letter destination.
+//
+// Messages whose bodies aren't JSON objects, sent or received as byte arrays, aren't validated.
+//
+// For example:
+//
+//	registry := schema.NewRegistry()
+//	err = registry.LoadDir("/etc/my-service/schemas")
+//	spec := &client.ConnectionSpec{
+//	  Validation: client.ValidationSpec{
+//	    Registry: registry,
+//	    Destinations: map[string]string{
+//	      "/queue/events": "Event",
+//	    },
+//	    Kinds: map[string]string{
+//	      "Request": "Request",
+//	    },
+//	    DeadLetter: "/queue/invalid",
+//	  },
+//	}
+type ValidationSpec struct {
+	// Registry contains the schemas. The default is to not validate messages.
+	Registry *schema.Registry
+
+	// Destinations maps destinations to the names of the schemas of their messages.
+	Destinations map[string]string
+
+	// Kinds maps kinds of messages to the names of their schemas.
+	Kinds map[string]string
+
+	// DeadLetter is the destination where the received messages that don't match their
+	// schemas are sent, with the ValidationErrorHeader and OriginalDestinationHeader headers.
+	// The default is to deliver them with the validation error.
+	DeadLetter string
+}
@@ -0,0 +1,253 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cloudevents maps messages to and from CloudEvents 1.0, in the structured content mode,
+// where the event is a JSON envelope in the body of the message, and in the binary content mode,
+// where the attributes of the event are headers of the message and the data is the body.
+//
+// https://github.com/cloudevents/spec/blob/v1.0/spec.md
+package cloudevents
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+	"github.com/cloudevents/sdk-go/v2/types"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// Mode is the content mode used to carry events in messages.
+type Mode int
+
+const (
+	// Structured mode sends the event as a JSON envelope in the body of the message, with the
+	// StructuredContentType content type.
+	Structured Mode = iota
+
+	// Binary mode sends the attributes of the event as headers with the HeaderPrefix prefix,
+	// the data content type as the content type of the message, and the data as the body.
+	Binary
+)
+
+// StructuredContentType is the content type of the messages that carry events in structured
+// mode.
+const StructuredContentType = "application/cloudevents+json"
+
+// HeaderPrefix is the prefix of the headers that carry the attributes of events in binary mode,
+// for example "ce-id" or "ce-source".
+const HeaderPrefix = "ce-"
+
+// Names of the attributes of the events, other than the data content type, which is carried
+// by the content type of the message.
+const (
+	specVersionAttribute = "specversion"
+	idAttribute          = "id"
+	sourceAttribute      = "source"
+	typeAttribute        = "type"
+	subjectAttribute     = "subject"
+	timeAttribute        = "time"
+	dataSchemaAttribute  = "dataschema"
+)
+
+// ToMessage converts an event into a message, using the given content mode.
+//
+// For example:
+//
+//	e := event.New()
+//	e.SetID(ksuid.New().String())
+//	e.SetSource("/my-service")
+//	e.SetType("com.example.created")
+//	err = e.SetData("application/json", map[string]string{"name": "my-object"})
+//	m, err := cloudevents.ToMessage(e, cloudevents.Binary)
+func ToMessage(e event.Event, mode Mode) (m client.Message, err error) {
+	err = e.Validate()
+	if err != nil {
+		err = fmt.Errorf("Event '%s' isn't valid: %s", e.ID(), err.Error())
+		return
+	}
+	switch mode {
+	case Structured:
+		m, err = structuredMessage(e)
+	case Binary:
+		m, err = binaryMessage(e)
+	default:
+		err = fmt.Errorf("Unknown content mode %d", mode)
+	}
+	return
+}
+
+// structuredMessage puts the JSON representation of an event in the data of a message.
+func structuredMessage(e event.Event) (m client.Message, err error) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	m.ContentType = StructuredContentType
+	err = json.Unmarshal(body, &m.Data)
+	return
+}
+
+// binaryMessage puts the attributes of an event in the headers of a message, and the data of
+// the event in the data of the message. Data that isn't a JSON object is sent as a byte array.
+func binaryMessage(e event.Event) (m client.Message, err error) {
+	m.Header = map[string]string{
+		HeaderPrefix + specVersionAttribute: e.SpecVersion(),
+		HeaderPrefix + idAttribute:          e.ID(),
+		HeaderPrefix + sourceAttribute:      e.Source(),
+		HeaderPrefix + typeAttribute:        e.Type(),
+	}
+	if e.Subject() != "" {
+		m.Header[HeaderPrefix+subjectAttribute] = e.Subject()
+	}
+	if !e.Time().IsZero() {
+		m.Header[HeaderPrefix+timeAttribute] = types.FormatTime(e.Time())
+	}
+	if e.DataSchema() != "" {
+		m.Header[HeaderPrefix+dataSchemaAttribute] = e.DataSchema()
+	}
+	for name, value := range e.Extensions() {
+		var text string
+		text, err = types.Format(value)
+		if err != nil {
+			err = fmt.Errorf("Can't format extension '%s': %s", name, err.Error())
+			return
+		}
+		m.Header[HeaderPrefix+name] = text
+	}
+
+	m.ContentType = e.DataContentType()
+	data := e.Data()
+	if isJSON(m.ContentType) && json.Unmarshal(data, &m.Data) == nil && m.Data != nil {
+		return
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	m.Data = client.MessageData{"byteArray": data}
+	return
+}
+
+// FromMessage converts a message into an event, detecting the content mode from the content type
+// and the headers of the message.
+func FromMessage(m client.Message) (e event.Event, err error) {
+	if mediaType(m.ContentType) == StructuredContentType {
+		e, err = structuredEvent(m)
+	} else {
+		e, err = binaryEvent(m)
+	}
+	if err != nil {
+		return
+	}
+	err = e.Validate()
+	if err != nil {
+		err = fmt.Errorf("Event '%s' isn't valid: %s", e.ID(), err.Error())
+	}
+	return
+}
+
+// structuredEvent parses the JSON representation of an event contained in the data of a
+// message.
+func structuredEvent(m client.Message) (e event.Event, err error) {
+	body, raw := m.Data["byteArray"].([]byte)
+	if !raw {
+		body, err = json.Marshal(m.Data)
+		if err != nil {
+			return
+		}
+	}
+	err = json.Unmarshal(body, &e)
+	if err != nil {
+		err = fmt.Errorf("Can't parse structured event: %s", err.Error())
+	}
+	return
+}
+
+// binaryEvent builds an event from the headers and the data of a message.
+func binaryEvent(m client.Message) (e event.Event, err error) {
+	version, ok := m.Header[HeaderPrefix+specVersionAttribute]
+	if !ok {
+		err = fmt.Errorf("Message doesn't contain an event, header '%s' is missing",
+			HeaderPrefix+specVersionAttribute)
+		return
+	}
+	e = event.New(version)
+	for key, value := range m.Header {
+		if !strings.HasPrefix(key, HeaderPrefix) {
+			continue
+		}
+		switch name := strings.TrimPrefix(key, HeaderPrefix); name {
+		case specVersionAttribute:
+		case idAttribute:
+			e.SetID(value)
+		case sourceAttribute:
+			e.SetSource(value)
+		case typeAttribute:
+			e.SetType(value)
+		case subjectAttribute:
+			e.SetSubject(value)
+		case dataSchemaAttribute:
+			e.SetDataSchema(value)
+		case timeAttribute:
+			var t time.Time
+			t, err = types.ParseTime(value)
+			if err != nil {
+				err = fmt.Errorf("Can't parse time of event: %s", err.Error())
+				return
+			}
+			e.SetTime(t)
+		default:
+			e.SetExtension(name, value)
+		}
+	}
+
+	// Get the data, which is a byte array unless it is a JSON object:
+	data, raw := m.Data["byteArray"].([]byte)
+	if !raw {
+		data, err = json.Marshal(m.Data)
+		if err != nil {
+			return
+		}
+	}
+	if m.ContentType != "" {
+		e.SetDataContentType(m.ContentType)
+	}
+	if len(data) > 0 {
+		e.DataEncoded = data
+		e.DataBase64 = !isJSON(m.ContentType)
+	}
+	return
+}
+
+// mediaType returns the media type of a content type, without the parameters.
+func mediaType(contentType string) string {
+	result, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return result
+}
+
+// isJSON checks if a content type is JSON. Events without data content type are JSON.
+func isJSON(contentType string) bool {
+	result := mediaType(contentType)
+	return result == "" || result == "application/json" || result == "text/json" ||
+		strings.HasSuffix(result, "+json")
+}
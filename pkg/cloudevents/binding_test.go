@@ -0,0 +1,118 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudevents
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// newEvent creates an event with all the attributes and the given data.
+func newEvent(t *testing.T, contentType string, data interface{}) event.Event {
+	e := event.New()
+	e.SetID("my-id")
+	e.SetSource("/my-source")
+	e.SetType("com.example.created")
+	e.SetSubject("my-subject")
+	e.SetTime(time.Date(2018, 5, 1, 10, 30, 0, 0, time.UTC))
+	e.SetDataSchema("https://example.com/schema.json")
+	e.SetExtension("tenant", "my-tenant")
+	err := e.SetData(contentType, data)
+	if err != nil {
+		t.Fatalf("Can't set data: %s", err.Error())
+	}
+	return e
+}
+
+// transport simulates sending a message through the broker, which encodes the data as JSON and
+// decodes it as the connections do.
+func transport(m client.Message) client.Message {
+	body, raw := m.Data["byteArray"].([]byte)
+	if !raw {
+		body, _ = json.Marshal(m.Data)
+	}
+	received := client.Message{ContentType: m.ContentType, Header: m.Header}
+	err := json.Unmarshal(body, &received.Data)
+	if err != nil {
+		received.Data = client.MessageData{"byteArray": body}
+		received.Err = err
+	}
+	return received
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, mode := range []Mode{Structured, Binary} {
+		for _, e := range []event.Event{
+			newEvent(t, "application/json", map[string]interface{}{"name": "my-object"}),
+			newEvent(t, "text/plain", []byte("my text")),
+		} {
+			m, err := ToMessage(e, mode)
+			if err != nil {
+				t.Fatalf("Can't convert event: %s", err.Error())
+			}
+			if mode == Binary && m.Header["ce-tenant"] != "my-tenant" {
+				t.Errorf("Expected extension header, got %v", m.Header)
+			}
+
+			var received event.Event
+			Callback(func(e event.Event, destination string, err error) error {
+				if err != nil {
+					t.Fatalf("Can't receive event: %s", err.Error())
+				}
+				received = e
+				return nil
+			})(transport(m), "my-destination")
+
+			if received.String() != e.String() {
+				t.Errorf("Mode %d: received\n%s\nexpected\n%s", mode, received, e)
+			}
+		}
+	}
+}
+
+func TestFromMessageErrors(t *testing.T) {
+	// Messages without the attributes aren't events.
+	_, err := FromMessage(client.Message{Data: client.MessageData{"name": "my-object"}})
+	if err == nil {
+		t.Error("Expected an error for a message that isn't an event")
+	}
+
+	// Events without required attributes aren't valid.
+	_, err = FromMessage(client.Message{
+		Header: map[string]string{"ce-specversion": "1.0", "ce-id": "my-id"},
+	})
+	if err == nil {
+		t.Error("Expected an error for an event without source and type")
+	}
+
+	// Errors of the messages are delivered to the handler.
+	errTest := errors.New("Test error")
+	var received error
+	Callback(func(e event.Event, destination string, err error) error {
+		received = err
+		return nil
+	})(client.Message{Err: errTest}, "my-destination")
+	if received != errTest {
+		t.Errorf("Expected the error of the message, got %v", received)
+	}
+}
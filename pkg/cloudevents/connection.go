@@ -0,0 +1,72 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudevents
+
+import (
+	"github.com/cloudevents/sdk-go/v2/event"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// Handler is the type of the functions that receive the events of a subscription. Messages that
+// can't be received, or that don't contain valid events, are delivered with the error in err.
+//
+// For example:
+//
+//	func handler(e event.Event, destination string, err error) error {
+//		if err != nil {
+//			glog.Errorf("Received error from destination '%s': %s", destination, err.Error())
+//			return err
+//		}
+//		glog.Infof("Received event '%s' of type '%s'", e.ID(), e.Type())
+//		return nil
+//	}
+type Handler func(e event.Event, destination string, err error) error
+
+// Publish sends an event to a destination, using the given content mode.
+//
+// For example:
+//
+//	err = cloudevents.Publish(c, e, "/topic/events", cloudevents.Structured)
+func Publish(c client.Connection, e event.Event, destination string, mode Mode) (err error) {
+	m, err := ToMessage(e, mode)
+	if err != nil {
+		return
+	}
+	err = c.Publish(m, destination)
+	return
+}
+
+// Subscribe creates a subscription that delivers the events received from a destination, in
+// any content mode, to a handler.
+func Subscribe(c client.Connection, destination string, handler Handler) error {
+	return c.Subscribe(destination, Callback(handler))
+}
+
+// Callback returns a subscription callback that converts the received messages into events and
+// delivers them to a handler. It can be used to receive events with the additional options of
+// SubscribeWithSpec.
+func Callback(handler Handler) client.SubscriptionCallback {
+	// In binary mode the data of the event doesn't need to be a JSON object:
+	return client.TolerateDecodeErrors(func(m client.Message, destination string) error {
+		if m.Err != nil {
+			return handler(event.Event{}, destination, m.Err)
+		}
+		e, err := FromMessage(m)
+		return handler(e, destination, err)
+	})
+}
@@ -0,0 +1,208 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package compression contains the algorithms used to compress the bodies of messages.
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressor compresses and decompresses the bodies of messages.
+type Compressor interface {
+	// Encoding returns the name of the algorithm, sent in the content-encoding header of the
+	// messages.
+	Encoding() string
+
+	// Compress compresses a body.
+	Compress(body []byte) ([]byte, error)
+
+	// Decompress decompresses a body compressed with the same algorithm. If the decompressed
+	// body is larger than the limit, in bytes, it fails with ErrTooLarge. A limit of zero or
+	// less means no limit.
+	Decompress(body []byte, limit int) ([]byte, error)
+}
+
+// ErrTooLarge is the error returned when a decompressed body is larger than the limit.
+var ErrTooLarge = errors.New("Decompressed body exceeds the size limit")
+
+// Compressors supported by the library.
+var (
+	// Identity doesn't compress. Use it to disable the compression of a message when the
+	// connection compresses by default.
+	Identity Compressor = identity{}
+
+	// Gzip compresses with the gzip algorithm, like HTTP.
+	Gzip Compressor = gzipCompressor{}
+
+	// Zstd compresses with the Zstandard algorithm.
+	Zstd Compressor = &zstdCompressor{}
+
+	// Snappy compresses with the Snappy algorithm, faster but with less compression.
+	Snappy Compressor = snappyCompressor{}
+)
+
+// compressors are the supported compressors, indexed by encoding.
+var compressors = map[string]Compressor{
+	Identity.Encoding(): Identity,
+	Gzip.Encoding():     Gzip,
+	Zstd.Encoding():     Zstd,
+	Snappy.Encoding():   Snappy,
+}
+
+// Lookup returns the compressor of an encoding.
+func Lookup(encoding string) (compressor Compressor, ok bool) {
+	compressor, ok = compressors[encoding]
+	return
+}
+
+// identity is the compressor that doesn't compress.
+type identity struct{}
+
+func (identity) Encoding() string {
+	return "identity"
+}
+
+func (identity) Compress(body []byte) ([]byte, error) {
+	return body, nil
+}
+
+func (identity) Decompress(body []byte, limit int) ([]byte, error) {
+	return body, nil
+}
+
+// gzipCompressor compresses with the gzip algorithm.
+type gzipCompressor struct{}
+
+func (gzipCompressor) Encoding() string {
+	return "gzip"
+}
+
+func (gzipCompressor) Compress(body []byte) (result []byte, err error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	_, err = writer.Write(body)
+	if err != nil {
+		return
+	}
+	err = writer.Close()
+	if err != nil {
+		return
+	}
+	result = buffer.Bytes()
+	return
+}
+
+func (gzipCompressor) Decompress(body []byte, limit int) (result []byte, err error) {
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	defer reader.Close()
+	result, err = readLimited(reader, limit)
+	return
+}
+
+// zstdCompressor compresses with the Zstandard algorithm. The encoder is created the first time
+// it is used, and shared by all the messages. Decoders are created for each message, so that they
+// are limited by the size limit of the message.
+type zstdCompressor struct {
+	once    sync.Once
+	encoder *zstd.Encoder
+	err     error
+}
+
+func (z *zstdCompressor) Encoding() string {
+	return "zstd"
+}
+
+func (z *zstdCompressor) init() error {
+	z.once.Do(func() {
+		z.encoder, z.err = zstd.NewWriter(nil)
+	})
+	return z.err
+}
+
+func (z *zstdCompressor) Compress(body []byte) (result []byte, err error) {
+	err = z.init()
+	if err != nil {
+		return
+	}
+	result = z.encoder.EncodeAll(body, nil)
+	return
+}
+
+func (z *zstdCompressor) Decompress(body []byte, limit int) (result []byte, err error) {
+	options := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+	if limit > 0 {
+		options = append(options, zstd.WithDecoderMaxMemory(uint64(limit)))
+	}
+	decoder, err := zstd.NewReader(bytes.NewReader(body), options...)
+	if err != nil {
+		return
+	}
+	defer decoder.Close()
+	result, err = readLimited(decoder, limit)
+	if err == zstd.ErrDecoderSizeExceeded || err == zstd.ErrWindowSizeExceeded {
+		err = ErrTooLarge
+	}
+	return
+}
+
+// snappyCompressor compresses with the Snappy block format.
+type snappyCompressor struct{}
+
+func (snappyCompressor) Encoding() string {
+	return "snappy"
+}
+
+func (snappyCompressor) Compress(body []byte) ([]byte, error) {
+	return snappy.Encode(nil, body), nil
+}
+
+func (snappyCompressor) Decompress(body []byte, limit int) ([]byte, error) {
+	// The length of the decompressed body is written at the beginning of the compressed one:
+	length, err := snappy.DecodedLen(body)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && length > limit {
+		return nil, ErrTooLarge
+	}
+	return snappy.Decode(nil, body)
+}
+
+// readLimited reads all the data of a reader, failing with ErrTooLarge if it is larger than the
+// limit. A limit of zero or less means no limit.
+func readLimited(reader io.Reader, limit int) (result []byte, err error) {
+	if limit <= 0 {
+		return ioutil.ReadAll(reader)
+	}
+	result, err = ioutil.ReadAll(io.LimitReader(reader, int64(limit)+1))
+	if err == nil && len(result) > limit {
+		result = nil
+		err = ErrTooLarge
+	}
+	return
+}
@@ -0,0 +1,82 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package compression
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	body := bytes.Repeat([]byte(`{"kind": "Inventory", "items": [1, 2, 3]}`), 1000)
+	for _, compressor := range []Compressor{Identity, Gzip, Zstd, Snappy} {
+		compressed, err := compressor.Compress(body)
+		if err != nil {
+			t.Fatalf("Can't compress with '%s': %s", compressor.Encoding(), err.Error())
+		}
+		if compressor != Identity && len(compressed) >= len(body) {
+			t.Errorf("Compression with '%s' didn't reduce the size", compressor.Encoding())
+		}
+		decompressed, err := compressor.Decompress(compressed, len(body))
+		if err != nil {
+			t.Fatalf("Can't decompress with '%s': %s", compressor.Encoding(), err.Error())
+		}
+		if !bytes.Equal(decompressed, body) {
+			t.Errorf("Decompression with '%s' returned a different body", compressor.Encoding())
+		}
+
+		found, ok := Lookup(compressor.Encoding())
+		if !ok || found != compressor {
+			t.Errorf("Can't find compressor '%s'", compressor.Encoding())
+		}
+	}
+
+	// Corrupted bodies are rejected.
+	for _, compressor := range []Compressor{Gzip, Zstd, Snappy} {
+		_, err := compressor.Decompress([]byte("not compressed"), 0)
+		if err == nil {
+			t.Errorf("Expected an error decompressing with '%s'", compressor.Encoding())
+		}
+	}
+
+	// Unknown encodings aren't found.
+	_, ok := Lookup("brotli")
+	if ok {
+		t.Error("Expected unknown encoding")
+	}
+}
+
+func TestLimit(t *testing.T) {
+	// A small body that decompresses into a large one is rejected.
+	body := bytes.Repeat([]byte{0}, 10*1024*1024)
+	for _, compressor := range []Compressor{Gzip, Zstd, Snappy} {
+		compressed, err := compressor.Compress(body)
+		if err != nil {
+			t.Fatalf("Can't compress with '%s': %s", compressor.Encoding(), err.Error())
+		}
+		_, err = compressor.Decompress(compressed, len(body)-1)
+		if err != ErrTooLarge {
+			t.Errorf("Expected ErrTooLarge with '%s', got %v", compressor.Encoding(), err)
+		}
+
+		// Without a limit the body is decompressed.
+		decompressed, err := compressor.Decompress(compressed, 0)
+		if err != nil || len(decompressed) != len(body) {
+			t.Errorf("Can't decompress without limit with '%s': %v", compressor.Encoding(), err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// PublishBatch sends a batch of messages to a destination without waiting for each message to
+// be sent before sending the next one.
+func (c *Connection) PublishBatch(messages []client.Message, destination string) (err error) {
+	err = c.PublishBatchWithSpec(client.BatchSpec{
+		Destination: destination,
+		Messages:    messages,
+	})
+	return
+}
+
+// PublishBatchWithSpec sends a batch of messages, like PublishBatch, with the additional
+// options of the specification.
+//
+// The SEND frames are written to the connection one after the other, and when a receipt is
+// requested it is requested with an empty transaction that follows them, so that the broker
+// confirms all the messages at once.
+func (c *Connection) PublishBatchWithSpec(spec client.BatchSpec) (err error) {
+	// Sanity check connection.
+	if c.connection == nil {
+		err = fmt.Errorf("Connection is closed")
+		return
+	}
+
+	c.publishes.begin()
+	defer c.publishes.end()
+
+	// Send the messages, through the rate limit and the middleware like Publish:
+	destination := spec.Destination
+	errs := make([]error, len(spec.Messages))
+	for i, m := range spec.Messages {
+		ctx := m.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		errs[i] = c.throttle(ctx, c.publishLimiters[destination], destination)
+		if errs[i] == nil {
+			errs[i] = c.publishHandler(m, destination)
+		}
+	}
+
+	// Wait for the broker to confirm the messages that were sent:
+	if spec.WaitReceipt {
+		receiptErr := c.confirm()
+		if receiptErr != nil {
+			for i := range errs {
+				if errs[i] == nil {
+					errs[i] = fmt.Errorf("Broker didn't confirm the batch: %s", receiptErr.Error())
+				}
+			}
+		}
+	}
+
+	// Report the messages that failed:
+	for _, e := range errs {
+		if e != nil {
+			err = &client.BatchError{Errors: errs}
+			break
+		}
+	}
+	return
+}
+
+// confirm waits till the broker processes the frames already sent, using an empty transaction
+// that requests a receipt when it is aborted.
+func (c *Connection) confirm() (err error) {
+	tx, err := c.connection.BeginWithError()
+	if err != nil {
+		return
+	}
+	err = tx.AbortWithReceipt()
+	return
+}
@@ -0,0 +1,97 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+func TestPublishBatch(t *testing.T) {
+	// Get a unique destination for the test.
+	destination, _ := DestinationName()
+
+	// Create a connection that rejects the messages with odd values.
+	c, err := NewConnection(&client.ConnectionSpec{
+		PublishMiddleware: []client.PublishMiddleware{
+			func(next client.PublishHandler) client.PublishHandler {
+				return func(m client.Message, destination string) error {
+					value := m.Data["value"].(int)
+					if value%2 != 0 {
+						return fmt.Errorf("Value %d is odd", value)
+					}
+					return next(m, destination)
+				}
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+
+	ch := make(chan float64, 1000)
+	err = c.Subscribe(destination, callbackFactory(ch))
+	if err != nil {
+		t.Fatalf("Fail to subscribe: %s", err.Error())
+	}
+
+	// Wait till the subscription reaches the server.
+	time.Sleep(100 * time.Millisecond)
+
+	// Send a batch that contains some messages that fail.
+	messages := make([]client.Message, 1000)
+	for i := range messages {
+		messages[i] = client.Message{
+			Data: client.MessageData{"value": i},
+		}
+	}
+	err = c.PublishBatchWithSpec(client.BatchSpec{
+		Destination: destination,
+		Messages:    messages,
+		WaitReceipt: true,
+	})
+	batchErr, ok := err.(*client.BatchError)
+	if !ok {
+		t.Fatalf("Expected a batch error, got %v", err)
+	}
+	failed := batchErr.Failed()
+	if len(failed) != 500 || failed[0] != 1 || failed[499] != 999 {
+		t.Errorf("Unexpected failed messages: %v", failed)
+	}
+
+	// The messages that didn't fail are received in order.
+	for i := 0; i < 1000; i += 2 {
+		select {
+		case value := <-ch:
+			if int(value) != i {
+				t.Fatalf("Received %v expected %d", value, i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the messages")
+		}
+	}
+
+	// A batch without failures doesn't return an error.
+	err = c.PublishBatch(messages[:1], destination)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+}
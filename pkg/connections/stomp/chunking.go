@@ -0,0 +1,271 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-stomp/stomp"
+	"github.com/go-stomp/stomp/frame"
+	"github.com/segmentio/ksuid"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// Defaults of the reassembly of chunks.
+const (
+	defaultChunkTimeout   = time.Minute
+	defaultChunkMaxMemory = 64 * 1024 * 1024
+)
+
+// messageGroupHeader is the header that ActiveMQ and ActiveMQ Artemis use to deliver the
+// messages of a group to the same consumer, so that all the chunks of a message sent to a queue
+// reach the same consumer.
+const messageGroupHeader = "JMSXGroupID"
+
+// sendChunks sends a body to the messaging server, like send, splitting it into chunks if it is
+// larger than the chunk size of the connection.
+func (c *Connection) sendChunks(contentType string, body []byte, destination string,
+	options ...func(*frame.Frame) error) (err error) {
+	size := c.chunking.Size
+	if size <= 0 || len(body) <= size {
+		err = c.send(contentType, body, destination, options...)
+		return
+	}
+
+	group := ksuid.New().String()
+	total := (len(body) + size - 1) / size
+	for i := 0; i < total; i++ {
+		end := (i + 1) * size
+		if end > len(body) {
+			end = len(body)
+		}
+
+		// The headers of the chunk take precedence over the headers of the message, except
+		// the message group, which the caller may have chosen:
+		chunkOptions := []func(*frame.Frame) error{
+			sendHeader(client.ChunkGroupHeader, group),
+			sendHeader(client.ChunkSequenceHeader, strconv.Itoa(i+1)),
+			sendHeader(client.ChunkTotalHeader, strconv.Itoa(total)),
+		}
+		chunkOptions = append(chunkOptions, options...)
+		chunkOptions = append(chunkOptions, sendHeader(messageGroupHeader, group))
+
+		err = c.send(contentType, body[i*size:end], destination, chunkOptions...)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// reassemble collects the chunks of messages. It returns the complete message when the given
+// message is the last missing chunk, or the given message when it isn't a chunk, together with
+// the frames that should be acknowledged once the message is handled: all its chunks, so that
+// the broker sends them again if the message isn't handled. It returns nil while more chunks
+// are needed. Invalid chunks, and the chunks of the incomplete messages that are discarded, are
+// acknowledged immediately, as they will never be delivered.
+func (c *Connection) reassemble(message *stomp.Message, destination string,
+	flow client.FlowControl) (complete *stomp.Message, parts []*stomp.Message) {
+	if message.Err != nil || message.Header == nil {
+		return message, []*stomp.Message{message}
+	}
+	if _, ok := message.Header.Contains(client.ChunkGroupHeader); !ok {
+		return message, []*stomp.Message{message}
+	}
+
+	complete, parts, discarded, err := c.chunks.add(message, time.Now())
+	for _, group := range discarded {
+		c.logger.Warn(
+			"Discarding incomplete chunked message",
+			client.DestinationField, destination,
+			"group", group.id,
+		)
+		c.acknowledge(group.messages, destination, flow, "")
+	}
+	if err != nil {
+		c.logger.Warn(
+			"Discarding invalid chunk",
+			client.DestinationField, destination,
+			client.MessageIDField, message.Header.Get(frame.MessageId),
+			"error", err,
+		)
+		c.acknowledge([]*stomp.Message{message}, destination, flow, "")
+	}
+	return
+}
+
+// assembler keeps the chunks of the messages that aren't complete yet.
+type assembler struct {
+	mutex     sync.Mutex
+	timeout   time.Duration
+	maxMemory int
+	memory    int
+	groups    map[string]*chunkGroup
+}
+
+// chunkGroup contains the chunks received for a message, indexed by sequence. The chunks are
+// kept in a map, so that the memory used is proportional to the chunks received and not to the
+// total announced by the sender.
+type chunkGroup struct {
+	id       string
+	chunks   map[int][]byte
+	messages []*stomp.Message
+	total    int
+	missing  int
+	size     int
+	started  time.Time
+}
+
+// newAssembler creates an assembler with the limits of the given specification.
+func newAssembler(spec client.ChunkingSpec) *assembler {
+	a := &assembler{
+		timeout:   spec.Timeout,
+		maxMemory: spec.MaxMemory,
+		groups:    make(map[string]*chunkGroup),
+	}
+	if a.timeout <= 0 {
+		a.timeout = defaultChunkTimeout
+	}
+	if a.maxMemory <= 0 {
+		a.maxMemory = defaultChunkMaxMemory
+	}
+	return a
+}
+
+// add adds a chunk. It returns the complete message and the frames of all its chunks if this was
+// the last missing chunk, and the incomplete groups discarded because they timed out or because
+// they exceeded the memory limit.
+func (a *assembler) add(message *stomp.Message, now time.Time) (complete *stomp.Message,
+	parts []*stomp.Message, discarded []*chunkGroup, err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// Discard the groups that timed out:
+	for _, g := range a.groups {
+		if now.Sub(g.started) > a.timeout {
+			a.drop(g)
+			discarded = append(discarded, g)
+		}
+	}
+
+	// Check the headers of the chunk:
+	id := message.Header.Get(client.ChunkGroupHeader)
+	sequence, err := strconv.Atoi(message.Header.Get(client.ChunkSequenceHeader))
+	if err != nil {
+		err = fmt.Errorf("Invalid chunk sequence: %s", err.Error())
+		return
+	}
+	total, err := strconv.Atoi(message.Header.Get(client.ChunkTotalHeader))
+	if err != nil {
+		err = fmt.Errorf("Invalid chunk total: %s", err.Error())
+		return
+	}
+	if total < 1 || sequence < 1 || sequence > total {
+		err = fmt.Errorf("Chunk %d of %d is out of range", sequence, total)
+		return
+	}
+
+	// Reject the messages that can't fit in memory. Every chunk has at least one byte, and
+	// all the chunks but the last have the same size:
+	if total > a.maxMemory || (sequence < total && (total-1)*len(message.Body) > a.maxMemory) {
+		err = fmt.Errorf(
+			"Message of %d chunks of %d bytes exceeds the memory limit of %d bytes",
+			total, len(message.Body), a.maxMemory,
+		)
+		return
+	}
+
+	// Find the group, or start a new one:
+	g, ok := a.groups[id]
+	if !ok {
+		g = &chunkGroup{
+			id:      id,
+			chunks:  make(map[int][]byte),
+			total:   total,
+			missing: total,
+			started: now,
+		}
+		a.groups[id] = g
+	}
+	if g.total != total {
+		err = fmt.Errorf("Chunk total %d doesn't match the total %d of the group", total, g.total)
+		return
+	}
+
+	// Ignore the bodies of the chunks delivered again, but acknowledge them with the group:
+	g.messages = append(g.messages, message)
+	if _, ok := g.chunks[sequence]; ok {
+		return
+	}
+	g.chunks[sequence] = message.Body
+	g.missing--
+	g.size += len(message.Body)
+	a.memory += len(message.Body)
+
+	// Deliver the message when all the chunks are received:
+	if g.missing == 0 {
+		a.drop(g)
+		complete = assemble(message, g)
+		parts = g.messages
+		return
+	}
+
+	// Discard the oldest groups while the memory limit is exceeded:
+	for a.memory > a.maxMemory {
+		oldest := g
+		for _, other := range a.groups {
+			if other.started.Before(oldest.started) {
+				oldest = other
+			}
+		}
+		a.drop(oldest)
+		discarded = append(discarded, oldest)
+		if oldest == g {
+			break
+		}
+	}
+	return
+}
+
+// drop removes a group.
+func (a *assembler) drop(g *chunkGroup) {
+	delete(a.groups, g.id)
+	a.memory -= g.size
+}
+
+// assemble creates the complete message of a group, using the headers of the last chunk
+// received.
+func assemble(last *stomp.Message, g *chunkGroup) *stomp.Message {
+	complete := *last
+	complete.Body = make([]byte, 0, g.size)
+	for sequence := 1; sequence <= g.total; sequence++ {
+		complete.Body = append(complete.Body, g.chunks[sequence]...)
+	}
+	complete.Header = last.Header.Clone()
+	complete.Header.Del(client.ChunkGroupHeader)
+	complete.Header.Del(client.ChunkSequenceHeader)
+	complete.Header.Del(client.ChunkTotalHeader)
+	if complete.Header.Get(messageGroupHeader) == g.id {
+		complete.Header.Del(messageGroupHeader)
+	}
+	complete.Header.Set(frame.ContentLength, strconv.Itoa(len(complete.Body)))
+	return &complete
+}
@@ -0,0 +1,267 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-stomp/stomp"
+	"github.com/go-stomp/stomp/frame"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// chunk creates a message that contains a chunk.
+func chunk(group string, sequence, total string, body string) *stomp.Message {
+	return &stomp.Message{
+		Header: frame.NewHeader(
+			client.ChunkGroupHeader, group,
+			client.ChunkSequenceHeader, sequence,
+			client.ChunkTotalHeader, total,
+		),
+		Body: []byte(body),
+	}
+}
+
+func TestAssembler(t *testing.T) {
+	now := time.Now()
+	a := newAssembler(client.ChunkingSpec{
+		Timeout:   time.Minute,
+		MaxMemory: 10,
+	})
+
+	// Chunks are reassembled in order even if they arrive out of order, and chunks received
+	// twice are ignored.
+	for _, c := range []*stomp.Message{
+		chunk("a", "2", "3", "bb"),
+		chunk("a", "1", "3", "aa"),
+		chunk("a", "2", "3", "bb"),
+	} {
+		complete, _, _, err := a.add(c, now)
+		if err != nil || complete != nil {
+			t.Fatalf("Unexpected result adding chunk: %v %v", complete, err)
+		}
+	}
+	complete, parts, _, err := a.add(chunk("a", "3", "3", "c"), now)
+	if err != nil || complete == nil {
+		t.Fatalf("Expected complete message, got %v", err)
+	}
+	if len(parts) != 4 {
+		t.Errorf("Expected the 4 chunks received to be acknowledged, got %d", len(parts))
+	}
+	if string(complete.Body) != "aabbc" {
+		t.Errorf("Received body '%s' expected 'aabbc'", complete.Body)
+	}
+	if _, ok := complete.Header.Contains(client.ChunkGroupHeader); ok {
+		t.Error("Expected the chunk headers to be removed")
+	}
+	if a.memory != 0 || len(a.groups) != 0 {
+		t.Errorf("Expected no memory used, got %d bytes", a.memory)
+	}
+
+	// Incomplete groups are discarded after the timeout.
+	a.add(chunk("b", "1", "2", "b"), now)
+	_, _, discarded, _ := a.add(chunk("c", "1", "2", "c"), now.Add(2*time.Minute))
+	if len(discarded) != 1 || discarded[0].id != "b" || len(discarded[0].messages) != 1 {
+		t.Errorf("Expected group 'b' to be discarded, got %v", discarded)
+	}
+
+	// The oldest groups are discarded when the memory limit is exceeded.
+	_, _, discarded, _ = a.add(chunk("d", "1", "2", "dddddddddd"), now.Add(3*time.Minute))
+	if len(discarded) != 1 || discarded[0].id != "c" {
+		t.Errorf("Expected group 'c' to be discarded, got %v", discarded)
+	}
+
+	// Invalid chunks are rejected.
+	for _, c := range []*stomp.Message{
+		chunk("e", "x", "2", "e"),
+		chunk("e", "1", "x", "e"),
+		chunk("e", "3", "2", "e"),
+		chunk("d", "2", "5", "d"),
+		chunk("f", "1", "1125899906842624", "f"),
+		chunk("f", "1", "11", ""),
+		chunk("f", "1", "3", "ffffff"),
+	} {
+		_, _, _, err = a.add(c, now.Add(3*time.Minute))
+		if err == nil {
+			t.Errorf("Expected an error for chunk %v", c.Header)
+		}
+	}
+
+	if _, ok := a.groups["f"]; ok {
+		t.Error("Expected the chunks that exceed the memory limit to be rejected")
+	}
+
+	// The group that fits in memory can still be completed.
+	complete, _, discarded, err = a.add(chunk("d", "2", "2", "d"), now.Add(3*time.Minute))
+	if err != nil || complete == nil || len(discarded) != 0 {
+		t.Errorf("Expected group 'd' to be completed, got %v %v", discarded, err)
+	}
+}
+
+func TestChunking(t *testing.T) {
+	// Get a unique destination for the test.
+	destination, _ := DestinationName()
+
+	// Create a connection that splits the messages larger than 1000 bytes.
+	c, err := NewConnection(&client.ConnectionSpec{
+		Chunking: client.ChunkingSpec{
+			Size: 1000,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+
+	received := make(chan client.Message, 10)
+	err = c.Subscribe(destination, func(m client.Message, destination string) error {
+		received <- m
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Fail to subscribe: %s", err.Error())
+	}
+
+	// Wait till the subscription reaches the server.
+	time.Sleep(100 * time.Millisecond)
+
+	// Send a large message and a small one.
+	large := strings.Repeat("0123456789", 1000)
+	for _, value := range []string{large, "small"} {
+		err = c.Publish(client.Message{Data: client.MessageData{"value": value}}, destination)
+		if err != nil {
+			t.Fatalf("Fail to publish: %s", err.Error())
+		}
+	}
+	for _, value := range []string{large, "small"} {
+		select {
+		case m := <-received:
+			if m.Err != nil {
+				t.Fatalf("Received error: %s", m.Err.Error())
+			}
+			if m.Data["value"] != value {
+				t.Errorf("Received a value of %d bytes", len(m.Data["value"].(string)))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the message")
+		}
+	}
+
+	// Raw bodies are split too.
+	raw := bytes.Repeat([]byte{42}, 2500)
+	err = c.Publish(client.Message{Data: client.MessageData{"byteArray": raw}}, destination)
+	if err != nil {
+		t.Fatalf("Fail to publish: %s", err.Error())
+	}
+	select {
+	case m := <-received:
+		if !bytes.Equal(m.Data["byteArray"].([]byte), raw) {
+			t.Errorf("Received a different raw body")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the message")
+	}
+}
+
+func TestChunkAcknowledge(t *testing.T) {
+	// Get a unique destination for the test. Topics don't wait for the acknowledgements, so
+	// the chunks are delivered even if they aren't sent.
+	destination, _ := DestinationName()
+
+	c, err := NewConnection(&client.ConnectionSpec{
+		Chunking: client.ChunkingSpec{
+			Size: 1000,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+
+	// Record the sequences of the chunks acknowledged:
+	var mutex sync.Mutex
+	var acked []string
+	c.(*Connection).ack = func(message *stomp.Message) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		acked = append(acked, message.Header.Get(client.ChunkSequenceHeader))
+		return nil
+	}
+	count := func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(acked)
+	}
+
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	err = c.SubscribeWithSpec(client.SubscriptionSpec{
+		Destination: destination,
+		FlowControl: client.FlowControl{
+			Prefetch: 100,
+		},
+		Callback: func(m client.Message, destination string) error {
+			if m.Err != nil {
+				return nil
+			}
+			entered <- struct{}{}
+			<-release
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Fail to subscribe: %s", err.Error())
+	}
+
+	// Wait till the subscription reaches the server.
+	time.Sleep(100 * time.Millisecond)
+
+	large := strings.Repeat("0123456789", 1000)
+	err = c.Publish(client.Message{Data: client.MessageData{"value": large}}, destination)
+	if err != nil {
+		t.Fatalf("Fail to publish: %s", err.Error())
+	}
+
+	// No chunk is acknowledged while the message is handled, so the broker would send them
+	// again if the consumer fails:
+	select {
+	case <-entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the message")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := count(); n != 0 {
+		t.Errorf("Expected no chunk to be acknowledged before handling, got %d", n)
+	}
+
+	// All the chunks are acknowledged once the message is handled:
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for count() < 11 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(acked) != 11 || acked[0] != "1" || acked[10] != "11" {
+		t.Errorf("Expected the 11 chunks to be acknowledged, got %v", acked)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/segmentio/ksuid"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// storeBody stores the body of a message in a new blob, if the connection has a blob store and
+// the body is larger than the threshold, and adds the key and the digest of the blob to the
+// header. It returns the body that should be sent instead, which is empty, or the body unchanged
+// if it should be sent through the broker.
+func (c *Connection) storeBody(m client.Message, header map[string]string, body []byte) (
+	result []byte, err error) {
+	result = body
+	if c.claimCheck.Store == nil || len(body) < c.claimCheck.Threshold {
+		return
+	}
+
+	ctx := m.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	key := ksuid.New().String()
+	err = c.claimCheck.Store.Put(ctx, key, body)
+	if err != nil {
+		err = fmt.Errorf("Can't store body in blob '%s': %s", key, err.Error())
+		return
+	}
+	header[client.ClaimCheckHeader] = key
+	header[client.ClaimCheckDigestHeader] = blobDigest(body)
+	result = []byte{}
+	return
+}
+
+// claimBody fetches the body of a received message from the blob store of the connection, if
+// the message contains the key of a blob, and checks that the blob matches the digest of the
+// message. The signature of the message, which covers the key and the digest, must be verified
+// before. It returns the key of the blob, so that the blob can be released once the message is
+// handled and acknowledged, see releaseBody.
+func (c *Connection) claimBody(header map[string]string, body []byte) (result []byte, key string,
+	err error) {
+	result = body
+	key, ok := header[client.ClaimCheckHeader]
+	if !ok {
+		return
+	}
+	store := c.claimCheck.Store
+	if store == nil {
+		err = fmt.Errorf("Can't fetch blob '%s', the connection has no blob store", key)
+		return
+	}
+
+	ctx := context.Background()
+	result, err = store.Get(ctx, key)
+	if err != nil {
+		err = fmt.Errorf("Can't fetch blob '%s': %s", key, err.Error())
+		return
+	}
+	if blobDigest(result) != header[client.ClaimCheckDigestHeader] {
+		err = fmt.Errorf("Blob '%s' doesn't match the digest of the message", key)
+	}
+	return
+}
+
+// releaseBody removes the blob that contains the body of a received message, if the blobs have a
+// single consumer. It is called once the message is handled and acknowledged, so that the body
+// is still available if the broker sends the message again, and only with the key returned by
+// claimBody for a message that was received successfully.
+func (c *Connection) releaseBody(key string, destination string) {
+	store := c.claimCheck.Store
+	if store == nil || !c.claimCheck.DeleteOnReceive || key == "" {
+		return
+	}
+	err := store.Delete(context.Background(), key)
+	if err != nil {
+		c.logger.Warn(
+			"Can't delete blob",
+			client.DestinationField, destination,
+			"blob", key,
+			"error", err,
+		)
+	}
+}
+
+// blobDigest returns the digest of a blob, encoded with base64.
+func blobDigest(blob []byte) string {
+	sum := sha256.Sum256(blob)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,255 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"context"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/container-mgmt/messaging-library/pkg/blobstore"
+	"github.com/container-mgmt/messaging-library/pkg/client"
+	"github.com/container-mgmt/messaging-library/pkg/envelope"
+)
+
+// countingStore is a blob store that counts the blobs fetched.
+type countingStore struct {
+	blobstore.BlobStore
+	gets int32
+}
+
+func (s *countingStore) Get(ctx context.Context, key string) ([]byte, error) {
+	atomic.AddInt32(&s.gets, 1)
+	return s.BlobStore.Get(ctx, key)
+}
+
+func TestClaimCheck(t *testing.T) {
+	// Get a unique destination for the test.
+	destination, _ := DestinationName()
+
+	// Create a store in a temporary directory.
+	dir, err := ioutil.TempDir("", "blobs")
+	if err != nil {
+		t.Fatalf("Can't create directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	store, err := blobstore.NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Can't create store: %s", err.Error())
+	}
+
+	// Create a connection that stores the bodies larger than 1000 bytes, and removes them
+	// when they are received, and a connection without store.
+	c, err := NewConnection(&client.ConnectionSpec{
+		ClaimCheck: client.ClaimCheckSpec{
+			Store:           store,
+			Threshold:       1000,
+			DeleteOnReceive: true,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+	plain, err := NewConnection(&client.ConnectionSpec{})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer plain.Close()
+
+	// The blob is kept while the message is handled.
+	received := make(chan client.Message, 10)
+	receivedPlain := make(chan client.Message, 10)
+	blobs := make(chan int, 10)
+	c.Subscribe(destination, func(m client.Message, destination string) error {
+		files, _ := ioutil.ReadDir(dir)
+		blobs <- len(files)
+		received <- m
+		return nil
+	})
+	plain.Subscribe(destination, func(m client.Message, destination string) error {
+		receivedPlain <- m
+		return nil
+	})
+
+	// Wait till the subscriptions reach the server.
+	time.Sleep(100 * time.Millisecond)
+
+	// Send a large message and a small one.
+	large := strings.Repeat("0123456789", 1000)
+	for _, value := range []string{large, "small"} {
+		err = c.Publish(client.Message{Data: client.MessageData{"value": value}}, destination)
+		if err != nil {
+			t.Fatalf("Fail to publish: %s", err.Error())
+		}
+	}
+
+	// The connection with the store receives both, the one without store can only receive the
+	// small one.
+	for _, value := range []string{large, "small"} {
+		select {
+		case m := <-received:
+			if m.Err != nil {
+				t.Fatalf("Received error: %s", m.Err.Error())
+			}
+			if m.Data["value"] != value {
+				t.Errorf("Received a value of %d bytes", len(m.Data["value"].(string)))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the message")
+		}
+	}
+	for _, value := range []string{"", "small"} {
+		select {
+		case m := <-receivedPlain:
+			if value == "" && m.Err == nil {
+				t.Error("Expected an error receiving a claim check without store")
+			}
+			if value != "" && m.Data["value"] != value {
+				t.Errorf("Received '%v' expected '%s'", m.Data["value"], value)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the message")
+		}
+	}
+
+	if count := <-blobs; count != 1 {
+		t.Errorf("Expected the blob to exist while the message is handled, found %d", count)
+	}
+
+	// The blob is removed once the message was handled.
+	deadline := time.Now().Add(time.Second)
+	files, _ := ioutil.ReadDir(dir)
+	for len(files) != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		files, _ = ioutil.ReadDir(dir)
+	}
+	if len(files) != 0 {
+		t.Errorf("Expected the blobs to be removed, found %d", len(files))
+	}
+}
+
+func TestForgedClaimCheck(t *testing.T) {
+	// Get unique destinations for the test.
+	signed, _ := DestinationName()
+	unsigned, _ := DestinationName()
+
+	// Create a store with the blob of another message.
+	dir, err := ioutil.TempDir("", "blobs")
+	if err != nil {
+		t.Fatalf("Can't create directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	files, err := blobstore.NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Can't create store: %s", err.Error())
+	}
+	files.Put(context.Background(), "victim", []byte("{}"))
+
+	// Create a receiver that verifies signatures, one that doesn't, and an intruder that
+	// knows the contents of the blob.
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	store := &countingStore{BlobStore: files}
+	receiver, err := NewConnection(&client.ConnectionSpec{
+		Envelope: client.EnvelopeSpec{
+			Keys: &envelope.StaticKeys{
+				SigningKeyID: "s1",
+				SigningKeys:  map[string][]byte{"s1": secret},
+			},
+			Signing: envelope.HMACSHA256,
+		},
+		ClaimCheck: client.ClaimCheckSpec{
+			Store:           store,
+			DeleteOnReceive: true,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer receiver.Close()
+	plain, err := NewConnection(&client.ConnectionSpec{
+		ClaimCheck: client.ClaimCheckSpec{
+			Store:           files,
+			DeleteOnReceive: true,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer plain.Close()
+	intruder, err := NewConnection(&client.ConnectionSpec{})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer intruder.Close()
+
+	received := make(chan client.Message, 10)
+	callback := func(m client.Message, destination string) error {
+		received <- m
+		return nil
+	}
+	receiver.Subscribe(signed, callback)
+	plain.Subscribe(unsigned, callback)
+
+	// Wait till the subscriptions reach the server.
+	time.Sleep(100 * time.Millisecond)
+
+	// The receiver that verifies signatures rejects the message before fetching the blob, and
+	// the other one rejects it because the digest doesn't match:
+	for destination, digest := range map[string]string{
+		signed:   blobDigest([]byte("{}")),
+		unsigned: blobDigest([]byte("forged")),
+	} {
+		err = intruder.Publish(
+			client.Message{
+				Header: map[string]string{
+					client.ClaimCheckHeader:       "victim",
+					client.ClaimCheckDigestHeader: digest,
+				},
+				Data: client.MessageData{},
+			},
+			destination,
+		)
+		if err != nil {
+			t.Fatalf("Fail to publish: %s", err.Error())
+		}
+		select {
+		case m := <-received:
+			if m.Err == nil {
+				t.Errorf("Expected an error receiving a forged claim check from '%s'", destination)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the message")
+		}
+	}
+	if gets := atomic.LoadInt32(&store.gets); gets != 0 {
+		t.Errorf("Expected no blob to be fetched before verifying, got %d", gets)
+	}
+
+	// The blob of the other message is kept:
+	time.Sleep(100 * time.Millisecond)
+	_, err = files.Get(context.Background(), "victim")
+	if err != nil {
+		t.Errorf("Expected the blob to be kept: %s", err.Error())
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"fmt"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+	"github.com/container-mgmt/messaging-library/pkg/compression"
+)
+
+// compress compresses the body of a message, with the algorithm of the message or of the
+// connection, if it is larger than the threshold of the connection. It returns the encoding
+// that should be sent in the content-encoding header, or an empty string if the body wasn't
+// compressed.
+func (c *Connection) compress(m client.Message, body []byte) (result []byte, encoding string,
+	err error) {
+	result = body
+	compressor := m.Compression
+	if compressor == nil {
+		compressor = c.compression.Compressor
+	}
+	if compressor == nil || compressor == compression.Identity {
+		return
+	}
+	if len(body) < c.compression.Threshold {
+		return
+	}
+	result, err = compressor.Compress(body)
+	if err != nil {
+		return
+	}
+	encoding = compressor.Encoding()
+	return
+}
+
+// defaultMaxDecompressedSize is the default maximum size of decompressed bodies.
+const defaultMaxDecompressedSize = 64 * 1024 * 1024
+
+// decompress decompresses the body of a received message, using the algorithm of its
+// content-encoding header, and removes the header. It fails if the decompressed body is larger
+// than the limit of the connection.
+func (c *Connection) decompress(header map[string]string, body []byte) (result []byte,
+	err error) {
+	result = body
+	encoding, ok := header[client.ContentEncodingHeader]
+	if !ok {
+		return
+	}
+	compressor, ok := compression.Lookup(encoding)
+	if !ok {
+		err = fmt.Errorf("Unsupported content encoding '%s'", encoding)
+		return
+	}
+	limit := c.compression.MaxDecompressedSize
+	if limit <= 0 {
+		limit = defaultMaxDecompressedSize
+	}
+	result, err = compressor.Decompress(body, limit)
+	if err != nil {
+		err = fmt.Errorf("Can't decompress body with encoding '%s': %s", encoding, err.Error())
+		return
+	}
+	delete(header, client.ContentEncodingHeader)
+	return
+}
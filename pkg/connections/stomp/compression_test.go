@@ -0,0 +1,182 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-stomp/stomp"
+	"github.com/go-stomp/stomp/frame"
+	"github.com/go-stomp/stomp/server"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+	"github.com/container-mgmt/messaging-library/pkg/compression"
+)
+
+func TestCompression(t *testing.T) {
+	// This test reads the raw frames from the internal server.
+	if !UseInternalServer {
+		t.Skip("skipping test when running using external server.")
+	}
+
+	// Get a unique destination for the test.
+	destination, _ := DestinationName()
+
+	// Create a connection that compresses the large messages with gzip.
+	c, err := NewConnection(&client.ConnectionSpec{
+		Compression: client.CompressionSpec{
+			Compressor: compression.Gzip,
+			Threshold:  1000,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+
+	// Receive the messages with the library, and the raw frames with a plain connection.
+	received := make(chan client.Message, 10)
+	err = c.Subscribe(destination, func(m client.Message, destination string) error {
+		received <- m
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Fail to subscribe: %s", err.Error())
+	}
+	raw, err := stomp.Dial("tcp", server.DefaultAddr)
+	if err != nil {
+		t.Fatalf("Fail to open raw connection: %s", err.Error())
+	}
+	defer raw.MustDisconnect()
+	frames, err := raw.Subscribe(destination, stomp.AckAuto)
+	if err != nil {
+		t.Fatalf("Fail to subscribe raw connection: %s", err.Error())
+	}
+
+	// Wait till the subscriptions reach the server.
+	time.Sleep(100 * time.Millisecond)
+
+	large := strings.Repeat("inventory ", 1000)
+	messages := []struct {
+		message  client.Message
+		encoding string
+	}{
+		// Small messages aren't compressed.
+		{
+			message: client.Message{Data: client.MessageData{"value": "small"}},
+		},
+		// Large messages are compressed with the algorithm of the connection.
+		{
+			message:  client.Message{Data: client.MessageData{"value": large}},
+			encoding: "gzip",
+		},
+		// The algorithm of the message overrides the one of the connection.
+		{
+			message: client.Message{
+				Data:        client.MessageData{"value": large},
+				Compression: compression.Zstd,
+			},
+			encoding: "zstd",
+		},
+		{
+			message: client.Message{
+				Data:        client.MessageData{"value": large},
+				Compression: compression.Identity,
+			},
+		},
+	}
+
+	for _, test := range messages {
+		err = c.Publish(test.message, destination)
+		if err != nil {
+			t.Fatalf("Fail to publish: %s", err.Error())
+		}
+
+		select {
+		case f := <-frames.C:
+			if f.Header.Get(client.ContentEncodingHeader) != test.encoding {
+				t.Errorf(
+					"Expected encoding '%s', got '%s'",
+					test.encoding,
+					f.Header.Get(client.ContentEncodingHeader),
+				)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the raw frame")
+		}
+
+		select {
+		case m := <-received:
+			if m.Err != nil {
+				t.Fatalf("Received error: %s", m.Err.Error())
+			}
+			if m.Data["value"] != test.message.Data["value"] {
+				t.Errorf("Received a different value")
+			}
+			if _, ok := m.Header[client.ContentEncodingHeader]; ok {
+				t.Errorf("Expected the encoding header to be removed")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the message")
+		}
+	}
+
+	// Messages with unknown encodings are reported as errors.
+	err = raw.Send(destination, "application/json", []byte("{}"),
+		stomp.SendOpt.Header(client.ContentEncodingHeader, "brotli"))
+	if err != nil {
+		t.Fatalf("Fail to send raw frame: %s", err.Error())
+	}
+	select {
+	case m := <-received:
+		if m.Err == nil {
+			t.Error("Expected an error for an unknown encoding")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the message")
+	}
+}
+
+func TestDecompressionLimit(t *testing.T) {
+	c := &Connection{
+		compression: client.CompressionSpec{
+			MaxDecompressedSize: 1000,
+		},
+	}
+
+	// Bodies that decompress into more than the limit are delivered with an error.
+	for _, size := range []int{1000, 1001} {
+		body := []byte(`"` + strings.Repeat("a", size-2) + `"`)
+		compressed, err := compression.Gzip.Compress(body)
+		if err != nil {
+			t.Fatalf("Can't compress: %s", err.Error())
+		}
+		m, _, _ := c.decodeMessage(&stomp.Message{
+			ContentType: "application/json",
+			Header:      frame.NewHeader(client.ContentEncodingHeader, "gzip"),
+			Body:        compressed,
+		})
+		if size <= 1000 && m.Err != nil {
+			t.Errorf("Unexpected error for a body of %d bytes: %s", size, m.Err.Error())
+		}
+		if size > 1000 && m.Err == nil {
+			t.Errorf("Expected an error for a body of %d bytes", size)
+		}
+	}
+}
@@ -21,14 +21,18 @@ limitations under the License.
 package stomp
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/go-stomp/stomp"
 
 	"github.com/container-mgmt/messaging-library/pkg/client"
+	"github.com/container-mgmt/messaging-library/pkg/envelope"
 )
 
 // Connection represents the logical connection between the program and the messaging system. This
@@ -39,31 +43,103 @@ import (
 // is important to reuse it as much as possible, and to close it once it is no longer needed.
 //
 // Connection is an implementation of Connection interface:
-//   https://godoc.org/github.com/container-mgmt/messaging-library/pkg/client#Connection
+//
+//	https://godoc.org/github.com/container-mgmt/messaging-library/pkg/client#Connection
 type Connection struct {
-	subscriptions map[string]*stomp.Subscription
-	connection    *stomp.Conn
+	subscriptions      map[string]*stomp.Subscription
+	subscriptionsMutex sync.Mutex
+	connection         *stomp.Conn
+
+	// indicates that shutdown started, so new subscriptions aren't accepted, and closed when it
+	// starts, so that the delivery loops finish
+	shuttingDown bool
+	stopped      chan struct{}
+
+	// track the delivery loops and the publish operations in progress
+	deliveries activity
+	publishes  activity
+
+	// cancelled when the connection is closed, or when shutdown runs out of time, so that the
+	// delivery loops stop waiting for the rate limits of the subscriptions
+	throttling       context.Context
+	cancelThrottling context.CancelFunc
+
+	// maximum time to wait for the broker to confirm operations that not all brokers confirm
+	receiptTimeout time.Duration
+
+	// sends the acknowledgements of the messages received
+	ack func(message *stomp.Message) error
+
+	// publishes messages through the publish middleware
+	publishHandler client.PublishHandler
+
+	// middleware applied to the delivered messages
+	subscriptionMiddleware []client.SubscriptionMiddleware
+
+	// receives the measurements of the connection and of its requestors
+	metrics client.Metrics
+
+	// writes the log messages of the connection and of its requestors and responders
+	logger client.Logger
+
+	// address of the broker, reported in the events
+	broker string
+
+	// receive the events of the connection, and indicates that the disconnection was reported
+	listeners      []client.EventListener
+	listenersMutex sync.Mutex
+	disconnected   bool
+
+	// socket connected to the broker, used to check that the connection is alive
+	socket *watchedSocket
+
+	// last time that a message was delivered to each subscription
+	deliveryTimes map[string]time.Time
+
+	// requestors whose pending requests are reported in the health report
+	requestors      map[*Requestor]bool
+	requestorsMutex sync.Mutex
+
+	// limit the rate of the messages published to each destination
+	publishLimiters map[string]client.Limiter
+
+	// Compression of the bodies of the published messages:
+	compression client.CompressionSpec
+
+	// Signing and encryption of the bodies of the messages, nil if disabled:
+	envelope *envelope.Envelope
+
+	// Splitting of large messages, and reassembly of the chunks received:
+	chunking client.ChunkingSpec
+	chunks   *assembler
+
+	// Storage of large bodies outside of the broker:
+	claimCheck client.ClaimCheckSpec
+
+	// Validation of the data of the messages with JSON schemas:
+	validation client.ValidationSpec
 }
 
 // NewConnection builds and initiate a new connection object.
 //
 // Example:
-//   c, err = stomp.NewConnection(&client.ConnectionSpec{
-//   	BrokerHost:   brokerHost,
-//   	BrokerPort:   brokerPort,
-//   	UserName:     userName,
-//   	UserPassword: userPassword,
-//   	UseTLS:       useTLS,
-//   	InsecureTLS:  insecureTLS,
-//   })
-//   if err != nil {
-//   	glog.Errorf(
-//   		"Can't create a new connection to host '%s': %s",
-//   		brokerHost,
-//  		err.Error(),
-//   	)
-//   	return
-//  }
+//
+//	c, err = stomp.NewConnection(&client.ConnectionSpec{
+//		BrokerHost:   brokerHost,
+//		BrokerPort:   brokerPort,
+//		UserName:     userName,
+//		UserPassword: userPassword,
+//		UseTLS:       useTLS,
+//		InsecureTLS:  insecureTLS,
+//	})
+//	if err != nil {
+//		glog.Errorf(
+//			"Can't create a new connection to host '%s': %s",
+//			brokerHost,
+//			err.Error(),
+//		)
+//		return
+//	}
 func NewConnection(spec *client.ConnectionSpec) (connection client.Connection, err error) {
 	// Init Host and port values if found zero values.
 	brokerHost := spec.BrokerHost
@@ -80,10 +156,64 @@ func NewConnection(spec *client.ConnectionSpec) (connection client.Connection, e
 
 	// Init connection subscriptions.
 	stompConnection.subscriptions = make(map[string]*stomp.Subscription, 0)
+	stompConnection.deliveryTimes = make(map[string]time.Time)
+	stompConnection.requestors = make(map[*Requestor]bool)
+	stompConnection.stopped = make(chan struct{})
+	stompConnection.throttling, stompConnection.cancelThrottling = context.WithCancel(
+		context.Background(),
+	)
+	stompConnection.receiptTimeout = defaultReceiptTimeout
+
+	// Init connection middleware.
+	stompConnection.publishHandler = client.ChainPublish(
+		stompConnection.publishMessage,
+		spec.PublishMiddleware...,
+	)
+	stompConnection.subscriptionMiddleware = spec.SubscriptionMiddleware
+	stompConnection.publishLimiters = spec.PublishLimiters
+	stompConnection.compression = spec.Compression
+
+	// Init connection claim check.
+	stompConnection.claimCheck = spec.ClaimCheck
+
+	// Init connection validation.
+	stompConnection.validation = spec.Validation
+
+	// Init connection chunking.
+	stompConnection.chunking = spec.Chunking
+	stompConnection.chunks = newAssembler(spec.Chunking)
+
+	// Init connection envelope.
+	if spec.Envelope != (client.EnvelopeSpec{}) {
+		stompConnection.envelope, err = envelope.New(
+			spec.Envelope.Keys,
+			spec.Envelope.Signing,
+			spec.Envelope.Encryption,
+		)
+		if err != nil {
+			return
+		}
+	}
+
+	// Init connection metrics.
+	stompConnection.metrics = spec.Metrics
+	if stompConnection.metrics == nil {
+		stompConnection.metrics = noMetrics{}
+	}
+
+	// Init connection logger.
+	stompConnection.logger = spec.Logger
+	if stompConnection.logger == nil {
+		stompConnection.logger = client.NopLogger{}
+	}
 
 	// Calculate the address of the server, as required by the Dial methods:
 	brokerAddress := fmt.Sprintf("%s:%d", brokerHost, brokerPort)
 
+	// Init connection event listeners.
+	stompConnection.broker = brokerAddress
+	stompConnection.listeners = spec.EventListeners
+
 	// Create the socket:
 	var socket io.ReadWriteCloser
 	if spec.UseTLS {
@@ -118,9 +248,15 @@ func NewConnection(spec *client.ConnectionSpec) (connection client.Connection, e
 	if spec.UserName != "" {
 		options = append(options, stomp.ConnOpt.Login(spec.UserName, spec.UserPassword))
 	}
+	if spec.ClientID != "" {
+		options = append(options, stomp.ConnOpt.Header(clientIDHeader, spec.ClientID))
+	}
+
+	// Watch the data received from the broker:
+	stompConnection.socket = &watchedSocket{ReadWriteCloser: socket}
 
 	// Create the STOMP connection:
-	stompConnection.connection, err = stomp.Connect(socket, options...)
+	stompConnection.connection, err = stomp.Connect(stompConnection.socket, options...)
 	if err != nil {
 		err = fmt.Errorf(
 			"can't create STOMP connection to host '%s' and port %d: %s",
@@ -130,6 +266,12 @@ func NewConnection(spec *client.ConnectionSpec) (connection client.Connection, e
 		)
 		return
 	}
+	stompConnection.ack = stompConnection.connection.Ack
+	stompConnection.metrics.Connected(brokerAddress)
+	stompConnection.fire(client.Event{Type: client.ConnectedEvent})
+
+	// Report the loss of the connection, also when there are no subscriptions:
+	stompConnection.socket.watch(stompConnection.connectionLost)
 
 	// Return the created connection object:
 	connection = stompConnection
@@ -146,5 +288,16 @@ func (c *Connection) Close() (err error) {
 		return
 	}
 
-	return c.connection.Disconnect()
+	// Don't wait for the broker to confirm the disconnection if the connection was lost:
+	c.cancelThrottling()
+	report := c.markDisconnected()
+	if c.socket.failed.Load() {
+		c.connection.MustDisconnect()
+	} else {
+		err = c.connection.Disconnect()
+	}
+	if report {
+		c.fire(client.Event{Type: client.DisconnectedEvent})
+	}
+	return
 }
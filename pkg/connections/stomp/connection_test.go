@@ -17,15 +17,19 @@ limitations under the License.
 package stomp
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/go-stomp/stomp/frame"
 	"github.com/go-stomp/stomp/server"
 
 	"github.com/container-mgmt/messaging-library/pkg/client"
@@ -49,11 +53,12 @@ func DestinationName() (string, error) {
 // ListenAndServe open a STOMP testing server on address 127.0.0.1:61613.
 func ListenAndServe(serverStarted chan bool) {
 	s := &server.Server{}
-	serverStarted <- true
 
 	fmt.Println("Starting a new STOMP testing server.")
 
-	err := s.ListenAndServe()
+	// Listen before reporting that the server started, so that the tests don't try to connect
+	// before the server is ready.
+	l, err := net.Listen("tcp", server.DefaultAddr)
 	if err != nil {
 		fmt.Printf("Failed to open new STOMP testing server: %s\n", err.Error())
 
@@ -61,7 +66,12 @@ func ListenAndServe(serverStarted chan bool) {
 		// we have an extrenal one running.
 		fmt.Println("Continue, falling back to external server.")
 		UseInternalServer = false
+		serverStarted <- true
+		return
 	}
+	serverStarted <- true
+
+	s.Serve(l)
 }
 
 // Callback for subscribe testing.
@@ -175,6 +185,99 @@ func TestPublishSubscribe(t *testing.T) {
 	}
 }
 
+func TestMiddleware(t *testing.T) {
+	// Get a unique destination for the test.
+	destination, _ := DestinationName()
+	messageRecieved := make(chan string, 1)
+
+	// Create a connection that adds a tenant header to the messages it publishes, and that
+	// rejects deliveries without it.
+	c, err := NewConnection(&client.ConnectionSpec{
+		PublishMiddleware: []client.PublishMiddleware{
+			func(next client.PublishHandler) client.PublishHandler {
+				return func(m client.Message, destination string) error {
+					m.Header = map[string]string{"tenant": "my-tenant"}
+					return next(m, destination)
+				}
+			},
+		},
+		SubscriptionMiddleware: []client.SubscriptionMiddleware{
+			func(next client.SubscriptionCallback) client.SubscriptionCallback {
+				return func(m client.Message, destination string) error {
+					if m.Err == nil && m.Header["tenant"] == "" {
+						t.Error("Received message without tenant header")
+						return nil
+					}
+					return next(m, destination)
+				}
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+
+	c.Subscribe(destination, func(m client.Message, destination string) error {
+		messageRecieved <- m.Header["tenant"]
+		return nil
+	})
+	c.Publish(client.Message{Data: client.MessageData{"value": 42.0}}, destination)
+
+	select {
+	case tenant := <-messageRecieved:
+		if tenant != "my-tenant" {
+			t.Errorf("Received tenant '%s' expected 'my-tenant'", tenant)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for message")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	var finished int32
+
+	// Get a unique destination for the test.
+	destination, _ := DestinationName()
+	handlerStarted := make(chan bool, 1)
+
+	// Create and open a connection.
+	c, err := NewConnection(&client.ConnectionSpec{})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+
+	// Subscribe with a slow callback.
+	c.Subscribe(destination, func(m client.Message, destination string) error {
+		if m.Err != nil {
+			return nil
+		}
+		handlerStarted <- true
+		time.Sleep(200 * time.Millisecond)
+		atomic.StoreInt32(&finished, 1)
+		return nil
+	})
+	c.Publish(client.Message{Data: client.MessageData{"value": 42.0}}, destination)
+
+	select {
+	case <-handlerStarted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for message")
+	}
+
+	// Shutdown doesn't wait for the broker to confirm the unsubscriptions, which the internal
+	// server never does.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = c.Shutdown(ctx)
+	if err != nil {
+		t.Errorf("Shutdown exited with an error: %s", err.Error())
+	}
+	if atomic.LoadInt32(&finished) == 0 {
+		t.Error("Shutdown returned before the message was handled")
+	}
+}
+
 func TestPublishSubscribeRunTime(t *testing.T) {
 	var m client.Message
 
@@ -297,3 +400,85 @@ loop:
 		}
 	}
 }
+
+func TestSelector(t *testing.T) {
+	// Get a unique destination for the test.
+	destination, _ := DestinationName()
+
+	// Create and open a connection.
+	c, err := NewConnection(&client.ConnectionSpec{})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+
+	// Receive only the messages with large values.
+	ch := make(chan float64, 10)
+	err = c.SubscribeWithSpec(client.SubscriptionSpec{
+		Destination: destination,
+		Callback:    callbackFactory(ch),
+		Selector:    "value > 10 AND kind = 'Measure'",
+	})
+	if err != nil {
+		t.Fatalf("Fail to subscribe: %s", err.Error())
+	}
+
+	// Wait till the subscription reaches the server.
+	time.Sleep(100 * time.Millisecond)
+
+	for _, value := range []float64{5, 20, 8, 30} {
+		err = c.Publish(
+			client.Message{
+				Header: map[string]string{"kind": "Measure"},
+				Data:   client.MessageData{"value": value},
+			},
+			destination,
+		)
+		if err != nil {
+			t.Fatalf("Fail to publish: %s", err.Error())
+		}
+	}
+
+	for _, expected := range []float64{20, 30} {
+		select {
+		case value := <-ch:
+			if value != expected {
+				t.Errorf("Received %v expected %v", value, expected)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for the messages")
+		}
+	}
+
+	// Invalid selectors are rejected.
+	err = c.SubscribeWithSpec(client.SubscriptionSpec{
+		Destination: destination + "-invalid",
+		Callback:    callbackFactory(ch),
+		Selector:    "value >",
+	})
+	if err == nil {
+		t.Errorf("Expected an error subscribing with an invalid selector")
+	}
+}
+
+func TestSelectorHeader(t *testing.T) {
+	// The selector is sent to the broker only when requested, as the broker doesn't see the
+	// fields of the data.
+	for _, brokerSelector := range []bool{false, true} {
+		options, filter, err := subscriptionOptions(client.SubscriptionSpec{
+			Selector:       "kind = 'Measure'",
+			BrokerSelector: brokerSelector,
+		})
+		if err != nil || filter == nil {
+			t.Fatalf("Can't create the subscription options: %v", err)
+		}
+		f := frame.New(frame.SUBSCRIBE)
+		for _, option := range options {
+			option(f)
+		}
+		_, sent := f.Header.Contains(selectorHeader)
+		if sent != brokerSelector {
+			t.Errorf("Expected the selector header to be sent: %v, got %v", brokerSelector, sent)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-stomp/stomp"
+	"github.com/go-stomp/stomp/frame"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// deliveryOptions returns the options of the SEND frame that request the delivery options of a
+// message, for all the supported brokers. The times are calculated relative to the given time.
+func deliveryOptions(delivery client.DeliveryOptions,
+	now time.Time) (options []func(*frame.Frame) error, err error) {
+	// Check the options:
+	if delivery.Priority < 0 || delivery.Priority > 9 {
+		err = fmt.Errorf("Priority %d isn't between 1 and 9, or zero for the default priority", delivery.Priority)
+		return
+	}
+	if delivery.TimeToLive < 0 {
+		err = fmt.Errorf("Time to live %s is negative", delivery.TimeToLive)
+		return
+	}
+	if delivery.Delay < 0 {
+		err = fmt.Errorf("Delay %s is negative", delivery.Delay)
+		return
+	}
+
+	persistent := strconv.FormatBool(!delivery.NonPersistent)
+	options = append(options, sendHeader(client.PersistentHeader, persistent))
+	if delivery.Priority != 0 {
+		priority := strconv.Itoa(delivery.Priority)
+		options = append(options, sendHeader(client.PriorityHeader, priority))
+	}
+
+	// The time to live starts when the message is delivered, so it includes the delay:
+	if delivery.TimeToLive != 0 {
+		expires := now.Add(delivery.Delay + delivery.TimeToLive)
+		options = append(
+			options,
+			sendHeader(client.ExpiresHeader, milliseconds(expires)),
+			sendHeader(client.ExpirationHeader, duration(delivery.TimeToLive)),
+		)
+	}
+	if delivery.Delay != 0 {
+		delay := duration(delivery.Delay)
+		options = append(
+			options,
+			sendHeader(client.ScheduledDelayHeader, delay),
+			sendHeader(client.ScheduledDeliveryHeader, milliseconds(now.Add(delivery.Delay))),
+			sendHeader(client.DelayHeader, delay),
+		)
+	}
+	return
+}
+
+// sendHeader returns the option that adds a header to a SEND frame.
+func sendHeader(key, value string) func(*frame.Frame) error {
+	return stomp.SendOpt.Header(key, value)
+}
+
+// milliseconds formats a time as the number of milliseconds since the epoch.
+func milliseconds(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
+
+// duration formats a duration as a number of milliseconds.
+func duration(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Millisecond), 10)
+}
@@ -0,0 +1,151 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-stomp/stomp/frame"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+func TestDeliveryOptions(t *testing.T) {
+	now := time.Unix(1000, 0)
+
+	// The default is a persistent message without any other header.
+	f := frame.New(frame.SEND)
+	options, err := deliveryOptions(client.DeliveryOptions{}, now)
+	if err != nil {
+		t.Fatalf("Can't calculate options: %s", err.Error())
+	}
+	for _, option := range options {
+		option(f)
+	}
+	if f.Header.Len() != 1 || f.Header.Get(client.PersistentHeader) != "true" {
+		t.Errorf("Unexpected default headers: %v", f.Header)
+	}
+
+	// All the options are sent with the headers of all the supported brokers.
+	f = frame.New(frame.SEND)
+	options, err = deliveryOptions(
+		client.DeliveryOptions{
+			NonPersistent: true,
+			Priority:      7,
+			TimeToLive:    time.Minute,
+			Delay:         2 * time.Second,
+		},
+		now,
+	)
+	if err != nil {
+		t.Fatalf("Can't calculate options: %s", err.Error())
+	}
+	for _, option := range options {
+		option(f)
+	}
+	expected := map[string]string{
+		client.PersistentHeader:        "false",
+		client.PriorityHeader:          "7",
+		client.ExpiresHeader:           "1062000",
+		client.ExpirationHeader:        "60000",
+		client.ScheduledDelayHeader:    "2000",
+		client.ScheduledDeliveryHeader: "1002000",
+		client.DelayHeader:             "2000",
+	}
+	for key, value := range expected {
+		if f.Header.Get(key) != value {
+			t.Errorf("Expected header '%s' to be '%s', got '%s'", key, value, f.Header.Get(key))
+		}
+	}
+
+	// Invalid options are rejected.
+	invalid := []client.DeliveryOptions{
+		{Priority: 10},
+		{Priority: -1},
+		{TimeToLive: -time.Second},
+		{Delay: -time.Second},
+	}
+	for _, delivery := range invalid {
+		_, err = deliveryOptions(delivery, now)
+		if err == nil {
+			t.Errorf("Expected an error for options %+v", delivery)
+		}
+	}
+}
+
+func TestPublishDeliveryOptions(t *testing.T) {
+	// Get a unique destination for the test.
+	destination, _ := DestinationName()
+
+	// Create and open a connection.
+	c, err := NewConnection(&client.ConnectionSpec{})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+
+	received := make(chan client.Message, 1)
+	err = c.Subscribe(destination, func(m client.Message, destination string) error {
+		received <- m
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Fail to subscribe: %s", err.Error())
+	}
+
+	// Wait till the subscription reaches the server.
+	time.Sleep(100 * time.Millisecond)
+
+	err = c.Publish(
+		client.Message{
+			Data: client.MessageData{"value": 42.0},
+			Delivery: client.DeliveryOptions{
+				Priority:   9,
+				TimeToLive: time.Hour,
+			},
+		},
+		destination,
+	)
+	if err != nil {
+		t.Fatalf("Fail to publish: %s", err.Error())
+	}
+
+	select {
+	case m := <-received:
+		if m.Header[client.PriorityHeader] != "9" {
+			t.Errorf("Expected priority 9, got '%s'", m.Header[client.PriorityHeader])
+		}
+		if m.Header[client.ExpiresHeader] == "" {
+			t.Error("Expected the expiration time of the message")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for message")
+	}
+
+	// Messages with invalid options aren't sent.
+	err = c.Publish(
+		client.Message{
+			Data:     client.MessageData{"value": 42.0},
+			Delivery: client.DeliveryOptions{Priority: 42},
+		},
+		destination,
+	)
+	if err == nil {
+		t.Error("Expected an error publishing with an invalid priority")
+	}
+}
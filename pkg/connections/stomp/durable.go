@@ -0,0 +1,132 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-stomp/stomp"
+	"github.com/go-stomp/stomp/frame"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// defaultReceiptTimeout is the default maximum time to wait for the broker to confirm the removal
+// of a durable subscription.
+const defaultReceiptTimeout = 10 * time.Second
+
+// Names of the headers used to create and remove durable subscriptions. ActiveMQ and ActiveMQ
+// Artemis take the name of the subscription in a header, while RabbitMQ takes it from the
+// identifier of the subscription and only needs to be told to keep the queue.
+const (
+	// Used by ActiveMQ.
+	activemqSubscriptionNameHeader = "activemq.subscriptionName"
+
+	// Used by ActiveMQ Artemis.
+	artemisSubscriptionNameHeader = "durable-subscription-name"
+
+	// Used by RabbitMQ, together with the identifier of the subscription.
+	rabbitmqDurableHeader    = "durable"
+	rabbitmqAutoDeleteHeader = "auto-delete"
+
+	// Header of the CONNECT frame that contains the client identifier.
+	clientIDHeader = "client-id"
+)
+
+// durableOptions returns the options of the SUBSCRIBE frame that make a subscription durable.
+func durableOptions(name string) []func(*frame.Frame) error {
+	return []func(*frame.Frame) error{
+		stomp.SubscribeOpt.Id(name),
+		stomp.SubscribeOpt.Header(activemqSubscriptionNameHeader, name),
+		stomp.SubscribeOpt.Header(artemisSubscriptionNameHeader, name),
+		stomp.SubscribeOpt.Header(rabbitmqDurableHeader, "true"),
+		stomp.SubscribeOpt.Header(rabbitmqAutoDeleteHeader, "false"),
+	}
+}
+
+// removeDurableOptions returns the options of the UNSUBSCRIBE frame that remove a durable
+// subscription, instead of just detaching from it.
+func removeDurableOptions(name string) []func(*frame.Frame) error {
+	return []func(*frame.Frame) error{
+		stomp.SubscribeOpt.Header(activemqSubscriptionNameHeader, name),
+		stomp.SubscribeOpt.Header(artemisSubscriptionNameHeader, name),
+		stomp.SubscribeOpt.Header(rabbitmqDurableHeader, "true"),
+	}
+}
+
+// RemoveDurableSubscription removes a durable subscription permanently, so that the broker
+// discards the messages kept for it. If the connection is subscribed to the destination with the
+// durable subscription it is unsubscribed, otherwise the subscription is attached briefly in
+// order to remove it, and other subscriptions to the destination aren't changed.
+//
+// Not all brokers confirm the removal, so it waits for the confirmation only for a while, and
+// returns an error and reports a ReceiptTimeout event if it doesn't arrive. In that case the
+// removal may still happen later.
+func (c *Connection) RemoveDurableSubscription(destination string, name string) (err error) {
+	// Sanity check connection.
+	if c.connection == nil {
+		err = fmt.Errorf("Connection is closed")
+		return
+	}
+
+	// Use the current subscription if it is the durable one, or attach to the durable
+	// subscription:
+	c.subscriptionsMutex.Lock()
+	subscription, ok := c.subscriptions[destination]
+	if ok && subscription.Id() == name {
+		delete(c.subscriptions, destination)
+		delete(c.deliveryTimes, destination)
+	} else {
+		subscription = nil
+	}
+	c.subscriptionsMutex.Unlock()
+	if subscription == nil {
+		subscription, err = c.connection.Subscribe(destination, stomp.AckAuto, durableOptions(name)...)
+		if err != nil {
+			return
+		}
+
+		// Discard the messages delivered to it, so that they don't block the removal:
+		go func() {
+			for range subscription.C {
+			}
+		}()
+	}
+
+	// Remove it, waiting for the broker to confirm it. The result is buffered, so that the
+	// goroutine finishes when the broker confirms it later, or at the latest when the connection
+	// is closed:
+	result := make(chan error, 1)
+	go func() {
+		result <- subscription.Unsubscribe(removeDurableOptions(name)...)
+	}()
+	select {
+	case err = <-result:
+	case <-time.After(c.receiptTimeout):
+		err = fmt.Errorf(
+			"Broker didn't confirm the removal of durable subscription '%s' in %s",
+			name, c.receiptTimeout,
+		)
+		c.fire(client.Event{
+			Type:        client.ReceiptTimeoutEvent,
+			Destination: destination,
+			Err:         err,
+		})
+	}
+	return
+}
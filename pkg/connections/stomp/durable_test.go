@@ -0,0 +1,129 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-stomp/stomp/frame"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+func TestDurableOptions(t *testing.T) {
+	// Subscribing sends the name in the headers of all the supported brokers.
+	f := frame.New(frame.SUBSCRIBE)
+	for _, option := range durableOptions("my-subscription") {
+		err := option(f)
+		if err != nil {
+			t.Fatalf("Can't apply option: %s", err.Error())
+		}
+	}
+	expected := map[string]string{
+		frame.Id:                       "my-subscription",
+		activemqSubscriptionNameHeader: "my-subscription",
+		artemisSubscriptionNameHeader:  "my-subscription",
+		rabbitmqDurableHeader:          "true",
+		rabbitmqAutoDeleteHeader:       "false",
+	}
+	for key, value := range expected {
+		if f.Header.Get(key) != value {
+			t.Errorf("Expected header '%s' to be '%s', got '%s'", key, value, f.Header.Get(key))
+		}
+	}
+
+	// Removing doesn't change the identifier of the subscription being removed.
+	f = frame.New(frame.UNSUBSCRIBE, frame.Id, "42")
+	for _, option := range removeDurableOptions("my-subscription") {
+		err := option(f)
+		if err != nil {
+			t.Fatalf("Can't apply option: %s", err.Error())
+		}
+	}
+	if f.Header.Get(frame.Id) != "42" || f.Header.Get(artemisSubscriptionNameHeader) != "my-subscription" {
+		t.Errorf("Unexpected UNSUBSCRIBE headers: %v", f.Header)
+	}
+}
+
+// checkRemoved checks the result of removing a durable subscription, which fails with the internal
+// server because it doesn't confirm the removal.
+func checkRemoved(t *testing.T, err error) {
+	if UseInternalServer && err == nil {
+		t.Fatal("Expected an error because the removal isn't confirmed")
+	}
+	if !UseInternalServer && err != nil {
+		t.Fatalf("Fail to remove subscription: %s", err.Error())
+	}
+}
+
+func TestRemoveDurableSubscription(t *testing.T) {
+	// Get a unique destination for the test.
+	destination, _ := DestinationName()
+
+	// Create and open a connection. The internal server doesn't confirm the removals, so don't
+	// wait long for them.
+	c, err := NewConnection(&client.ConnectionSpec{})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+	c.(*Connection).receiptTimeout = 100 * time.Millisecond
+
+	ch := make(chan float64, 10)
+	err = c.SubscribeWithSpec(client.SubscriptionSpec{
+		Destination: destination,
+		Callback:    callbackFactory(ch),
+		DurableName: "first",
+	})
+	if err != nil {
+		t.Fatalf("Fail to subscribe: %s", err.Error())
+	}
+
+	// Wait till the subscription reaches the server.
+	time.Sleep(100 * time.Millisecond)
+
+	// Removing another durable subscription doesn't change the current one.
+	err = c.RemoveDurableSubscription(destination, "second")
+	checkRemoved(t, err)
+	err = c.Publish(client.Message{Data: client.MessageData{"value": 1.0}}, destination)
+	if err != nil {
+		t.Fatalf("Fail to publish: %s", err.Error())
+	}
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the current subscription to receive the message")
+	}
+
+	// Removing the current durable subscription unsubscribes it.
+	err = c.RemoveDurableSubscription(destination, "first")
+	checkRemoved(t, err)
+	err = c.Publish(client.Message{Data: client.MessageData{"value": 2.0}}, destination)
+	if err != nil {
+		t.Fatalf("Fail to publish: %s", err.Error())
+	}
+	select {
+	case value := <-ch:
+		t.Errorf("Received %v after removing the subscription", value)
+	case <-time.After(200 * time.Millisecond):
+	}
+	err = c.Subscribe(destination, callbackFactory(ch))
+	if err != nil {
+		t.Errorf("Expected to subscribe again, got %v", err)
+	}
+}
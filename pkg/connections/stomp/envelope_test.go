@@ -0,0 +1,185 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/container-mgmt/messaging-library/pkg/blobstore"
+	"github.com/container-mgmt/messaging-library/pkg/client"
+	"github.com/container-mgmt/messaging-library/pkg/compression"
+	"github.com/container-mgmt/messaging-library/pkg/envelope"
+)
+
+func TestEnvelope(t *testing.T) {
+	// Get a unique destination for the test.
+	destination, _ := DestinationName()
+
+	// Create the keys shared by the sender and the receiver.
+	secret := make([]byte, 32)
+	aesKey := make([]byte, 32)
+	rand.Read(secret)
+	rand.Read(aesKey)
+	keys := &envelope.StaticKeys{
+		SigningKeyID:    "s1",
+		SigningKeys:     map[string][]byte{"s1": secret},
+		EncryptionKeyID: "e1",
+		EncryptionKeys:  map[string][]byte{"e1": aesKey},
+	}
+	spec := client.EnvelopeSpec{
+		Keys:       keys,
+		Signing:    envelope.HMACSHA256,
+		Encryption: envelope.AESGCM,
+	}
+
+	// Create a store for the large bodies, shared by the sender and the receiver.
+	dir, err := ioutil.TempDir("", "blobs")
+	if err != nil {
+		t.Fatalf("Can't create directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	store, err := blobstore.NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Can't create store: %s", err.Error())
+	}
+	claimCheck := client.ClaimCheckSpec{
+		Store:     store,
+		Threshold: 1000,
+	}
+
+	// Create a receiver, a sender that also compresses, and a sender without keys.
+	receiver, err := NewConnection(&client.ConnectionSpec{
+		Envelope:   spec,
+		ClaimCheck: claimCheck,
+	})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer receiver.Close()
+	sender, err := NewConnection(&client.ConnectionSpec{
+		Envelope:   spec,
+		ClaimCheck: claimCheck,
+		Compression: client.CompressionSpec{
+			Compressor: compression.Gzip,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer sender.Close()
+	intruder, err := NewConnection(&client.ConnectionSpec{})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer intruder.Close()
+
+	received := make(chan client.Message, 10)
+	err = receiver.Subscribe(destination, func(m client.Message, destination string) error {
+		received <- m
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Fail to subscribe: %s", err.Error())
+	}
+
+	// Wait till the subscription reaches the server.
+	time.Sleep(100 * time.Millisecond)
+
+	// Messages sealed with the shared keys are opened.
+	err = sender.Publish(client.Message{Data: client.MessageData{"value": 42.0}}, destination)
+	if err != nil {
+		t.Fatalf("Fail to publish: %s", err.Error())
+	}
+	select {
+	case m := <-received:
+		if m.Err != nil {
+			t.Fatalf("Received error: %s", m.Err.Error())
+		}
+		if m.Data["value"] != 42.0 {
+			t.Errorf("Received %v expected 42", m.Data["value"])
+		}
+		if _, ok := m.Header[envelope.SignatureHeader]; ok {
+			t.Error("Expected the envelope headers to be removed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the message")
+	}
+
+	// The routing headers and the bodies stored outside of the broker are signed too. The
+	// random value can't be compressed below the threshold of the claim check.
+	random := make([]byte, 5000)
+	rand.Read(random)
+	large := base64.StdEncoding.EncodeToString(random)
+	err = sender.Publish(client.Message{
+		Header: map[string]string{
+			client.ReplyToHeader:       "/queue/responses",
+			client.CorrelationIDHeader: "42",
+		},
+		Data: client.MessageData{"value": large},
+	}, destination)
+	if err != nil {
+		t.Fatalf("Fail to publish: %s", err.Error())
+	}
+	select {
+	case m := <-received:
+		if m.Err != nil {
+			t.Fatalf("Received error: %s", m.Err.Error())
+		}
+		if m.Data["value"] != large {
+			t.Error("Received a different value")
+		}
+		if m.Header[client.ReplyToHeader] != "/queue/responses" {
+			t.Errorf("Received reply-to '%s'", m.Header[client.ReplyToHeader])
+		}
+		if _, ok := m.Header[client.ClaimCheckHeader]; ok {
+			t.Error("Expected the claim check header to be removed")
+		}
+		files, _ := ioutil.ReadDir(dir)
+		if len(files) != 1 {
+			t.Errorf("Expected the body to be stored in a blob, found %d", len(files))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the message")
+	}
+
+	// Messages that can't be verified are delivered as errors.
+	err = intruder.Publish(client.Message{Data: client.MessageData{"value": 666.0}}, destination)
+	if err != nil {
+		t.Fatalf("Fail to publish: %s", err.Error())
+	}
+	select {
+	case m := <-received:
+		if m.Err == nil {
+			t.Errorf("Expected an error for an unsigned message, got %v", m.Data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the message")
+	}
+
+	// Invalid specifications are rejected.
+	_, err = NewConnection(&client.ConnectionSpec{
+		Envelope: client.EnvelopeSpec{Signing: envelope.HMACSHA256},
+	})
+	if err == nil {
+		t.Error("Expected an error for an envelope without keys")
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// AddEventListener adds a listener that will receive the events of the life cycle of the
+// connection and of its subscriptions.
+func (c *Connection) AddEventListener(listener client.EventListener) {
+	c.listenersMutex.Lock()
+	defer c.listenersMutex.Unlock()
+	c.listeners = append(c.listeners, listener)
+}
+
+// fire sends an event to the listeners of the connection.
+func (c *Connection) fire(event client.Event) {
+	c.listenersMutex.Lock()
+	listeners := c.listeners
+	c.listenersMutex.Unlock()
+
+	event.Broker = c.broker
+	for _, listener := range listeners {
+		listener(event)
+	}
+}
+
+// markDisconnected records that the connection was closed or lost. It returns true only the first
+// time, so that the DisconnectedEvent is sent once.
+func (c *Connection) markDisconnected() bool {
+	c.listenersMutex.Lock()
+	defer c.listenersMutex.Unlock()
+
+	if c.disconnected {
+		return false
+	}
+	c.disconnected = true
+	return true
+}
+
+// connectionLost sends the DisconnectedEvent when reading or writing to the broker fails, unless
+// the connection was closed before.
+func (c *Connection) connectionLost(err error) {
+	if c.markDisconnected() {
+		c.fire(client.Event{Type: client.DisconnectedEvent, Err: err})
+	}
+}
+
+// reportError sends the event of an error received on a subscription. Errors received during
+// shutdown are caused by closing the connection, and errors received after reading or writing to
+// the broker failed are caused by the loss of the connection, which is reported by the socket,
+// so they aren't reported.
+func (c *Connection) reportError(err error, destination string) {
+	if err == nil || c.isShuttingDown() || c.socket.failed.Load() {
+		return
+	}
+	c.fire(client.Event{Type: client.ErrorFrameEvent, Destination: destination, Err: err})
+}
@@ -0,0 +1,176 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// Event listener that records the events received.
+type eventRecorder struct {
+	mutex  sync.Mutex
+	events []client.Event
+}
+
+func (r *eventRecorder) listen(event client.Event) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *eventRecorder) types() (types []client.EventType) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, event := range r.events {
+		types = append(types, event.Type)
+	}
+	return
+}
+
+func TestConnectionEvents(t *testing.T) {
+	recorder := &eventRecorder{}
+
+	// Create and close a connection.
+	c, err := NewConnection(&client.ConnectionSpec{
+		EventListeners: []client.EventListener{recorder.listen},
+	})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	c.Close()
+	c.Close()
+
+	types := recorder.types()
+	if len(types) != 2 || types[0] != client.ConnectedEvent || types[1] != client.DisconnectedEvent {
+		t.Fatalf("Expected Connected and Disconnected events, got %v", types)
+	}
+	if recorder.events[0].Broker != "127.0.0.1:61613" {
+		t.Errorf("Expected broker '127.0.0.1:61613', got '%s'", recorder.events[0].Broker)
+	}
+}
+
+func TestConnectionLostEvent(t *testing.T) {
+	// Get a unique destination for the test.
+	destination, _ := DestinationName()
+
+	// Create a connection and subscribe.
+	recorder := &eventRecorder{}
+	c, err := NewConnection(&client.ConnectionSpec{
+		EventListeners: []client.EventListener{recorder.listen},
+	})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+	err = c.Subscribe(destination, func(m client.Message, destination string) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Fail to subscribe: %s", err.Error())
+	}
+
+	// Wait till the subscription reaches the server, and kill the connection to the broker.
+	time.Sleep(100 * time.Millisecond)
+	c.(*Connection).socket.Close()
+
+	// The loss of the connection is reported as a disconnection, not as an error frame.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(recorder.types()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	types := recorder.types()
+	if len(types) != 2 || types[1] != client.DisconnectedEvent {
+		t.Fatalf("Expected Connected and Disconnected events, got %v", types)
+	}
+	if recorder.events[1].Err == nil {
+		t.Error("Expected the Disconnected event to contain the error")
+	}
+}
+
+func TestPublisherConnectionLostEvent(t *testing.T) {
+	// Create a connection without subscriptions.
+	recorder := &eventRecorder{}
+	c, err := NewConnection(&client.ConnectionSpec{
+		EventListeners: []client.EventListener{recorder.listen},
+	})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+
+	// Kill the connection to the broker, the loss is detected by the socket.
+	c.(*Connection).socket.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(recorder.types()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	types := recorder.types()
+	if len(types) != 2 || types[1] != client.DisconnectedEvent {
+		t.Fatalf("Expected Connected and Disconnected events, got %v", types)
+	}
+	if recorder.events[1].Err == nil {
+		t.Error("Expected the Disconnected event to contain the error")
+	}
+}
+
+func TestReceiptTimeoutEvent(t *testing.T) {
+	// The internal server doesn't confirm unsubscriptions.
+	if !UseInternalServer {
+		t.Skip("Requires the internal server")
+	}
+
+	// Get a unique destination for the test.
+	destination, _ := DestinationName()
+
+	// Create a connection and subscribe.
+	c, err := NewConnection(&client.ConnectionSpec{})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	recorder := &eventRecorder{}
+	c.AddEventListener(recorder.listen)
+	err = c.Subscribe(destination, callbackFactory(make(chan float64)))
+	if err != nil {
+		t.Fatalf("Fail to subscribe: %s", err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	c.Shutdown(ctx)
+
+	// The unsubscription that wasn't confirmed before disconnecting is reported.
+	deadline := time.Now().Add(time.Second)
+	for len(recorder.types()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	found := false
+	for _, event := range recorder.events {
+		if event.Type == client.ReceiptTimeoutEvent && event.Destination == destination {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected a ReceiptTimeout event for '%s', got %v", destination, recorder.events)
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-stomp/stomp"
+	"github.com/go-stomp/stomp/frame"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// Names of the headers used to ask the brokers to limit the messages sent before they are
+// acknowledged. ActiveMQ and RabbitMQ use different names for the same limit, so subscriptions
+// send both.
+const (
+	// Used by ActiveMQ.
+	activemqPrefetchHeader = "activemq.prefetchSize"
+
+	// Used by RabbitMQ.
+	rabbitmqPrefetchHeader = "prefetch-count"
+)
+
+// flowOptions returns the acknowledge mode and the options of the SUBSCRIBE frame that implement
+// the prefetch limit of a subscription. Messages are acknowledged individually, so that the
+// broker sends a new message each time that one is handled.
+func flowOptions(flow client.FlowControl) (ack stomp.AckMode, options []func(*frame.Frame) error) {
+	if flow.Prefetch <= 0 {
+		ack = stomp.AckAuto
+		return
+	}
+
+	ack = stomp.AckClientIndividual
+	prefetch := strconv.Itoa(flow.Prefetch)
+	options = []func(*frame.Frame) error{
+		stomp.SubscribeOpt.Header(activemqPrefetchHeader, prefetch),
+		stomp.SubscribeOpt.Header(rabbitmqPrefetchHeader, prefetch),
+	}
+	return
+}
+
+// receive returns the channel where the messages of a subscription are delivered, after going
+// through the buffer of the subscription. The errors reported by the broker are never discarded.
+func (c *Connection) receive(subscription *stomp.Subscription, destination string,
+	flow client.FlowControl) <-chan *stomp.Message {
+	// Without a buffer messages are read from the broker only when the handler is ready:
+	if flow.BufferSize <= 0 {
+		return subscription.C
+	}
+
+	buffer := make(chan *stomp.Message, flow.BufferSize)
+	go func() {
+		defer close(buffer)
+		for message := range subscription.C {
+			if message.Err != nil || flow.Overflow == "" || flow.Overflow == client.OverflowBlock {
+				buffer <- message
+				continue
+			}
+
+			c.overflow(buffer, message, destination, flow)
+		}
+	}()
+	return buffer
+}
+
+// overflow adds a message to the buffer of a subscription, discarding messages according to the
+// overflow policy if the buffer is full.
+func (c *Connection) overflow(buffer chan *stomp.Message, message *stomp.Message, destination string,
+	flow client.FlowControl) {
+	for {
+		select {
+		case buffer <- message:
+			return
+		default:
+		}
+
+		if flow.Overflow == client.OverflowDropNewest {
+			c.discard(message, destination, flow)
+			return
+		}
+		select {
+		case oldest := <-buffer:
+			c.discard(oldest, destination, flow)
+		default:
+		}
+	}
+}
+
+// discard drops a message that doesn't fit in the buffer of a subscription.
+func (c *Connection) discard(message *stomp.Message, destination string, flow client.FlowControl) {
+	c.logger.Warn(
+		"Buffer of subscription is full, discarding message",
+		client.DestinationField, destination,
+		client.MessageIDField, message.Header.Get(frame.MessageId),
+	)
+	c.acknowledge([]*stomp.Message{message}, destination, flow, "")
+}
+
+// acknowledge tells the broker that a message was handled, so that it sends the next one, when
+// the subscription has a prefetch limit. The messages are the frames received, all the chunks
+// for a chunked message. Once the broker won't send the message again, the blob that contains
+// its body, if it was received successfully, is released.
+func (c *Connection) acknowledge(messages []*stomp.Message, destination string,
+	flow client.FlowControl, blob string) {
+	for _, message := range messages {
+		if message.Err != nil {
+			return
+		}
+		if flow.Prefetch <= 0 {
+			continue
+		}
+		err := c.ack(message)
+		if err != nil {
+			c.logger.Error(
+				"Can't acknowledge message",
+				client.DestinationField, destination,
+				client.MessageIDField, message.Header.Get(frame.MessageId),
+				"error", err,
+			)
+			return
+		}
+	}
+	c.releaseBody(blob, destination)
+}
+
+// throttleDelivery waits till the limiter of a subscription allows the delivery of a message. It
+// returns false if the connection was closed, or shutdown ran out of time, while waiting. In that
+// case the message shouldn't be handled nor acknowledged, so that the broker sends it again.
+func (c *Connection) throttleDelivery(limiter client.Limiter, destination string) bool {
+	c.throttle(c.throttling, limiter, destination)
+	return c.throttling.Err() == nil
+}
+
+// throttle waits till the limiter allows an operation on a destination, reporting the time spent
+// waiting. A nil limiter allows all the operations.
+func (c *Connection) throttle(ctx context.Context, limiter client.Limiter, destination string) error {
+	if limiter == nil {
+		return nil
+	}
+	start := time.Now()
+	err := limiter.Wait(ctx)
+
+	// Ignore the time spent checking the limiter when it doesn't make us wait:
+	if wait := time.Since(start); wait > time.Millisecond {
+		c.metrics.Throttled(destination, wait)
+	}
+	return err
+}
@@ -0,0 +1,330 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-stomp/stomp"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// receiveWithFlowControl subscribes with the given flow control and a handler that blocks till
+// all the messages are published, and returns the values received.
+func receiveWithFlowControl(t *testing.T, flow client.FlowControl, count int) (values []float64) {
+	// Get a unique destination for the test.
+	destination, _ := DestinationName()
+	destination = "/queue/" + destination
+
+	c, err := NewConnection(&client.ConnectionSpec{})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+
+	received := make(chan float64, count)
+	release := make(chan struct{})
+	err = c.SubscribeWithSpec(client.SubscriptionSpec{
+		Destination: destination,
+		Callback: func(m client.Message, destination string) error {
+			if m.Err != nil {
+				return nil
+			}
+			<-release
+			received <- m.Data["value"].(float64)
+			return nil
+		},
+		FlowControl: flow,
+	})
+	if err != nil {
+		t.Fatalf("Fail to subscribe: %s", err.Error())
+	}
+
+	// Wait till the subscription reaches the server.
+	time.Sleep(100 * time.Millisecond)
+
+	for i := 1; i <= count; i++ {
+		err = c.Publish(client.Message{Data: client.MessageData{"value": float64(i)}}, destination)
+		if err != nil {
+			t.Fatalf("Fail to publish: %s", err.Error())
+		}
+	}
+
+	// Let the broker deliver the messages, and then the handler process them.
+	time.Sleep(200 * time.Millisecond)
+	close(release)
+	for {
+		select {
+		case value := <-received:
+			values = append(values, value)
+		case <-time.After(500 * time.Millisecond):
+			return
+		}
+	}
+}
+
+// ackRecorder records the values of the messages acknowledged, instead of sending the
+// acknowledgements to the broker.
+type ackRecorder struct {
+	mutex  sync.Mutex
+	values []float64
+}
+
+func (r *ackRecorder) ack(message *stomp.Message) error {
+	var data client.MessageData
+	json.Unmarshal(message.Body, &data)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.values = append(r.values, data["value"].(float64))
+	return nil
+}
+
+// wait waits till the acknowledged values are the expected ones.
+func (r *ackRecorder) wait(t *testing.T, expected ...float64) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		r.mutex.Lock()
+		values := append([]float64{}, r.values...)
+		r.mutex.Unlock()
+		if reflect.DeepEqual(values, expected) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Acknowledged %v expected %v", values, expected)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAcknowledge(t *testing.T) {
+	// Get a unique destination for the test. Topics don't wait for the acknowledgements, so
+	// the messages are delivered even if they aren't sent.
+	destination, _ := DestinationName()
+
+	c, err := NewConnection(&client.ConnectionSpec{})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+	recorder := &ackRecorder{}
+	c.(*Connection).ack = recorder.ack
+
+	entered := make(chan float64, 10)
+	release := make(chan struct{})
+	err = c.SubscribeWithSpec(client.SubscriptionSpec{
+		Destination: destination,
+		Callback: func(m client.Message, destination string) error {
+			if m.Err != nil {
+				return nil
+			}
+			entered <- m.Data["value"].(float64)
+			<-release
+			return nil
+		},
+		Selector: "value > 10",
+		FlowControl: client.FlowControl{
+			Prefetch:   1,
+			BufferSize: 1,
+			Overflow:   client.OverflowDropNewest,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Fail to subscribe: %s", err.Error())
+	}
+
+	// Wait till the subscription reaches the server.
+	time.Sleep(100 * time.Millisecond)
+
+	publish := func(value float64) {
+		err := c.Publish(client.Message{Data: client.MessageData{"value": value}}, destination)
+		if err != nil {
+			t.Fatalf("Fail to publish: %s", err.Error())
+		}
+	}
+
+	// The messages that the selector skips are acknowledged without calling the handler.
+	publish(5)
+	recorder.wait(t, 5)
+	if len(entered) != 0 {
+		t.Error("Expected the handler not to be called for the skipped message")
+	}
+
+	// Messages are acknowledged only after the handler returns.
+	publish(20)
+	select {
+	case <-entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the handler")
+	}
+	time.Sleep(100 * time.Millisecond)
+	recorder.wait(t, 5)
+
+	// The messages discarded because the buffer is full are acknowledged immediately.
+	publish(30)
+	time.Sleep(100 * time.Millisecond)
+	publish(40)
+	recorder.wait(t, 5, 40)
+
+	// The rest are acknowledged as the handler returns.
+	close(release)
+	recorder.wait(t, 5, 40, 20, 30)
+}
+
+func TestFlowControl(t *testing.T) {
+	tests := []struct {
+		name     string
+		flow     client.FlowControl
+		expected []float64
+	}{
+		{
+			name:     "Block",
+			flow:     client.FlowControl{BufferSize: 1},
+			expected: []float64{1, 2, 3, 4, 5},
+		},
+		{
+			name:     "DropNewest",
+			flow:     client.FlowControl{BufferSize: 1, Overflow: client.OverflowDropNewest},
+			expected: []float64{1, 2},
+		},
+		{
+			name:     "DropOldest",
+			flow:     client.FlowControl{BufferSize: 1, Overflow: client.OverflowDropOldest},
+			expected: []float64{1, 5},
+		},
+		{
+			name:     "Prefetch",
+			flow:     client.FlowControl{Prefetch: 2, BufferSize: 1, Overflow: client.OverflowDropNewest},
+			expected: []float64{1, 2, 3, 4, 5},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// The internal server expects STOMP 1.2 acknowledgements to carry the "ack"
+			// header instead of the "id" header sent by the client library. See
+			// TestAcknowledge for the acknowledgements.
+			if test.flow.Prefetch > 0 && UseInternalServer {
+				t.Skip("Requires an external server")
+			}
+			values := receiveWithFlowControl(t, test.flow, 5)
+			if !reflect.DeepEqual(values, test.expected) {
+				t.Errorf("Received %v expected %v", values, test.expected)
+			}
+		})
+	}
+}
+
+// Metrics that record the time spent throttled.
+type throttleRecorder struct {
+	noMetrics
+	mutex sync.Mutex
+	wait  time.Duration
+}
+
+func (r *throttleRecorder) Throttled(destination string, wait time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.wait += wait
+}
+
+func TestPublishRateLimit(t *testing.T) {
+	// Get unique destinations for the test.
+	first, _ := DestinationName()
+	second, _ := DestinationName()
+
+	// Share a limiter of 20 messages per second between the destinations.
+	limiter := client.NewLimiter(20, 1)
+	recorder := &throttleRecorder{}
+	c, err := NewConnection(&client.ConnectionSpec{
+		PublishLimiters: map[string]client.Limiter{
+			first:  limiter,
+			second: limiter,
+		},
+		Metrics: recorder,
+	})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+
+	// The first message is allowed by the burst, the others wait 50 milliseconds each.
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		destination := first
+		if i%2 == 1 {
+			destination = second
+		}
+		err = c.Publish(client.Message{Data: client.MessageData{"value": float64(i)}}, destination)
+		if err != nil {
+			t.Fatalf("Fail to publish: %s", err.Error())
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Published 6 messages in %s, expected at least 200ms", elapsed)
+	}
+	recorder.mutex.Lock()
+	wait := recorder.wait
+	recorder.mutex.Unlock()
+	if wait < 200*time.Millisecond {
+		t.Errorf("Recorded %s throttled, expected at least 200ms", wait)
+	}
+}
+
+func TestSubscriptionRateLimit(t *testing.T) {
+	// Get a unique destination for the test.
+	destination, _ := DestinationName()
+
+	c, err := NewConnection(&client.ConnectionSpec{})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+
+	// Handle at most 20 messages per second.
+	received := make(chan float64, 10)
+	err = c.SubscribeWithSpec(client.SubscriptionSpec{
+		Destination: destination,
+		Callback:    callbackFactory(received),
+		FlowControl: client.FlowControl{Limiter: client.NewLimiter(20, 1)},
+	})
+	if err != nil {
+		t.Fatalf("Fail to subscribe: %s", err.Error())
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		err = c.Publish(client.Message{Data: client.MessageData{"value": float64(i)}}, destination)
+		if err != nil {
+			t.Fatalf("Fail to publish: %s", err.Error())
+		}
+	}
+	for i := 0; i < 5; i++ {
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for the messages")
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Handled 5 messages in %s, expected at least 200ms", elapsed)
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// watchedSocket records the last time that data was received from the broker, including
+// heart-beats, and whether reading or writing failed. The STOMP library reads from the socket
+// till it is closed, so every loss of the connection ends with a failure.
+type watchedSocket struct {
+	io.ReadWriteCloser
+
+	lastRead atomic.Int64
+	failed   atomic.Bool
+
+	// first error reading or writing to the broker, and the function that is called with it
+	mutex  sync.Mutex
+	err    error
+	onLost func(err error)
+}
+
+func (s *watchedSocket) Read(p []byte) (n int, err error) {
+	n, err = s.ReadWriteCloser.Read(p)
+	if n > 0 {
+		s.lastRead.Store(time.Now().UnixNano())
+	}
+	if err != nil {
+		s.fail(err)
+	}
+	return
+}
+
+func (s *watchedSocket) Write(p []byte) (n int, err error) {
+	n, err = s.ReadWriteCloser.Write(p)
+	if err != nil {
+		s.fail(err)
+	}
+	return
+}
+
+// fail records an error reading or writing to the broker, and calls the function watching the
+// socket if it is the first one.
+func (s *watchedSocket) fail(err error) {
+	s.failed.Store(true)
+	s.mutex.Lock()
+	first := s.err == nil
+	if first {
+		s.err = err
+	}
+	onLost := s.onLost
+	s.mutex.Unlock()
+	if first && onLost != nil {
+		onLost(err)
+	}
+}
+
+// watch sets the function that is called with the first error reading or writing to the broker.
+// It is called immediately if the socket already failed.
+func (s *watchedSocket) watch(onLost func(err error)) {
+	s.mutex.Lock()
+	s.onLost = onLost
+	err := s.err
+	s.mutex.Unlock()
+	if err != nil {
+		onLost(err)
+	}
+}
+
+// Health returns a report of the state of the connection, of its subscriptions and of the
+// requests pending.
+func (c *Connection) Health() (health client.Health) {
+	health.Broker = c.broker
+
+	// The connection is alive till it is closed or reading or writing to the broker fails:
+	c.listenersMutex.Lock()
+	health.Connected = !c.disconnected && !c.socket.failed.Load()
+	c.listenersMutex.Unlock()
+	if lastRead := c.socket.lastRead.Load(); lastRead != 0 {
+		health.LastHeartbeat = time.Unix(0, lastRead)
+	}
+
+	// Report the subscriptions sorted by destination:
+	c.subscriptionsMutex.Lock()
+	health.Subscriptions = make([]client.SubscriptionHealth, 0, len(c.subscriptions))
+	for destination, subscription := range c.subscriptions {
+		health.Subscriptions = append(health.Subscriptions, client.SubscriptionHealth{
+			Destination:  destination,
+			Active:       subscription.Active(),
+			LastDelivery: c.deliveryTimes[destination],
+		})
+	}
+	c.subscriptionsMutex.Unlock()
+	sort.Slice(health.Subscriptions, func(i, j int) bool {
+		return health.Subscriptions[i].Destination < health.Subscriptions[j].Destination
+	})
+
+	// Count the pending requests of the requestors:
+	health.PendingRequests = make(map[string]int)
+	for _, requestor := range c.currentRequestors() {
+		requestor.pendingMutex.Lock()
+		health.PendingRequests[requestor.requestsQueue] += len(requestor.pendingRequests)
+		requestor.pendingMutex.Unlock()
+	}
+
+	return
+}
+
+// track updates the state of a subscription with a message received from the broker, recording
+// the time of the delivery, or reporting the error.
+func (c *Connection) track(err error, destination string) {
+	if err != nil {
+		c.reportError(err, destination)
+		return
+	}
+	c.recordDelivery(destination)
+}
+
+// recordDelivery records the time when a message was delivered to a subscription.
+func (c *Connection) recordDelivery(destination string) {
+	c.subscriptionsMutex.Lock()
+	defer c.subscriptionsMutex.Unlock()
+	if _, ok := c.subscriptions[destination]; ok {
+		c.deliveryTimes[destination] = time.Now()
+	}
+}
+
+// addRequestor adds a requestor to the ones whose pending requests are reported.
+func (c *Connection) addRequestor(r *Requestor) {
+	c.requestorsMutex.Lock()
+	defer c.requestorsMutex.Unlock()
+	c.requestors[r] = true
+}
+
+// currentRequestors returns the requestors whose pending requests are reported.
+func (c *Connection) currentRequestors() []*Requestor {
+	c.requestorsMutex.Lock()
+	defer c.requestorsMutex.Unlock()
+	requestors := make([]*Requestor, 0, len(c.requestors))
+	for requestor := range c.requestors {
+		requestors = append(requestors, requestor)
+	}
+	return requestors
+}
+
+// removeRequestor removes a requestor from the ones whose pending requests are reported.
+func (c *Connection) removeRequestor(r *Requestor) {
+	c.requestorsMutex.Lock()
+	defer c.requestorsMutex.Unlock()
+	delete(c.requestors, r)
+}
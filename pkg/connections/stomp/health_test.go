@@ -0,0 +1,80 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+	"github.com/container-mgmt/messaging-library/pkg/health"
+)
+
+func TestHealth(t *testing.T) {
+	// Get a unique destination for the test.
+	destination, _ := DestinationName()
+
+	// Create a connection and subscribe.
+	c, err := NewConnection(&client.ConnectionSpec{})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	ch := make(chan float64, 1)
+	err = c.Subscribe(destination, callbackFactory(ch))
+	if err != nil {
+		t.Fatalf("Fail to subscribe: %s", err.Error())
+	}
+
+	// Wait till the subscription reaches the server, and deliver a message.
+	time.Sleep(100 * time.Millisecond)
+	err = c.Publish(client.Message{Data: client.MessageData{"value": 1.0}}, destination)
+	if err != nil {
+		t.Fatalf("Fail to publish: %s", err.Error())
+	}
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for the message")
+	}
+
+	report := c.Health()
+	if !report.Connected || !report.Ready() {
+		t.Errorf("Expected the connection to be connected and ready: %+v", report)
+	}
+	if report.LastHeartbeat.IsZero() {
+		t.Errorf("Expected the last heart-beat to be set")
+	}
+	if len(report.Subscriptions) != 1 || report.Subscriptions[0].LastDelivery.IsZero() {
+		t.Errorf("Expected one subscription with a delivery: %+v", report.Subscriptions)
+	}
+
+	// The probes fail once the connection is closed.
+	handler := health.Handler(c)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/readyz", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected readiness status 200, got %d", recorder.Code)
+	}
+	c.Close()
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/healthz", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected liveness status 503, got %d", recorder.Code)
+	}
+}
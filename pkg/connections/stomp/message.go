@@ -0,0 +1,170 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"encoding/json"
+
+	"github.com/go-stomp/stomp"
+	"github.com/go-stomp/stomp/frame"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// reservedHeaders are the headers that are managed by the STOMP library or assigned by the
+// broker when it delivers a message, and that can't be overridden by the headers of a message.
+// Skipping them allows sending a received message, for example a response that echoes the
+// request, without sending its delivery headers back to the broker.
+var reservedHeaders = map[string]bool{
+	frame.Ack:           true,
+	frame.ContentLength: true,
+	frame.ContentType:   true,
+	frame.Destination:   true,
+	frame.MessageId:     true,
+	frame.Receipt:       true,
+	frame.ReceiptId:     true,
+	frame.Subscription:  true,
+}
+
+// decodeMessage converts a message received from the broker into a client message.
+//
+// If the body of the message can't be parsed as a JSON object, the data of the returned
+// message will contain the raw body under the "byteArray" key, and the parsing error will be
+// returned.
+//
+// Messages that can't be verified, fetched, decrypted or decompressed are returned with the error
+// in the Err field, and the raw body under the "byteArray" key. For the other messages whose body
+// is stored outside of the broker, the key of the blob is returned, so that it is released when
+// the message is acknowledged.
+func (c *Connection) decodeMessage(message *stomp.Message) (m client.Message, blob string,
+	err error) {
+	m = client.Message{
+		ContentType: message.ContentType,
+		Err:         message.Err,
+	}
+
+	// Copy the headers, when a header is repeated only the first value is used, as required
+	// by the STOMP specification.
+	if message.Header != nil {
+		m.Header = make(map[string]string, message.Header.Len())
+		for i := 0; i < message.Header.Len(); i++ {
+			key, value := message.Header.GetAt(i)
+			if _, ok := m.Header[key]; !ok {
+				m.Header[key] = value
+			}
+		}
+	}
+
+	// Errors reported by the broker don't have a body to decode:
+	body := message.Body
+	if message.Err == nil {
+		body, blob, err = c.openBody(m.Header, body)
+		if err != nil {
+			blob = ""
+			m.Err = err
+			m.Data = client.MessageData{"byteArray": message.Body}
+			return
+		}
+	}
+
+	// Decompress the body:
+	body, err = c.decompress(m.Header, body)
+	if err != nil {
+		blob = ""
+		m.Err = err
+		m.Data = client.MessageData{"byteArray": message.Body}
+		return
+	}
+
+	// Try to unmarshal the byte array coming from the broker into a
+	// message body of type map[string]interface{}
+	err = json.Unmarshal(body, &m.Data)
+	if err != nil {
+		m.Data = client.MessageData{"byteArray": body}
+	}
+
+	return
+}
+
+// openBody verifies the signature of a received message, then fetches its body if it is stored
+// outside of the broker, and decrypts it. It returns the key of the blob that contains the body,
+// if any.
+func (c *Connection) openBody(header map[string]string, body []byte) (result []byte, blob string,
+	err error) {
+	if c.envelope != nil {
+		err = c.envelope.Verify(header, body)
+		if err != nil {
+			return
+		}
+	}
+	result, blob, err = c.claimBody(header, body)
+	if err != nil {
+		return
+	}
+	if c.envelope != nil {
+		result, err = c.envelope.Decrypt(header, result)
+		if err != nil {
+			return
+		}
+	}
+
+	// The body was already fetched, and its key verified:
+	delete(header, client.ClaimCheckHeader)
+	delete(header, client.ClaimCheckDigestHeader)
+	return
+}
+
+// headerOptions returns the options that add the headers of a message to a SEND frame.
+func headerOptions(header map[string]string) (options []func(*frame.Frame) error) {
+	for key, value := range header {
+		if reservedHeaders[key] {
+			continue
+		}
+		options = append(options, stomp.SendOpt.Header(key, value))
+	}
+	return
+}
+
+// copyHeader returns a copy of the headers of a message, so that they can be modified without
+// changing the message of the caller.
+func copyHeader(header map[string]string) map[string]string {
+	result := make(map[string]string, len(header))
+	for key, value := range header {
+		result[key] = value
+	}
+	return result
+}
+
+// correlationField returns the value of one of the fields used to correlate requests and
+// responses, looking first in the headers of the message and then in its data.
+func correlationField(m client.Message, header string, field string) (value string, ok bool) {
+	value, ok = m.Header[header]
+	if ok {
+		return
+	}
+	value, ok = m.Data[field].(string)
+	return
+}
+
+// messageFields returns the log fields that identify a received message.
+func messageFields(m client.Message, destination string) []interface{} {
+	fields := []interface{}{client.DestinationField, destination}
+	if id, ok := m.Header[frame.MessageId]; ok {
+		fields = append(fields, client.MessageIDField, id)
+	}
+	return fields
+}
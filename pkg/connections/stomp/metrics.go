@@ -0,0 +1,31 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"time"
+)
+
+// noMetrics is the implementation of the client.Metrics interface used when the connection
+// specification doesn't contain one. It ignores all the measurements.
+type noMetrics struct{}
+
+func (noMetrics) Connected(broker string)                                      {}
+func (noMetrics) RequestStarted(destination string)                            {}
+func (noMetrics) RequestFinished(destination string)                           {}
+func (noMetrics) ResponseReceived(destination string, roundTrip time.Duration) {}
+func (noMetrics) Throttled(destination string, wait time.Duration)             {}
@@ -17,8 +17,11 @@ limitations under the License.
 package stomp
 
 import (
+	"context"
 	"encoding/json"
-	"github.com/go-stomp/stomp"
+	"time"
+
+	"github.com/go-stomp/stomp/frame"
 
 	"github.com/container-mgmt/messaging-library/pkg/client"
 )
@@ -27,11 +30,22 @@ import (
 // sends the message to the specified destination. If the messaging server fails to
 // receive the message for any reason, the connection will close.
 func (c *Connection) PublishByteArray(contentType string, body []byte, destination string) (err error) {
+	options, err := deliveryOptions(client.DeliveryOptions{}, time.Now())
+	if err != nil {
+		return
+	}
+	err = c.send(contentType, body, destination, options...)
+	return
+}
+
+// send sends a byte array to the messaging server, with the given options of the SEND frame.
+func (c *Connection) send(contentType string, body []byte, destination string,
+	options ...func(*frame.Frame) error) (err error) {
 	err = c.connection.Send(
 		destination,
 		contentType,
 		body,
-		stomp.SendOpt.Header("persistent", "true"),
+		options...,
 	)
 	return
 }
@@ -40,8 +54,48 @@ func (c *Connection) PublishByteArray(contentType string, body []byte, destinati
 // message to the specified destination. If the messaging server fails to
 // receive the message for any reason, the connection will close.
 func (c *Connection) Publish(m client.Message, destination string) (err error) {
+	c.publishes.begin()
+	defer c.publishes.end()
+
+	// Wait till the rate limit of the destination allows the message:
+	ctx := m.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	err = c.throttle(ctx, c.publishLimiters[destination], destination)
+	if err != nil {
+		return
+	}
+
+	err = c.publishHandler(m, destination)
+	return
+}
+
+// publishMessage is the last handler of the publish middleware chain. It rejects the messages
+// that don't match their schemas.
+func (c *Connection) publishMessage(m client.Message, destination string) (err error) {
+	err = c.validate(m, destination)
+	if err != nil {
+		return
+	}
+	err = c.publish(m, destination)
+	return
+}
+
+// publish sends a message to the messaging server, adding the given options to the default
+// options of the SEND frame.
+func (c *Connection) publish(m client.Message, destination string,
+	options ...func(*frame.Frame) error) (err error) {
 	var body []byte
 
+	// Send the headers of the message, followed by the ones that request the delivery options:
+	delivery, err := deliveryOptions(m.Delivery, time.Now())
+	if err != nil {
+		return
+	}
+	options = append(headerOptions(m.Header), options...)
+	options = append(options, delivery...)
+
 	// Our default contentType is "application/json"
 	contentType := m.ContentType
 	if contentType == "" {
@@ -50,23 +104,68 @@ func (c *Connection) Publish(m client.Message, destination string) (err error) {
 
 	// Check if we have a byteArray content, if we do, we will overide the
 	// object abstraction mechanism, and send the byteArray as a byte array.
-	if _, ok := m.Data["byteArray"]; ok {
-		// Check the content of byteArray, if it's really a byte array, send it
-		// as a byte array to server.
-		switch m.Data["byteArray"].(type) {
-		case []byte:
-			body = m.Data["byteArray"].([]byte)
-			err = c.PublishByteArray(contentType, body, destination)
+	if data, ok := m.Data["byteArray"].([]byte); ok {
+		body = data
+	} else {
+		// Marshal the message body (type: client.MessageData) into a byte array.
+		body, err = json.Marshal(m.Data)
+		if err != nil {
+			return
+		}
+	}
+
+	// Compress the body, unless the caller already encoded it:
+	bodyHeader := map[string]string{frame.ContentType: contentType}
+	for key, value := range m.Header {
+		if _, ok := bodyHeader[key]; !ok {
+			bodyHeader[key] = value
+		}
+	}
+	if _, ok := m.Header[client.ContentEncodingHeader]; !ok {
+		var encoding string
+		body, encoding, err = c.compress(m, body)
+		if err != nil {
+			return
+		}
+		if encoding != "" {
+			bodyHeader[client.ContentEncodingHeader] = encoding
+		}
+	}
+
+	// Encrypt the body:
+	if c.envelope != nil {
+		body, err = c.envelope.Encrypt(bodyHeader, body)
+		if err != nil {
 			return
 		}
 	}
 
-	// Marshal the message body (type: client.MessageData) into a byte array.
-	body, err = json.Marshal(m.Data)
+	// Store large bodies outside of the broker, before signing, so that the signature covers
+	// the key and the digest of the blob, and can be verified before fetching it:
+	body, err = c.storeBody(m, bodyHeader, body)
 	if err != nil {
 		return
 	}
 
-	err = c.PublishByteArray(contentType, body, destination)
+	// Sign the body and the headers that describe it:
+	if c.envelope != nil {
+		err = c.envelope.Sign(bodyHeader, body)
+		if err != nil {
+			return
+		}
+	}
+
+	// Send the headers that describe the body before the headers of the message, so that they
+	// take precedence:
+	var bodyOptions []func(*frame.Frame) error
+	for key, value := range bodyHeader {
+		if key == frame.ContentType || value == m.Header[key] {
+			continue
+		}
+		bodyOptions = append(bodyOptions, sendHeader(key, value))
+	}
+	options = append(bodyOptions, options...)
+
+	err = c.sendChunks(contentType, body, destination, options...)
 	return
 }
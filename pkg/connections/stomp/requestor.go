@@ -19,12 +19,15 @@ limitations under the License.
 package stomp
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/container-mgmt/messaging-library/pkg/client"
 	"github.com/go-stomp/stomp"
-	"github.com/golang/glog"
+	"github.com/go-stomp/stomp/frame"
 	"github.com/segmentio/ksuid"
 )
 
@@ -36,44 +39,144 @@ type Requestor struct {
 	requestsQueue  string
 	responsesQueue string
 
+	// send the correlation fields as headers instead of adding them to the request data
+	headerCorrelation bool
+
+	// middleware applied to the response handlers
+	middleware []client.ResponseMiddleware
+
+	// delivers the received messages through the subscription middleware of the connection
+	deliver client.SubscriptionCallback
+
 	// mapping between request ID and it's handler
-	pendingRequests map[string]client.ResponseHandler
+	pendingRequests map[string]*pendingRequest
+	pendingMutex    sync.Mutex
+
+	// tracks the pending requests, so that shutdown can wait for their responses
+	pending activity
+
+	// indicates that shutdown started or that the requestor was closed, so new requests aren't
+	// accepted
+	shuttingDown bool
+
+	// closed when the requestor is closed, so that Gather stops waiting
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	// closed when shutdown stops receiving responses, and when all the responses delivered to
+	// the requestor were handled
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// pendingRequest keeps the information needed to dispatch the responses of a request.
+type pendingRequest struct {
+	// callback is the handler of the responses of the request.
+	callback client.ResponseHandler
+
+	// gather indicates that the request was sent with Gather, so it expects multiple
+	// responses.
+	gather bool
+
+	// sent is the time when the request was sent, used to measure the round trip time.
+	sent time.Time
 }
 
 // NewRequestor creates a new requestor API to submit requests
 func (c *Connection) NewRequestor(spec client.RequestorSpec) (r client.Requestor, err error) {
+	var options []func(*frame.Frame) error
 
-	// Check if we already subscibe to this destination,
-	// We do not allow for multiple subscriptions for one destination.
-	if _, ok := c.subscriptions[spec.ResponsesQueue]; ok {
-		err = fmt.Errorf("Only one subscription per destination is allowed")
-		return
+	// Select the responses queue:
+	responsesQueue := spec.ResponsesQueue
+	if spec.PrivateResponsesQueue {
+		responsesQueue, options = c.privateQueue(spec)
 	}
 
 	// Subscribe to receive messages:
-	subscription, err := c.connection.Subscribe(spec.ResponsesQueue, stomp.AckAuto)
+	subscription, err := c.subscribe(responsesQueue, client.FlowControl{}, options...)
 	if err != nil {
 		return
 	}
 
-	// add the subscription to the connection
-	c.subscriptions[spec.ResponsesQueue] = subscription
-
 	stompRequestor := &Requestor{
 		conn:            c,
 		requestsQueue:   spec.RequestsQueue,
-		responsesQueue:  spec.ResponsesQueue,
+		responsesQueue:  responsesQueue,
 		subscription:    subscription,
-		pendingRequests: make(map[string]client.ResponseHandler, 0),
+		pendingRequests: make(map[string]*pendingRequest, 0),
+		stop:            make(chan struct{}),
+		done:            make(chan struct{}),
+		closed:          make(chan struct{}),
+
+		headerCorrelation: spec.HeaderCorrelation,
+		middleware:        spec.Middleware,
 	}
+	stompRequestor.deliver = client.ChainSubscription(
+		stompRequestor.handleResponse,
+		c.subscriptionMiddleware...,
+	)
+
+	// report the pending requests in the health report
+	c.addRequestor(stompRequestor)
 
 	// wait for responses in the background
+	c.deliveries.begin()
 	go stompRequestor.waitForResponses()
 
 	r = stompRequestor
 	return
 }
 
+// privateQueue generates the name of a unique responses queue for a requestor, and the options
+// of the subscription to it.
+func (c *Connection) privateQueue(spec client.RequestorSpec) (queue string,
+	options []func(*frame.Frame) error) {
+	id := ksuid.New().String()
+	server := c.connection.Server()
+	switch {
+	case spec.TemporaryQueuePrefix != "":
+		queue = spec.TemporaryQueuePrefix + id
+	case strings.HasPrefix(server, "ActiveMQ/"):
+		queue = "/temp-queue/" + id
+	case strings.HasPrefix(server, "RabbitMQ/") && c.envelope == nil:
+		// RabbitMQ replaces the reply-to header of the requests with the name of the queue
+		// that it creates, which the signature of the envelope doesn't allow, so connections
+		// with an envelope use a regular queue instead.
+		queue = "/temp-queue/" + id
+		options = rabbitmqReplyOptions(queue)
+	default:
+		// Fall back to a regular queue with a unique name, that the brokers delete once we
+		// unsubscribe: RabbitMQ and the internal server because of the auto-delete header,
+		// and ActiveMQ Artemis because it deletes the queues that it created automatically
+		// once they have no consumers and no messages.
+		base := spec.ResponsesQueue
+		if base == "" {
+			base = "/queue/responses"
+		}
+		queue = base + "-" + id
+		options = append(options, stomp.SubscribeOpt.Header(rabbitmqAutoDeleteHeader, "true"))
+	}
+	return
+}
+
+// rabbitmqReplyOptions returns the options of the subscription that receives the responses sent
+// to a RabbitMQ temporary queue. Temporary queues aren't subscribed to: RabbitMQ creates the
+// queue when it receives a request whose reply-to header names it, and delivers the responses
+// with a subscription header that contains that name. The STOMP library only delivers the
+// messages of the subscriptions that it created, so the requestor subscribes with that name as
+// identifier to an exclusive queue bound to the direct exchange, which receives nothing else and
+// which RabbitMQ deletes when the requestor unsubscribes.
+func rabbitmqReplyOptions(queue string) []func(*frame.Frame) error {
+	return []func(*frame.Frame) error{
+		stomp.SubscribeOpt.Id(queue),
+		func(f *frame.Frame) error {
+			f.Header.Set(frame.Destination, "/exchange/amq.direct/"+ksuid.New().String())
+			return nil
+		},
+	}
+}
+
 // Send sends a request to a specific destination
 // request is the message request
 // callback is the handler that will be called when the response is received
@@ -83,85 +186,328 @@ func (r *Requestor) Send(request client.Message, callback client.ResponseHandler
 	// generate request uuid
 	requestID = ksuid.New().String()
 
-	// Add request fields to message
-	request.Data["kind"] = "Request"
-	request.Data["requestID"] = requestID
-	request.Data["respondTo"] = r.responsesQueue
+	// keep the handler in the pending requests map before sending the request, so that we
+	// don't miss responses arriving early
+	err = r.addPendingRequest(requestID, &pendingRequest{
+		callback: client.ChainResponse(callback, r.middleware...),
+	})
+	if err != nil {
+		requestID = ""
+		return
+	}
 
 	// send the message
-	// TODO: don't use this function and directly us the stomp API
-	err = r.conn.Publish(request, r.requestsQueue)
+	err = r.publishRequest(request, requestID)
 	if err != nil {
+		r.removePendingRequest(requestID)
 		requestID = ""
 	}
 
-	// keep the handler in the pending requests map
-	r.pendingRequests[requestID] = callback
+	return
+}
+
+// Gather publishes a request once and collects the responses of all the responders that reply
+// to it, until the timeout expires or the expected number of responses is reached. Without an
+// expected number, it stops as soon as the quorum is reached.
+func (r *Requestor) Gather(request client.Message, spec client.GatherSpec) (gathered []client.Response, err error) {
+	// Check that collecting responses always stops, and that the quorum can be reached:
+	if spec.Timeout <= 0 {
+		err = fmt.Errorf("Gather requires a timeout")
+		return
+	}
+	if spec.Expected > 0 && spec.Quorum > spec.Expected {
+		err = fmt.Errorf(
+			"Quorum %d is larger than the %d expected responses",
+			spec.Quorum,
+			spec.Expected,
+		)
+		return
+	}
+
+	// generate request uuid
+	requestID := ksuid.New().String()
+
+	// Hand the responses to this function, unless it already returned.
+	responses := make(chan client.Response)
+	done := make(chan struct{})
+	callback := func(response client.Message, requestID string) error {
+		responderID, _ := correlationField(response, client.ResponderIDHeader, "responderID")
+		select {
+		case responses <- client.Response{ResponderID: responderID, Message: response}:
+		case <-done:
+		}
+		return nil
+	}
+
+	err = r.addPendingRequest(requestID, &pendingRequest{
+		callback: client.ChainResponse(callback, r.middleware...),
+		gather:   true,
+	})
+	if err != nil {
+		return
+	}
+	defer func() {
+		r.removePendingRequest(requestID)
+		close(done)
+	}()
+
+	// send the message
+	err = r.publishRequest(request, requestID)
+	if err != nil {
+		return
+	}
+
+	// Stop at the expected number of responses, or at the quorum if no number is expected:
+	stop := spec.Expected
+	if stop <= 0 {
+		stop = spec.Quorum
+	}
+
+	timer := time.NewTimer(spec.Timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case response := <-responses:
+			gathered = append(gathered, response)
+			if stop > 0 && len(gathered) >= stop {
+				return
+			}
+		case <-timer.C:
+			if len(gathered) < spec.Quorum {
+				err = fmt.Errorf(
+					"Quorum not reached for request id %s: received %d of %d responses",
+					requestID,
+					len(gathered),
+					spec.Quorum,
+				)
+			}
+			return
+		case <-r.closed:
+			err = fmt.Errorf("Requestor was closed before request id %s finished", requestID)
+			return
+		}
+	}
+}
+
+// publishRequest adds the request fields to the message and sends it to the requests queue.
+func (r *Requestor) publishRequest(request client.Message, requestID string) (err error) {
+	// Add request fields to message headers
+	request.Header = copyHeader(request.Header)
+	request.Header[client.KindHeader] = "Request"
+	request.Header[client.CorrelationIDHeader] = requestID
+	request.Header[client.ReplyToHeader] = r.responsesQueue
 
+	// Add request fields to message, unless we were asked to leave the data untouched
+	if !r.headerCorrelation {
+		// Requests without data still need a body to carry the request fields
+		if request.Data == nil {
+			request.Data = client.MessageData{}
+		}
+		request.Data["kind"] = "Request"
+		request.Data["requestID"] = requestID
+		request.Data["respondTo"] = r.responsesQueue
+	}
+
+	err = r.conn.Publish(request, r.requestsQueue)
 	return
 }
 
+func (r *Requestor) addPendingRequest(requestID string, pending *pendingRequest) error {
+	r.pendingMutex.Lock()
+	defer r.pendingMutex.Unlock()
+
+	// Don't accept new requests once shutdown started.
+	if r.shuttingDown {
+		return fmt.Errorf("Requestor is closed or shutting down")
+	}
+
+	pending.sent = time.Now()
+	r.pendingRequests[requestID] = pending
+	r.pending.begin()
+	r.conn.metrics.RequestStarted(r.requestsQueue)
+	return nil
+}
+
+func (r *Requestor) removePendingRequest(requestID string) {
+	r.pendingMutex.Lock()
+	defer r.pendingMutex.Unlock()
+
+	if _, ok := r.pendingRequests[requestID]; ok {
+		delete(r.pendingRequests, requestID)
+		r.pending.end()
+		r.conn.metrics.RequestFinished(r.requestsQueue)
+	}
+}
+
 func (r *Requestor) waitForResponses() {
-	var data client.MessageData
-	for message := range r.subscription.C {
-		// Try to unmarshal the byte array coming from the broker into a
-		// message body of type map[string]interface{}
-		err := json.Unmarshal(message.Body, &data)
-		if err != nil {
-			// log the error and ignore message
-			glog.Warningf(
-				"failed to unmarshall message received from destination %s. Ignoring",
-				r.responsesQueue)
-			continue
-		}
+	defer r.conn.deliveries.end()
+	defer close(r.done)
 
-		// Validate message is a response
-		if kind, ok := data["kind"]; !ok || kind.(string) != "Response" {
-			// ignore message
-			glog.Warningf(
-				"Message of non 'Response' kind received on response queue %s. Ignoring",
-				r.responsesQueue)
-			continue
+	messages := r.subscription.C
+	for {
+		message := r.conn.next(messages, r.stop)
+		if message == nil {
+			return
 		}
 
-		// Parse requestId
-		id, ok := data["requestID"]
-		if !ok {
-			// ignore message
-			glog.Warningf(
-				"Response missing 'requestID' field received on response queue %s. Ignoring",
-				r.responsesQueue)
+		// Wait till all the chunks of the response are received:
+		message, parts := r.conn.reassemble(message, r.responsesQueue, client.FlowControl{})
+		if message == nil {
 			continue
 		}
 
-		// Validate requestID
-		callback, ok := r.pendingRequests[id.(string)]
-		if !ok {
-			// ignore message
-			glog.Warningf(
-				"Received response to non existing request id %s. Ignoring",
-				id.(string))
+		// Try to unmarshal the byte array coming from the broker into a
+		// message body of type map[string]interface{}, responses correlated
+		// using headers may have other kinds of bodies.
+		response, blob, _ := r.conn.decodeMessage(message)
+		r.conn.track(message.Err, r.responsesQueue)
+		if r.conn.checkReceived(&response, r.responsesQueue) {
 			continue
 		}
 
-		// call the relevant response handler
-		callback(
-			client.Message{
-				Data: data,
-				Err:  message.Err},
-			id.(string))
+		r.deliver(response, r.responsesQueue)
+		r.conn.acknowledge(parts, r.responsesQueue, client.FlowControl{}, blob)
+	}
+}
+
+// handleResponse dispatches a response to the handler of its request.
+func (r *Requestor) handleResponse(response client.Message, destination string) error {
+	if response.Err != nil {
+		// log the error, messages that can't be verified are never handled
+		r.conn.logger.Warn(
+			"Received error on responses queue, ignoring",
+			append(messageFields(response, destination), "error", response.Err)...)
+		return nil
+	}
+
+	_, correlationHeader := response.Header[client.CorrelationIDHeader]
+	if _, raw := response.Data["byteArray"].([]byte); raw && !correlationHeader {
+		// log the error and ignore message
+		r.conn.logger.Warn(
+			"Failed to unmarshall message received on responses queue, ignoring",
+			messageFields(response, destination)...)
+		return nil
+	}
 
+	// Validate message is a response
+	if kind, _ := correlationField(response, client.KindHeader, "kind"); kind != "Response" {
+		// ignore message
+		r.conn.logger.Warn(
+			"Message of non 'Response' kind received on responses queue, ignoring",
+			messageFields(response, destination)...)
+		return nil
+	}
+
+	// Parse requestId
+	id, ok := correlationField(response, client.CorrelationIDHeader, "requestID")
+	if !ok {
+		// ignore message
+		r.conn.logger.Warn(
+			"Response missing 'requestID' field received on responses queue, ignoring",
+			messageFields(response, destination)...)
+		return nil
+	}
+
+	// Validate requestID
+	r.pendingMutex.Lock()
+	pending, ok := r.pendingRequests[id]
+	if ok && !pending.gather {
 		// remove the pending request
-		// TBD - in the future we would like to keep the resuest to allow
-		// a series of responses for a single request.
-		// Currently only one response is supported
-		delete(r.pendingRequests, id.(string))
+		// Only one response is supported for requests sent with Send, requests that
+		// expect a series of responses are sent with Gather.
+		delete(r.pendingRequests, id)
 	}
+	r.pendingMutex.Unlock()
+	if ok && !pending.gather {
+		// The pending request is done once its handler returns.
+		defer r.pending.end()
+		r.conn.metrics.RequestFinished(r.requestsQueue)
+	}
+	if !ok {
+		// ignore message
+		r.conn.logger.Warn(
+			"Received response to non existing request, ignoring",
+			append(messageFields(response, destination), client.RequestIDField, id)...)
+		return nil
+	}
+
+	r.conn.metrics.ResponseReceived(r.requestsQueue, time.Since(pending.sent))
+
+	// call the relevant response handler
+	return pending.callback(response, id)
 }
 
-// Close closes the Requestor
+// Close closes the Requestor. It fails the pending requests: the handlers of the requests sent
+// with Send receive a response with an error, and Gather returns an error. Then it stops
+// receiving responses, which makes the broker delete the private responses queue, unless it is
+// a temporary queue that is deleted with the connection.
 func (r *Requestor) Close() (err error) {
+	r.failPending()
+	r.conn.removeRequestor(r)
 	err = r.conn.Unsubscribe(r.responsesQueue)
 	r.subscription = nil
 	return
 }
+
+// failPending stops accepting new requests, and finishes the pending ones with an error.
+func (r *Requestor) failPending() {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+	})
+
+	// Remove the requests sent with Send, Gather removes its own requests when it returns:
+	r.stopRequests()
+	r.pendingMutex.Lock()
+	failed := make(map[string]*pendingRequest)
+	for id, pending := range r.pendingRequests {
+		if !pending.gather {
+			failed[id] = pending
+			delete(r.pendingRequests, id)
+		}
+	}
+	r.pendingMutex.Unlock()
+
+	for id, pending := range failed {
+		pending.callback(client.Message{
+			Err: fmt.Errorf("Requestor was closed before request id %s finished", id),
+		}, id)
+		r.pending.end()
+		r.conn.metrics.RequestFinished(r.requestsQueue)
+	}
+}
+
+// Shutdown closes the Requestor gracefully, waiting for the responses of the pending requests. If
+// the context expires before that, the requests still pending fail as with Close.
+func (r *Requestor) Shutdown(ctx context.Context) (err error) {
+	// Stop accepting new requests, and wait for the responses of the pending ones:
+	r.stopRequests()
+	err = r.pending.wait(ctx)
+
+	// Stop receiving responses, also when out of time, without waiting for the broker to
+	// confirm it, and wait for the ones already received:
+	r.conn.removeRequestor(r)
+	_, unsubscribeErr := r.conn.unsubscribeAsync(r.responsesQueue)
+	r.failPending()
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+	if err == nil {
+		err = unsubscribeErr
+	}
+	if err != nil {
+		return
+	}
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return
+}
+
+// stopRequests stops accepting new requests.
+func (r *Requestor) stopRequests() {
+	r.pendingMutex.Lock()
+	r.shuttingDown = true
+	r.pendingMutex.Unlock()
+}
@@ -0,0 +1,552 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-stomp/stomp/frame"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// Request handler that echoes the request back.
+func echoHandler(request client.Message) (client.Message, error) {
+	return client.Message{Data: client.MessageData{"value": request.Data["value"]}}, nil
+}
+
+func TestGather(t *testing.T) {
+	// Get unique destinations for the test.
+	requests, _ := DestinationName()
+	responses, _ := DestinationName()
+
+	// Start two responders, each one on its own connection.
+	for _, id := range []string{"first", "second"} {
+		c, err := NewConnection(&client.ConnectionSpec{})
+		if err != nil {
+			t.Fatalf("Fail to open connection: %s", err.Error())
+		}
+		defer c.Close()
+
+		_, err = c.NewResponder(client.ResponderSpec{
+			RequestsQueue: requests,
+			Callback:      echoHandler,
+			ID:            id,
+		})
+		if err != nil {
+			t.Fatalf("Fail to create responder: %s", err.Error())
+		}
+	}
+
+	// Create the requestor.
+	c, err := NewConnection(&client.ConnectionSpec{})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+	r, err := c.NewRequestor(client.RequestorSpec{
+		RequestsQueue:  requests,
+		ResponsesQueue: responses,
+	})
+	if err != nil {
+		t.Fatalf("Fail to create requestor: %s", err.Error())
+	}
+
+	// Wait till the subscriptions reach the server.
+	time.Sleep(100 * time.Millisecond)
+
+	gathered, err := r.Gather(
+		client.Message{Data: client.MessageData{"value": 42.0}},
+		client.GatherSpec{Timeout: 5 * time.Second, Expected: 2},
+	)
+	if err != nil {
+		t.Fatalf("Gather exited with an error: %s", err.Error())
+	}
+	if len(gathered) != 2 {
+		t.Fatalf("Received %d responses expected 2", len(gathered))
+	}
+
+	var ids []string
+	for _, response := range gathered {
+		ids = append(ids, response.ResponderID)
+		if response.Message.Data["value"] != 42.0 {
+			t.Errorf("Received %v expected 42", response.Message.Data["value"])
+		}
+	}
+	sort.Strings(ids)
+	if ids[0] != "first" || ids[1] != "second" {
+		t.Errorf("Received responses from %v expected [first second]", ids)
+	}
+
+	// With an expected count, reaching the quorum doesn't stop the collection, and missing
+	// responders aren't an error once the quorum is reached.
+	start := time.Now()
+	gathered, err = r.Gather(
+		client.Message{Data: client.MessageData{"value": 42.0}},
+		client.GatherSpec{Timeout: 500 * time.Millisecond, Expected: 3, Quorum: 1},
+	)
+	if err != nil {
+		t.Fatalf("Gather exited with an error: %s", err.Error())
+	}
+	if len(gathered) != 2 {
+		t.Errorf("Received %d responses expected 2", len(gathered))
+	}
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+		t.Errorf("Gather returned after %s, before the timeout", elapsed)
+	}
+
+	// Without an expected count, the collection stops at the quorum.
+	gathered, err = r.Gather(
+		client.Message{Data: client.MessageData{"value": 42.0}},
+		client.GatherSpec{Timeout: 5 * time.Second, Quorum: 1},
+	)
+	if err != nil {
+		t.Fatalf("Gather exited with an error: %s", err.Error())
+	}
+	if len(gathered) != 1 {
+		t.Errorf("Received %d responses expected 1", len(gathered))
+	}
+}
+
+func TestGatherQuorumNotReached(t *testing.T) {
+	// Get unique destinations for the test.
+	requests, _ := DestinationName()
+	responses, _ := DestinationName()
+
+	// Create a requestor without any responder.
+	c, err := NewConnection(&client.ConnectionSpec{})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+	r, err := c.NewRequestor(client.RequestorSpec{
+		RequestsQueue:  requests,
+		ResponsesQueue: responses,
+	})
+	if err != nil {
+		t.Fatalf("Fail to create requestor: %s", err.Error())
+	}
+
+	_, err = r.Gather(
+		client.Message{Data: client.MessageData{"value": 42.0}},
+		client.GatherSpec{Timeout: 100 * time.Millisecond, Quorum: 1},
+	)
+	if err == nil {
+		t.Error("Gather succeeded without reaching the quorum")
+	}
+
+	// Specs that may never stop, or that can't reach the quorum, are rejected.
+	for _, spec := range []client.GatherSpec{
+		{Expected: 1},
+		{Quorum: 1},
+		{Timeout: 100 * time.Millisecond, Expected: 1, Quorum: 2},
+	} {
+		_, err = r.Gather(client.Message{Data: client.MessageData{"value": 42.0}}, spec)
+		if err == nil {
+			t.Errorf("Gather accepted spec %+v", spec)
+		}
+	}
+}
+
+func TestPrivateResponsesQueue(t *testing.T) {
+	// Get a unique destination for the test.
+	requests, _ := DestinationName()
+
+	// Create and open a connection.
+	c, err := NewConnection(&client.ConnectionSpec{})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+
+	_, err = c.NewResponder(client.ResponderSpec{
+		RequestsQueue: requests,
+		Callback:      echoHandler,
+	})
+	if err != nil {
+		t.Fatalf("Fail to create responder: %s", err.Error())
+	}
+
+	// Create two requestors sharing the same connection, each one with its own responses queue.
+	received := make(chan float64, 2)
+	for _, value := range []float64{1, 2} {
+		r, err := c.NewRequestor(client.RequestorSpec{
+			RequestsQueue:         requests,
+			PrivateResponsesQueue: true,
+		})
+		if err != nil {
+			t.Fatalf("Fail to create requestor: %s", err.Error())
+		}
+		// [ When using artimisMQ we can close ] defer r.Close()
+
+		expected := value
+		_, err = r.Send(
+			client.Message{Data: client.MessageData{"value": value}},
+			func(response client.Message, requestID string) error {
+				if response.Data["value"] != expected {
+					t.Errorf("Received %v expected %v", response.Data["value"], expected)
+				}
+				received <- expected
+				return nil
+			},
+		)
+		if err != nil {
+			t.Fatalf("Fail to send request: %s", err.Error())
+		}
+	}
+
+	for n := 0; n < 2; n++ {
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for responses")
+		}
+	}
+}
+
+func TestHeaderCorrelation(t *testing.T) {
+	// Get unique destinations for the test.
+	requests, _ := DestinationName()
+	responses, _ := DestinationName()
+
+	// Create and open a connection.
+	c, err := NewConnection(&client.ConnectionSpec{})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+
+	// Create a responder that checks that the request body wasn't modified.
+	_, err = c.NewResponder(client.ResponderSpec{
+		RequestsQueue: requests,
+		Callback: func(request client.Message) (client.Message, error) {
+			body, _ := request.Data["byteArray"].([]byte)
+			if string(body) != "plain text" {
+				t.Errorf("Received body '%s' expected 'plain text'", body)
+			}
+			return client.Message{
+				ContentType: "text/plain",
+				Data:        client.MessageData{"byteArray": []byte("plain response")},
+			}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Fail to create responder: %s", err.Error())
+	}
+
+	r, err := c.NewRequestor(client.RequestorSpec{
+		RequestsQueue:     requests,
+		ResponsesQueue:    responses,
+		HeaderCorrelation: true,
+	})
+	if err != nil {
+		t.Fatalf("Fail to create requestor: %s", err.Error())
+	}
+
+	received := make(chan string, 1)
+	requestID, err := r.Send(
+		client.Message{
+			ContentType: "text/plain",
+			Data:        client.MessageData{"byteArray": []byte("plain text")},
+		},
+		func(response client.Message, requestID string) error {
+			if response.Header[client.CorrelationIDHeader] != requestID {
+				t.Errorf("Response is not correlated to request id %s", requestID)
+			}
+			body, _ := response.Data["byteArray"].([]byte)
+			received <- string(body)
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("Fail to send request: %s", err.Error())
+	}
+
+	select {
+	case body := <-received:
+		if body != "plain response" {
+			t.Errorf("Received response '%s' to request id %s expected 'plain response'", body, requestID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for response")
+	}
+}
+
+func TestEchoRequest(t *testing.T) {
+	// Get unique destinations for the test.
+	requests, _ := DestinationName()
+	responses, _ := DestinationName()
+
+	// Create and open a connection.
+	c, err := NewConnection(&client.ConnectionSpec{})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+
+	// Create a responder that sends the received request back, with the headers assigned by
+	// the broker.
+	_, err = c.NewResponder(client.ResponderSpec{
+		RequestsQueue: requests,
+		Callback: func(request client.Message) (client.Message, error) {
+			if request.Header[frame.MessageId] == "" {
+				t.Errorf("Request doesn't have the '%s' header", frame.MessageId)
+			}
+			return request, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Fail to create responder: %s", err.Error())
+	}
+
+	r, err := c.NewRequestor(client.RequestorSpec{
+		RequestsQueue:  requests,
+		ResponsesQueue: responses,
+	})
+	if err != nil {
+		t.Fatalf("Fail to create requestor: %s", err.Error())
+	}
+
+	// Send a request without data, the correlation fields are added to an empty body.
+	received := make(chan string, 1)
+	requestID, err := r.Send(
+		client.Message{},
+		func(response client.Message, requestID string) error {
+			received <- response.Header[client.CorrelationIDHeader]
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("Fail to send request: %s", err.Error())
+	}
+
+	select {
+	case id := <-received:
+		if id != requestID {
+			t.Errorf("Received response to request id '%s' expected '%s'", id, requestID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for response")
+	}
+}
+
+func TestBrokerHeaders(t *testing.T) {
+	// The headers assigned by the broker to a received message aren't sent again.
+	options := headerOptions(map[string]string{
+		frame.Ack:          "1",
+		frame.MessageId:    "2",
+		frame.Subscription: "3",
+		frame.Receipt:      "4",
+		"custom":           "value",
+	})
+	f := frame.New(frame.SEND)
+	for _, option := range options {
+		err := option(f)
+		if err != nil {
+			t.Fatalf("Fail to apply header option: %s", err.Error())
+		}
+	}
+	for _, name := range []string{frame.Ack, frame.MessageId, frame.Subscription, frame.Receipt} {
+		if value, ok := f.Header.Contains(name); ok {
+			t.Errorf("Header '%s' with value '%s' shouldn't be sent", name, value)
+		}
+	}
+	if f.Header.Get("custom") != "value" {
+		t.Errorf("Header 'custom' is '%s' expected 'value'", f.Header.Get("custom"))
+	}
+}
+
+func TestClosePendingRequests(t *testing.T) {
+	// The internal server doesn't confirm unsubscriptions, so closing a requestor blocks.
+	if UseInternalServer {
+		t.Skip("skipping test when running using internal server.")
+	}
+
+	// Get a unique destination for the test, without a responder.
+	requests, _ := DestinationName()
+
+	// Create and open a connection.
+	c, err := NewConnection(&client.ConnectionSpec{})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+
+	r, err := c.NewRequestor(client.RequestorSpec{
+		RequestsQueue:         requests,
+		PrivateResponsesQueue: true,
+	})
+	if err != nil {
+		t.Fatalf("Fail to create requestor: %s", err.Error())
+	}
+
+	received := make(chan error, 1)
+	_, err = r.Send(
+		client.Message{Data: client.MessageData{"value": 1}},
+		func(response client.Message, requestID string) error {
+			received <- response.Err
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("Fail to send request: %s", err.Error())
+	}
+
+	err = r.Close()
+	if err != nil {
+		t.Fatalf("Fail to close requestor: %s", err.Error())
+	}
+	select {
+	case err = <-received:
+		if err == nil {
+			t.Error("Expected an error for the pending request")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the pending request to fail")
+	}
+
+	// New requests aren't accepted:
+	_, err = r.Send(
+		client.Message{Data: client.MessageData{"value": 2}},
+		func(response client.Message, requestID string) error {
+			return nil
+		},
+	)
+	if err == nil {
+		t.Error("Expected an error sending a request after closing the requestor")
+	}
+}
+
+func TestShutdownPendingRequests(t *testing.T) {
+	// Get a unique destination for the test.
+	requests, _ := DestinationName()
+	responses, _ := DestinationName()
+
+	// Start a slow responder on its own connection.
+	responder, err := NewConnection(&client.ConnectionSpec{})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer responder.Close()
+	_, err = responder.NewResponder(client.ResponderSpec{
+		RequestsQueue: requests,
+		Callback: func(request client.Message) (client.Message, error) {
+			time.Sleep(200 * time.Millisecond)
+			return echoHandler(request)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Fail to create responder: %s", err.Error())
+	}
+
+	// Create the requestor.
+	c, err := NewConnection(&client.ConnectionSpec{})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	r, err := c.NewRequestor(client.RequestorSpec{
+		RequestsQueue:  requests,
+		ResponsesQueue: responses,
+	})
+	if err != nil {
+		t.Fatalf("Fail to create requestor: %s", err.Error())
+	}
+
+	// Wait till the subscriptions reach the server.
+	time.Sleep(100 * time.Millisecond)
+
+	received := make(chan error, 1)
+	_, err = r.Send(
+		client.Message{Data: client.MessageData{"value": 1.0}},
+		func(response client.Message, requestID string) error {
+			received <- response.Err
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("Fail to send request: %s", err.Error())
+	}
+
+	// The shutdown of the connection waits for the response of the pending request.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = c.Shutdown(ctx)
+	if err != nil {
+		t.Errorf("Shutdown exited with an error: %s", err.Error())
+	}
+	select {
+	case err = <-received:
+		if err != nil {
+			t.Errorf("Received error: %s", err.Error())
+		}
+	default:
+		t.Error("Shutdown returned before the response was received")
+	}
+}
+
+func TestRequestorShutdownTimeout(t *testing.T) {
+	// Get a unique destination for the test, without a responder.
+	requests, _ := DestinationName()
+	responses, _ := DestinationName()
+
+	c, err := NewConnection(&client.ConnectionSpec{})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+	r, err := c.NewRequestor(client.RequestorSpec{
+		RequestsQueue:  requests,
+		ResponsesQueue: responses,
+	})
+	if err != nil {
+		t.Fatalf("Fail to create requestor: %s", err.Error())
+	}
+
+	received := make(chan error, 1)
+	_, err = r.Send(
+		client.Message{Data: client.MessageData{"value": 1.0}},
+		func(response client.Message, requestID string) error {
+			received <- response.Err
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("Fail to send request: %s", err.Error())
+	}
+
+	// When out of time the requestor unsubscribes anyway, and the pending request fails.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = r.Shutdown(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected the error of the context, got %v", err)
+	}
+	select {
+	case err = <-received:
+		if err == nil {
+			t.Error("Expected an error for the pending request")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the pending request to fail")
+	}
+	if len(c.Health().Subscriptions) != 0 {
+		t.Errorf("Expected no subscriptions, got %v", c.Health().Subscriptions)
+	}
+}
@@ -19,12 +19,11 @@ limitations under the License.
 package stomp
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
 
 	"github.com/container-mgmt/messaging-library/pkg/client"
 	"github.com/go-stomp/stomp"
-	"github.com/golang/glog"
+	"github.com/segmentio/ksuid"
 )
 
 // Responder is an implementation of Responder interface
@@ -34,34 +33,53 @@ type Responder struct {
 	subscription  *stomp.Subscription
 	requestsQueue string
 	callback      client.RequestHandler
+	id            string
+
+	// delivers the received messages through the subscription middleware of the connection
+	deliver client.SubscriptionCallback
+
+	// limits the requests received, and the channel where they are delivered
+	flow     client.FlowControl
+	messages <-chan *stomp.Message
+
+	// closed when shutdown stops receiving requests, and when all the requests delivered to
+	// the responder were handled
+	stop chan struct{}
+	done chan struct{}
 }
 
 // NewResponder created a new responder with a specific destination
 func (c *Connection) NewResponder(spec client.ResponderSpec) (r client.Responder, err error) {
-	// Check if we already subscibe to this destination,
-	// We do not allow for multiple subscriptions for one destination.
-	if _, ok := c.subscriptions[spec.RequestsQueue]; ok {
-		err = fmt.Errorf("Only one subscription per destination is allowed")
-		return
-	}
-
 	// Subscribe to receive messages:
-	subscription, err := c.connection.Subscribe(spec.RequestsQueue, stomp.AckAuto)
+	subscription, err := c.subscribe(spec.RequestsQueue, spec.FlowControl)
 	if err != nil {
 		return
 	}
 
-	// add the subscription to the connection
-	c.subscriptions[spec.RequestsQueue] = subscription
+	// Generate an identity if the caller didn't provide one:
+	id := spec.ID
+	if id == "" {
+		id = ksuid.New().String()
+	}
 
 	stompResponder := &Responder{
 		conn:          c,
 		requestsQueue: spec.RequestsQueue,
 		subscription:  subscription,
-		callback:      spec.Callback,
+		callback:      client.ChainRequest(spec.Callback, spec.Middleware...),
+		id:            id,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+		flow:          spec.FlowControl,
+		messages:      c.receive(subscription, spec.RequestsQueue, spec.FlowControl),
 	}
+	stompResponder.deliver = client.ChainSubscription(
+		stompResponder.handleRequest,
+		c.subscriptionMiddleware...,
+	)
 
 	// wait for requests in the background
+	c.deliveries.begin()
 	go stompResponder.waitForRequests()
 
 	r = stompResponder
@@ -69,68 +87,129 @@ func (c *Connection) NewResponder(spec client.ResponderSpec) (r client.Responder
 }
 
 func (r *Responder) waitForRequests() {
-	var data client.MessageData
-	for message := range r.subscription.C {
-		// Try to unmarshal the byte array coming from the broker into a
-		// message body of type map[string]interface{}
-		err := json.Unmarshal(message.Body, &data)
-		if err != nil {
-			// log the error and ignore message
-			glog.Warningf(
-				"failed to unmarshall message received from destination %s. Ignoring",
-				r.requestsQueue)
-			continue
+	defer r.conn.deliveries.end()
+	defer close(r.done)
+
+	for {
+		message := r.conn.next(r.messages, r.stop)
+		if message == nil {
+			return
 		}
 
-		// Validate message is a request
-		if kind, ok := data["kind"]; !ok || kind.(string) != "Request" {
-			// ignore message
-			glog.Warningf(
-				"Message of non 'Request' kind received on requests queue %s. Ignoring",
-				r.requestsQueue)
+		// Wait till all the chunks of the request are received:
+		complete, parts := r.conn.reassemble(message, r.requestsQueue, r.flow)
+		if complete == nil {
 			continue
 		}
+		message = complete
 
-		// Parse requestId
-		id, ok := data["requestID"]
-		if !ok {
-			// ignore message
-			glog.Warningf(
-				"Request missing 'requestID' field received on requests queue %s. Ignoring",
-				r.requestsQueue)
+		// Try to unmarshal the byte array coming from the broker into a
+		// message body of type map[string]interface{}, requests correlated
+		// using headers may have other kinds of bodies.
+		request, blob, _ := r.conn.decodeMessage(message)
+		r.conn.track(message.Err, r.requestsQueue)
+		if r.conn.checkReceived(&request, r.requestsQueue) {
+			r.conn.acknowledge(parts, r.requestsQueue, r.flow, blob)
 			continue
 		}
-
-		// Parse respondTo
-		respondTo, ok := data["respondTo"]
-		if !ok {
-			// ignore message
-			glog.Warningf(
-				"Request missing 'respondTo' field received on requests queue %s. Ignoring",
-				r.requestsQueue)
+		if message.Err == nil && !r.conn.throttleDelivery(r.flow.Limiter, r.requestsQueue) {
 			continue
 		}
 
-		// call callback function
-		response, err := r.callback(
-			client.Message{
-				Data: data,
-				Err:  message.Err})
+		r.deliver(request, r.requestsQueue)
+		r.conn.acknowledge(parts, r.requestsQueue, r.flow, blob)
+	}
+}
 
-		if err != nil {
-			continue
+// handleRequest calls the callback of the responder for a request, and sends the response.
+func (r *Responder) handleRequest(request client.Message, destination string) (err error) {
+	if request.Err != nil {
+		// log the error, messages that can't be verified are never handled
+		r.conn.logger.Warn(
+			"Received error on requests queue, ignoring",
+			append(messageFields(request, destination), "error", request.Err)...)
+		return
+	}
+
+	_, correlationHeader := request.Header[client.CorrelationIDHeader]
+	if _, raw := request.Data["byteArray"].([]byte); raw && !correlationHeader {
+		// log the error and ignore message
+		r.conn.logger.Warn(
+			"Failed to unmarshall message received on requests queue, ignoring",
+			messageFields(request, destination)...)
+		return
+	}
+
+	// Validate message is a request
+	if kind, _ := correlationField(request, client.KindHeader, "kind"); kind != "Request" {
+		// ignore message
+		r.conn.logger.Warn(
+			"Message of non 'Request' kind received on requests queue, ignoring",
+			messageFields(request, destination)...)
+		return
+	}
+
+	// Parse requestId
+	id, ok := correlationField(request, client.CorrelationIDHeader, "requestID")
+	if !ok {
+		// ignore message
+		r.conn.logger.Warn(
+			"Request missing 'requestID' field received on requests queue, ignoring",
+			messageFields(request, destination)...)
+		return
+	}
+
+	// Parse respondTo
+	respondTo, ok := correlationField(request, client.ReplyToHeader, "respondTo")
+	if !ok {
+		// ignore message
+		r.conn.logger.Warn(
+			"Request missing 'respondTo' field received on requests queue, ignoring",
+			append(messageFields(request, destination), client.RequestIDField, id)...)
+		return
+	}
+
+	// Requestors that add the correlation fields to the request data expect them also
+	// in the response data.
+	_, bodyCorrelation := request.Data["requestID"].(string)
+
+	// call callback function
+	response, err := r.callback(request)
+
+	if err != nil {
+		return
+	}
+
+	// Add response fields to message headers
+	response.Header = copyHeader(response.Header)
+	response.Header[client.KindHeader] = "Response"
+	response.Header[client.CorrelationIDHeader] = id
+	response.Header[client.ResponderIDHeader] = r.id
+
+	// Continue the context of the request, for example its trace
+	if response.Context == nil {
+		response.Context = request.Context
+	}
+
+	if bodyCorrelation {
+		// Responses without data still need a body to carry the response fields
+		if response.Data == nil {
+			response.Data = client.MessageData{}
 		}
 
 		// Add response kind field to message
 		response.Data["kind"] = "Response"
 
 		// Add requestID field to message
-		response.Data["requestID"] = id.(string)
+		response.Data["requestID"] = id
 
-		// publish the response
-		err = r.conn.Publish(response, respondTo.(string))
-		continue
+		// Add responderID field to message
+		response.Data["responderID"] = r.id
 	}
+
+	// publish the response
+	err = r.conn.Publish(response, respondTo)
+	return
 }
 
 // Close closes the Responder
@@ -139,3 +218,22 @@ func (r *Responder) Close() (err error) {
 	r.subscription = nil
 	return
 }
+
+// Shutdown closes the Responder gracefully, waiting for the requests already delivered to be
+// handled and their responses sent.
+func (r *Responder) Shutdown(ctx context.Context) (err error) {
+	// Stop receiving requests, without waiting for the broker to confirm it:
+	_, err = r.conn.unsubscribeAsync(r.requestsQueue)
+	if err != nil {
+		return
+	}
+	close(r.stop)
+
+	// Wait for the requests already received:
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return
+}
@@ -0,0 +1,207 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/go-stomp/stomp"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// activity counts the operations in progress, so that shutdown can wait for them to finish.
+type activity struct {
+	mutex sync.Mutex
+	count int
+
+	// closed when the count reaches zero, created only when someone waits
+	idle chan struct{}
+}
+
+// begin records the start of an operation.
+func (a *activity) begin() {
+	a.mutex.Lock()
+	a.count++
+	a.mutex.Unlock()
+}
+
+// end records the end of an operation.
+func (a *activity) end() {
+	a.mutex.Lock()
+	a.count--
+	if a.count == 0 && a.idle != nil {
+		close(a.idle)
+		a.idle = nil
+	}
+	a.mutex.Unlock()
+}
+
+// wait waits till there are no operations in progress, or till the context expires.
+func (a *activity) wait(ctx context.Context) error {
+	a.mutex.Lock()
+	if a.count == 0 {
+		a.mutex.Unlock()
+		return nil
+	}
+	if a.idle == nil {
+		a.idle = make(chan struct{})
+	}
+	idle := a.idle
+	a.mutex.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown closes the connection gracefully. It waits for the responses of the requests pending in
+// its requestors, stops the deliveries, waits for the messages already delivered to be handled
+// and for the messages being published to be sent, and then disconnects. If the context expires before that, the connection is closed immediately and the
+// error of the context is returned.
+//
+// The deliveries are stopped locally, without waiting for the broker to confirm the
+// unsubscriptions, as not all brokers do. The messages that arrive after that aren't delivered,
+// and the broker sends them again if the subscription acknowledges messages. The unsubscriptions
+// that the broker didn't confirm before disconnecting are reported with ReceiptTimeout events.
+func (c *Connection) Shutdown(ctx context.Context) (err error) {
+	// Sanity check connection.
+	if c.connection == nil {
+		err = fmt.Errorf("Connection is closed")
+		return
+	}
+
+	// Stop accepting new requests, and wait for the responses of the pending ones before
+	// stopping the deliveries, as they arrive through them:
+	requestors := c.currentRequestors()
+	for _, requestor := range requestors {
+		requestor.stopRequests()
+	}
+	for _, requestor := range requestors {
+		err = requestor.pending.wait(ctx)
+		if err != nil {
+			break
+		}
+	}
+
+	// Stop accepting new subscriptions and stop the delivery loops, and take the list of the
+	// current subscriptions:
+	c.subscriptionsMutex.Lock()
+	if !c.shuttingDown {
+		c.shuttingDown = true
+		close(c.stopped)
+	}
+	destinations := make([]string, 0, len(c.subscriptions))
+	for destination := range c.subscriptions {
+		destinations = append(destinations, destination)
+	}
+	c.subscriptionsMutex.Unlock()
+
+	// Ask the broker to stop sending messages:
+	confirmations := make(map[string]<-chan struct{}, len(destinations))
+	for _, destination := range destinations {
+		confirmed, unsubscribeErr := c.unsubscribeAsync(destination)
+		if unsubscribeErr == nil {
+			confirmations[destination] = confirmed
+		}
+	}
+
+	// Wait for the messages already received to be handled:
+	if err == nil {
+		err = c.deliveries.wait(ctx)
+	}
+
+	// Wait for the messages being published, including the responses sent by the handlers:
+	if err == nil {
+		err = c.publishes.wait(ctx)
+	}
+
+	// Report the unsubscriptions that the broker didn't confirm:
+	for destination, confirmed := range confirmations {
+		select {
+		case <-confirmed:
+		default:
+			c.fire(client.Event{
+				Type:        client.ReceiptTimeoutEvent,
+				Destination: destination,
+				Err:         fmt.Errorf("Broker didn't confirm the unsubscription"),
+			})
+		}
+	}
+
+	// Disconnect, without waiting for the broker if we are out of time or if the connection was
+	// lost:
+	if err != nil {
+		c.cancelThrottling()
+	}
+	report := c.markDisconnected()
+	if err != nil || c.socket.failed.Load() {
+		c.connection.MustDisconnect()
+	} else {
+		err = c.connection.Disconnect()
+	}
+	if report {
+		c.fire(client.Event{Type: client.DisconnectedEvent})
+	}
+	return
+}
+
+// unsubscribeAsync removes the subscription to a destination, and asks the broker to stop
+// sending its messages, without waiting for the broker to confirm it. The returned channel is
+// closed when the broker confirms the unsubscription, or when the connection is closed.
+func (c *Connection) unsubscribeAsync(destination string) (confirmed <-chan struct{}, err error) {
+	subscription, ok := c.removeSubscription(destination)
+	if !ok {
+		err = fmt.Errorf("Unsubscribe failed, no destination %s", destination)
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		subscription.Unsubscribe()
+	}()
+	confirmed = done
+	return
+}
+
+// next returns the next message of a delivery loop, or nil when the loop should finish: when the
+// channel of the subscription is closed, or when the connection or the loop are stopped and the
+// messages already received were handled. The messages that arrive after that are discarded
+// without acknowledging them, so that they don't block the connection.
+func (c *Connection) next(messages <-chan *stomp.Message, stop <-chan struct{}) *stomp.Message {
+	select {
+	case message := <-messages:
+		return message
+	case <-c.stopped:
+	case <-stop:
+	}
+	select {
+	case message := <-messages:
+		return message
+	default:
+	}
+	go func() {
+		for range messages {
+		}
+	}()
+	return nil
+}
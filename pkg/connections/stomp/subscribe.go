@@ -17,59 +17,127 @@ limitations under the License.
 package stomp
 
 import (
-	"encoding/json"
 	"fmt"
 
 	"github.com/go-stomp/stomp"
+	"github.com/go-stomp/stomp/frame"
 
 	"github.com/container-mgmt/messaging-library/pkg/client"
+	"github.com/container-mgmt/messaging-library/pkg/selector"
 )
 
+// selectorHeader is the header of the SUBSCRIBE frame that contains the selector expression, for
+// the brokers that support it.
+const selectorHeader = "selector"
+
+// subscriptionOptions returns the options of the SUBSCRIBE frame of a subscription, and the
+// parsed selector, if the subscription has one.
+func subscriptionOptions(spec client.SubscriptionSpec) (options []func(*frame.Frame) error,
+	filter *selector.Selector, err error) {
+	// Filter the messages always in the client, and also in the broker when the caller knows
+	// that the selector only uses headers:
+	if spec.Selector != "" {
+		filter, err = selector.Parse(spec.Selector)
+		if err != nil {
+			return
+		}
+		if spec.BrokerSelector {
+			options = append(options, stomp.SubscribeOpt.Header(selectorHeader, spec.Selector))
+		}
+	}
+
+	// Ask the broker to keep the messages while the subscription is detached:
+	if spec.DurableName != "" {
+		options = append(options, durableOptions(spec.DurableName)...)
+	}
+	return
+}
+
 // Subscribe creates a subscription on the messaging server.
 // The subscription has a destination, and messages sent to that destination
 // will be received by this subscription.
 //
 // Once a message or an error is received, the callback function will be trigered.
 func (c *Connection) Subscribe(destination string, callback client.SubscriptionCallback) (err error) {
+	err = c.SubscribeWithSpec(client.SubscriptionSpec{
+		Destination: destination,
+		Callback:    callback,
+	})
+	return
+}
+
+// SubscribeWithSpec creates a subscription on the messaging server, like Subscribe, with the
+// additional options of the specification, for example flow control.
+func (c *Connection) SubscribeWithSpec(spec client.SubscriptionSpec) (err error) {
 	var subscription *stomp.Subscription
-	var data client.MessageData
+	destination := spec.Destination
 
-	// Check if we already subscibe to this destination,
-	// We do not allow for multiple subscriptions for one destination.
-	if _, ok := c.subscriptions[destination]; ok {
-		err = fmt.Errorf("Only one subscription per destination is allowed")
+	options, filter, err := subscriptionOptions(spec)
+	if err != nil {
 		return
 	}
 
 	// Receive messages:
-	subscription, err = c.connection.Subscribe(destination, stomp.AckAuto)
+	subscription, err = c.subscribe(destination, spec.FlowControl, options...)
 	if err != nil {
 		return
 	}
+	messages := c.receive(subscription, destination, spec.FlowControl)
 
-	c.subscriptions[destination] = subscription
+	// Deliver the messages through the subscription middleware:
+	callback := client.ChainSubscription(spec.Callback, c.subscriptionMiddleware...)
 
 	// Wait for messages:
+	c.deliveries.begin()
 	go func() {
-		for message := range subscription.C {
-			// Try to unmarshal the byte array coming from the broker into a
-			// message body of type map[string]interface{}
-			err = json.Unmarshal(message.Body, &data)
-			if err != nil {
-				// Call the callback function with the json unmarshal error.
-				callback(
-					client.Message{
-						Data: client.MessageData{"byteArray": message.Body},
-						Err:  err},
-					destination)
+		defer c.deliveries.end()
+		for {
+			message := c.next(messages, nil)
+			if message == nil {
+				return
+			}
+
+			// Wait till all the chunks of the message are received:
+			complete, parts := c.reassemble(message, destination, spec.FlowControl)
+			if complete == nil {
+				continue
+			}
+			message = complete
+
+			m, blob, err := c.decodeMessage(message)
+			if err != nil && m.Err == nil {
+				// Report the json unmarshal error, unless the broker already
+				// reported an error.
+				m.Err = err
+			}
+
+			// Don't report the errors caused by closing the connection during shutdown.
+			if message.Err != nil && c.isShuttingDown() {
+				continue
+			}
+			c.track(message.Err, destination)
+
+			// Skip the messages that the selector doesn't match, before validating them, so that
+			// the messages that the subscription doesn't want aren't dead-lettered:
+			if message.Err == nil && filter != nil && !filter.Matches(m) {
+				c.acknowledge(parts, destination, spec.FlowControl, blob)
+				continue
+			}
+
+			// Send the messages that don't match their schemas to the dead letter destination:
+			if c.checkReceived(&m, destination) {
+				c.acknowledge(parts, destination, spec.FlowControl, blob)
+				continue
+			}
+
+			// Wait till the rate limit of the subscription allows the message:
+			if message.Err == nil && !c.throttleDelivery(spec.FlowControl.Limiter, destination) {
+				continue
 			}
 
 			// Call the callback function.
-			callback(
-				client.Message{
-					Data: data,
-					Err:  message.Err},
-				destination)
+			callback(m, destination)
+			c.acknowledge(parts, destination, spec.FlowControl, blob)
 		}
 	}()
 
@@ -79,7 +147,7 @@ func (c *Connection) Subscribe(destination string, callback client.SubscriptionC
 // Unsubscribe unsubscribes from a destination.
 func (c *Connection) Unsubscribe(destination string) (err error) {
 	// Check if we subscribe to this destination, o/w return an error.
-	subscription, ok := c.subscriptions[destination]
+	subscription, ok := c.removeSubscription(destination)
 	if ok == false {
 		err = fmt.Errorf("Unsubscribe faild, no destination %s", destination)
 		return
@@ -88,3 +156,52 @@ func (c *Connection) Unsubscribe(destination string) (err error) {
 	err = subscription.Unsubscribe()
 	return
 }
+
+// subscribe creates a subscription on the messaging server, and adds it to the subscriptions of
+// the connection.
+func (c *Connection) subscribe(destination string, flow client.FlowControl,
+	options ...func(*frame.Frame) error) (subscription *stomp.Subscription, err error) {
+	c.subscriptionsMutex.Lock()
+	defer c.subscriptionsMutex.Unlock()
+
+	// Don't accept new subscriptions once shutdown started.
+	if c.shuttingDown {
+		err = fmt.Errorf("Connection is shutting down")
+		return
+	}
+
+	// Check if we already subscibe to this destination,
+	// We do not allow for multiple subscriptions for one destination.
+	if _, ok := c.subscriptions[destination]; ok {
+		err = fmt.Errorf("Only one subscription per destination is allowed")
+		return
+	}
+
+	ack, prefetchOptions := flowOptions(flow)
+	options = append(prefetchOptions, options...)
+	subscription, err = c.connection.Subscribe(destination, ack, options...)
+	if err != nil {
+		return
+	}
+
+	c.subscriptions[destination] = subscription
+	return
+}
+
+// isShuttingDown checks if the shutdown of the connection started.
+func (c *Connection) isShuttingDown() bool {
+	c.subscriptionsMutex.Lock()
+	defer c.subscriptionsMutex.Unlock()
+	return c.shuttingDown
+}
+
+// removeSubscription removes a subscription from the subscriptions of the connection.
+func (c *Connection) removeSubscription(destination string) (subscription *stomp.Subscription, ok bool) {
+	c.subscriptionsMutex.Lock()
+	defer c.subscriptionsMutex.Unlock()
+
+	subscription, ok = c.subscriptions[destination]
+	delete(c.subscriptions, destination)
+	delete(c.deliveryTimes, destination)
+	return
+}
@@ -0,0 +1,127 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+	"github.com/container-mgmt/messaging-library/pkg/tracing"
+)
+
+func TestTracePropagation(t *testing.T) {
+	// Get unique destinations for the test.
+	requests, _ := DestinationName()
+	responses, _ := DestinationName()
+
+	// Record the spans in memory.
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := tracing.NewTracer(tracing.TracerSpec{TracerProvider: provider})
+
+	// Start the responder.
+	spec := &client.ConnectionSpec{}
+	tracer.Instrument(spec)
+	c, err := NewConnection(spec)
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+	_, err = c.NewResponder(client.ResponderSpec{
+		RequestsQueue: requests,
+		Callback:      echoHandler,
+	})
+	if err != nil {
+		t.Fatalf("Fail to create responder: %s", err.Error())
+	}
+
+	// Create the requestor.
+	spec = &client.ConnectionSpec{}
+	tracer.Instrument(spec)
+	c, err = NewConnection(spec)
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+	r, err := c.NewRequestor(client.RequestorSpec{
+		RequestsQueue:  requests,
+		ResponsesQueue: responses,
+	})
+	if err != nil {
+		t.Fatalf("Fail to create requestor: %s", err.Error())
+	}
+
+	// Wait till the subscriptions reach the server.
+	time.Sleep(100 * time.Millisecond)
+
+	// Send the request inside the span of the caller.
+	ctx, root := provider.Tracer("test").Start(context.Background(), "caller")
+	received := make(chan client.Message, 1)
+	_, err = r.Send(
+		client.Message{Context: ctx, Data: client.MessageData{"value": 42.0}},
+		func(response client.Message, requestID string) error {
+			received <- response
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("Send exited with an error: %s", err.Error())
+	}
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for the response")
+	}
+	root.End()
+
+	// The caller, the request sent and processed, and the response sent and processed.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(recorder.Ended()) < 5 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	spans := recorder.Ended()
+	if len(spans) != 5 {
+		t.Fatalf("Recorded %d spans expected 5", len(spans))
+	}
+
+	// All the spans must be part of the trace of the caller, each one child of the previous.
+	byName := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range spans {
+		if span.SpanContext().TraceID() != root.SpanContext().TraceID() {
+			t.Errorf("Span '%s' isn't part of the trace of the caller", span.Name())
+		}
+		byName[span.Name()] = span
+	}
+	chain := []string{"caller", "send " + requests, "process " + requests, "send " + responses,
+		"process " + responses}
+	for i := 1; i < len(chain); i++ {
+		span, ok := byName[chain[i]]
+		if !ok {
+			t.Errorf("Span '%s' wasn't recorded", chain[i])
+			continue
+		}
+		parent := byName[chain[i-1]]
+		if parent == nil || span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("Span '%s' isn't child of span '%s'", chain[i], chain[i-1])
+		}
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"github.com/go-stomp/stomp/frame"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// validate checks the data of a message with the schema of its destination and with the schema
+// of its kind. Messages without schemas, or whose bodies are byte arrays, are always valid.
+func (c *Connection) validate(m client.Message, destination string) (err error) {
+	registry := c.validation.Registry
+	if registry == nil {
+		return
+	}
+	if _, raw := m.Data["byteArray"].([]byte); raw {
+		return
+	}
+	if name, ok := c.validation.Destinations[destination]; ok {
+		err = registry.Validate(name, m.Data)
+		if err != nil {
+			return
+		}
+	}
+	if kind, ok := correlationField(m, client.KindHeader, "kind"); ok {
+		if name, ok := c.validation.Kinds[kind]; ok {
+			err = registry.Validate(name, m.Data)
+		}
+	}
+	return
+}
+
+// checkReceived validates a received message. Messages that don't match their schemas are sent
+// to the dead letter destination, and then the result is true, meaning that they shouldn't be
+// delivered. Without a dead letter destination the validation error is stored in the message.
+func (c *Connection) checkReceived(m *client.Message, destination string) (deadLettered bool) {
+	if m.Err != nil {
+		return
+	}
+	err := c.validate(*m, destination)
+	if err == nil {
+		return
+	}
+	c.logger.Warn(
+		"Received message that doesn't match its schema",
+		append(messageFields(*m, destination), "error", err)...)
+	if c.validation.DeadLetter == "" {
+		m.Err = err
+		return
+	}
+
+	// Send the message without the headers that the broker added on delivery:
+	header := copyHeader(m.Header)
+	delete(header, frame.MessageId)
+	delete(header, frame.Subscription)
+	delete(header, frame.Ack)
+	header[client.ValidationErrorHeader] = err.Error()
+	header[client.OriginalDestinationHeader] = destination
+	sendErr := c.publish(
+		client.Message{
+			ContentType: m.ContentType,
+			Data:        m.Data,
+			Header:      header,
+		},
+		c.validation.DeadLetter,
+	)
+	if sendErr != nil {
+		c.logger.Error(
+			"Can't send invalid message to dead letter destination",
+			client.DestinationField, c.validation.DeadLetter,
+			"error", sendErr,
+		)
+		m.Err = err
+		return
+	}
+	deadLettered = true
+	return
+}
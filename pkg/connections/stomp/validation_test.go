@@ -0,0 +1,243 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stomp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+	"github.com/container-mgmt/messaging-library/pkg/schema"
+)
+
+func TestValidation(t *testing.T) {
+	// Get unique destinations for the test.
+	destination, _ := DestinationName()
+	deadLetter, _ := DestinationName()
+
+	// Create a registry with a schema that requires a text value.
+	registry := schema.NewRegistry()
+	err := registry.Add("Value", []byte(`{
+		"type": "object",
+		"required": ["value"],
+		"properties": {
+			"value": {"type": "string"}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("Can't add schema: %s", err.Error())
+	}
+
+	// Create a connection that delivers the invalid messages with the error, one that sends
+	// them to the dead letter destination, and one without validation.
+	c, err := NewConnection(&client.ConnectionSpec{
+		Validation: client.ValidationSpec{
+			Registry:     registry,
+			Destinations: map[string]string{destination: "Value"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+	dead, err := NewConnection(&client.ConnectionSpec{
+		Validation: client.ValidationSpec{
+			Registry:     registry,
+			Destinations: map[string]string{destination: "Value"},
+			DeadLetter:   deadLetter,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer dead.Close()
+	plain, err := NewConnection(&client.ConnectionSpec{})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer plain.Close()
+
+	received := make(chan client.Message, 10)
+	receivedValid := make(chan client.Message, 10)
+	receivedDead := make(chan client.Message, 10)
+	c.Subscribe(destination, func(m client.Message, destination string) error {
+		received <- m
+		return nil
+	})
+	dead.Subscribe(destination, func(m client.Message, destination string) error {
+		receivedValid <- m
+		return nil
+	})
+	plain.Subscribe(deadLetter, func(m client.Message, destination string) error {
+		receivedDead <- m
+		return nil
+	})
+
+	// Wait till the subscriptions reach the server.
+	time.Sleep(100 * time.Millisecond)
+
+	// Invalid messages are rejected before they are sent.
+	invalid := client.Message{Data: client.MessageData{"value": 42}}
+	err = c.Publish(invalid, destination)
+	if _, ok := err.(*schema.ValidationError); !ok {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+
+	// Send a valid message and an invalid one without validation.
+	valid := client.Message{Data: client.MessageData{"value": "text"}}
+	for _, m := range []client.Message{valid, invalid} {
+		err = plain.Publish(m, destination)
+		if err != nil {
+			t.Fatalf("Fail to publish: %s", err.Error())
+		}
+	}
+
+	// The invalid message is delivered with the validation error.
+	for _, value := range []interface{}{"text", 42.0} {
+		select {
+		case m := <-received:
+			if m.Data["value"] != value {
+				t.Errorf("Received '%v' expected '%v'", m.Data["value"], value)
+			}
+			if _, ok := m.Err.(*schema.ValidationError); value == 42.0 && !ok {
+				t.Errorf("Expected a validation error, got %v", m.Err)
+			}
+			if value == "text" && m.Err != nil {
+				t.Errorf("Received error: %s", m.Err.Error())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the message")
+		}
+	}
+
+	// The connection with the dead letter destination receives only the valid message, and
+	// the invalid one is sent to the dead letter destination.
+	select {
+	case m := <-receivedValid:
+		if m.Err != nil || m.Data["value"] != "text" {
+			t.Errorf("Received '%v' expected 'text'", m.Data["value"])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the message")
+	}
+	select {
+	case m := <-receivedDead:
+		if m.Data["value"] != 42.0 {
+			t.Errorf("Received '%v' expected '42'", m.Data["value"])
+		}
+		if m.Header[client.OriginalDestinationHeader] != destination {
+			t.Errorf("Unexpected original destination '%s'", m.Header[client.OriginalDestinationHeader])
+		}
+		if m.Header[client.ValidationErrorHeader] == "" {
+			t.Error("Expected the validation error header")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the message")
+	}
+	select {
+	case m := <-receivedValid:
+		t.Errorf("Unexpected delivery of invalid message '%v'", m.Data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSelectorBeforeValidation(t *testing.T) {
+	// Get unique destinations for the test.
+	destination, _ := DestinationName()
+	deadLetter, _ := DestinationName()
+
+	// Create a registry with a schema that requires a text value.
+	registry := schema.NewRegistry()
+	err := registry.Add("Value", []byte(`{
+		"type": "object",
+		"required": ["value"],
+		"properties": {
+			"value": {"type": "string"}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("Can't add schema: %s", err.Error())
+	}
+
+	// Create a connection that sends the invalid messages to the dead letter destination, and
+	// one without validation.
+	c, err := NewConnection(&client.ConnectionSpec{
+		Validation: client.ValidationSpec{
+			Registry:     registry,
+			Destinations: map[string]string{destination: "Value"},
+			DeadLetter:   deadLetter,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer c.Close()
+	plain, err := NewConnection(&client.ConnectionSpec{})
+	if err != nil {
+		t.Fatalf("Fail to open connection: %s", err.Error())
+	}
+	defer plain.Close()
+
+	// Receive only the messages of one kind.
+	err = c.SubscribeWithSpec(client.SubscriptionSpec{
+		Destination: destination,
+		Callback: func(m client.Message, destination string) error {
+			return nil
+		},
+		Selector: "kind = 'Wanted'",
+	})
+	if err != nil {
+		t.Fatalf("Fail to subscribe: %s", err.Error())
+	}
+	receivedDead := make(chan client.Message, 10)
+	plain.Subscribe(deadLetter, func(m client.Message, destination string) error {
+		receivedDead <- m
+		return nil
+	})
+
+	// Wait till the subscriptions reach the server.
+	time.Sleep(100 * time.Millisecond)
+
+	// Send invalid messages of both kinds.
+	for _, kind := range []string{"Other", "Wanted"} {
+		err = plain.Publish(
+			client.Message{
+				Header: map[string]string{"kind": kind},
+				Data:   client.MessageData{"value": 42},
+			},
+			destination,
+		)
+		if err != nil {
+			t.Fatalf("Fail to publish: %s", err.Error())
+		}
+	}
+
+	// Only the invalid message that the selector matches is sent to the dead letter destination.
+	select {
+	case m := <-receivedDead:
+		if m.Header["kind"] != "Wanted" {
+			t.Errorf("Expected dead letter of kind 'Wanted', got '%s'", m.Header["kind"])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for dead letter")
+	}
+	select {
+	case m := <-receivedDead:
+		t.Errorf("Expected no more dead letters, got kind '%s'", m.Header["kind"])
+	case <-time.After(200 * time.Millisecond):
+	}
+}
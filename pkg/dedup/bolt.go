@@ -0,0 +1,190 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dedup
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltBucket is the bucket of the database that contains the keys, with their expiration times
+// as values.
+var boltBucket = []byte("processed")
+
+// BoltSpec is a helper struct for building file stores.
+type BoltSpec struct {
+	// Path is the path of the database file, which is created if it doesn't exist. It is
+	// mandatory.
+	Path string
+
+	// TTL is the time that keys are kept. It is mandatory, as otherwise the file would grow
+	// forever.
+	TTL time.Duration
+}
+
+// BoltStore keeps the keys in a BoltDB database file, so they survive restarts of the program.
+// The file can only be used by one program at a time. Expired keys are removed periodically, at
+// most once per TTL.
+type BoltStore struct {
+	db  *bolt.DB
+	ttl time.Duration
+
+	// last time that the expired keys were removed
+	purged      time.Time
+	purgedMutex sync.Mutex
+
+	// returns the current time, replaced by tests
+	now func() time.Time
+}
+
+// NewBoltStore opens or creates a store in a BoltDB database file. It should be closed when it is
+// no longer needed.
+//
+// For example:
+//
+//	store, err := dedup.NewBoltStore(dedup.BoltSpec{
+//		Path: "/var/lib/my-service/processed.db",
+//		TTL:  24 * time.Hour,
+//	})
+//	if err != nil {
+//		return
+//	}
+//	defer store.Close()
+func NewBoltStore(spec BoltSpec) (store *BoltStore, err error) {
+	if spec.Path == "" {
+		err = fmt.Errorf("The path of the database is mandatory")
+		return
+	}
+	if spec.TTL <= 0 {
+		err = fmt.Errorf("The TTL of the keys is mandatory")
+		return
+	}
+	db, err := bolt.Open(spec.Path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		err = fmt.Errorf("Can't open database '%s': %s", spec.Path, err.Error())
+		return
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		err = fmt.Errorf("Can't create bucket in database '%s': %s", spec.Path, err.Error())
+		return
+	}
+	store = &BoltStore{
+		db:  db,
+		ttl: spec.TTL,
+		now: time.Now,
+	}
+	return
+}
+
+// Contains checks if a key was recorded, and didn't expire.
+func (s *BoltStore) Contains(ctx context.Context, key string) (found bool, err error) {
+	now := s.now()
+	err = s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(boltBucket).Get([]byte(key))
+		found = value != nil && now.Before(decodeTime(value))
+		return nil
+	})
+	return
+}
+
+// Add records a key unless it was already recorded and didn't expire, and removes the expired
+// keys if they weren't removed during the last TTL.
+func (s *BoltStore) Add(ctx context.Context, key string) (added bool, err error) {
+	now := s.now()
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		value := bucket.Get([]byte(key))
+		if value != nil && now.Before(decodeTime(value)) {
+			return nil
+		}
+		added = true
+		return bucket.Put([]byte(key), encodeTime(now.Add(s.ttl)))
+	})
+	if err != nil || !added {
+		return
+	}
+
+	s.purgedMutex.Lock()
+	purge := now.Sub(s.purged) >= s.ttl
+	if purge {
+		s.purged = now
+	}
+	s.purgedMutex.Unlock()
+	if purge {
+		err = s.purge(now)
+	}
+	return
+}
+
+// Remove removes a key.
+func (s *BoltStore) Remove(ctx context.Context, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Delete([]byte(key))
+	})
+}
+
+// Close closes the database file.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// purge removes the keys that expired.
+func (s *BoltStore) purge(now time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		// Collect the keys first, as deleting while iterating skips keys:
+		bucket := tx.Bucket(boltBucket)
+		var expired [][]byte
+		bucket.ForEach(func(key, value []byte) error {
+			if !now.Before(decodeTime(value)) {
+				expired = append(expired, append([]byte(nil), key...))
+			}
+			return nil
+		})
+		for _, key := range expired {
+			err := bucket.Delete(key)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// encodeTime converts a time into the value stored in the database.
+func encodeTime(t time.Time) []byte {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, uint64(t.UnixNano()))
+	return value
+}
+
+// decodeTime converts a value stored in the database into a time.
+func decodeTime(value []byte) time.Time {
+	if len(value) != 8 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(value)))
+}
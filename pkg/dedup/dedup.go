@@ -0,0 +1,230 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dedup contains middleware that makes consumers idempotent, skipping the messages that
+// were already processed, for example messages redelivered by the broker after a failover.
+//
+// For example:
+//
+//	deduplicator, err := dedup.NewDeduplicator(dedup.DeduplicatorSpec{
+//		Store: dedup.NewMemoryStore(dedup.MemorySpec{
+//			Size: 100000,
+//			TTL:  time.Hour,
+//		}),
+//		Key: dedup.FieldKey("orderID"),
+//	})
+//	if err != nil {
+//		return
+//	}
+//
+//	err = c.Subscribe(
+//		"/queue/orders",
+//		client.ChainSubscription(callback, deduplicator.SubscriptionMiddleware),
+//	)
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/go-stomp/stomp/frame"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// KeyFunc returns the key that identifies a message, and false if the message has no key.
+type KeyFunc func(m client.Message) (string, bool)
+
+// MessageIDKey identifies messages by the identifier assigned by the broker. It only detects the
+// redeliveries of the brokers that keep the identifier, like ActiveMQ. RabbitMQ and the bundled
+// messaging server assign a new identifier each time they deliver a message, and no broker keeps
+// it when the producer sends the message again, so in general HeaderKey or FieldKey should be
+// used with an identifier assigned by the producer. For example, the requests correlated with
+// headers can be identified with HeaderKey(client.CorrelationIDHeader).
+func MessageIDKey(m client.Message) (string, bool) {
+	key, ok := m.Header[frame.MessageId]
+	return key, ok && key != ""
+}
+
+// HeaderKey identifies messages by the value of a header, for example a business identifier
+// assigned by the producer.
+func HeaderKey(name string) KeyFunc {
+	return func(m client.Message) (string, bool) {
+		key, ok := m.Header[name]
+		return key, ok && key != ""
+	}
+}
+
+// FieldKey identifies messages by the value of a field of the data. Values that aren't strings
+// are converted to text.
+func FieldKey(name string) KeyFunc {
+	return func(m client.Message) (string, bool) {
+		value, ok := m.Data[name]
+		if !ok || value == nil {
+			return "", false
+		}
+		if key, ok := value.(string); ok {
+			return key, key != ""
+		}
+		return fmt.Sprint(value), true
+	}
+}
+
+// DeduplicatorSpec is a helper struct for building deduplicators.
+type DeduplicatorSpec struct {
+	// Store records the keys of the messages processed. It is mandatory.
+	Store Store
+
+	// Key returns the key that identifies each message. Keys are scoped to the destination of
+	// the message. It is mandatory, as no key detects the duplicates with all the brokers and
+	// producers: usually it should be an identifier assigned by the producer, and MessageIDKey
+	// only detects the redeliveries of some brokers.
+	Key KeyFunc
+
+	// Logger writes the messages skipped and the errors of the store. The default is a logger
+	// that discards all the messages.
+	Logger client.Logger
+}
+
+// Deduplicator skips the messages whose keys are in the store. The key of a message is added to
+// the store before calling the callback, so that a duplicate received at the same time isn't
+// processed too, and it is removed if the callback returns an error, so that messages that fail
+// are processed again when they are redelivered. Duplicates received by the same deduplicator
+// while the message is being processed wait till it finishes.
+//
+// If the store fails the message is processed anyway, as processing a duplicate is usually
+// better than losing a message.
+type Deduplicator struct {
+	store  Store
+	key    KeyFunc
+	logger client.Logger
+
+	// the keys of the messages being processed, with channels closed when they finish
+	processing      map[string]chan struct{}
+	processingMutex sync.Mutex
+}
+
+// NewDeduplicator creates a new deduplicator.
+func NewDeduplicator(spec DeduplicatorSpec) (d *Deduplicator, err error) {
+	// Check the mandatory values:
+	if spec.Store == nil {
+		err = fmt.Errorf("The store of the deduplicator is mandatory")
+		return
+	}
+	if spec.Key == nil {
+		err = fmt.Errorf("The key of the deduplicator is mandatory")
+		return
+	}
+
+	// Init the values that weren't given:
+	logger := spec.Logger
+	if logger == nil {
+		logger = client.NopLogger{}
+	}
+
+	d = &Deduplicator{
+		store:      spec.Store,
+		key:        spec.Key,
+		logger:     logger,
+		processing: make(map[string]chan struct{}),
+	}
+	return
+}
+
+// SubscriptionMiddleware skips the messages already processed or being processed, and records
+// the messages processed successfully. Messages without key and errors reported by the broker
+// are always delivered.
+func (d *Deduplicator) SubscriptionMiddleware(next client.SubscriptionCallback) client.SubscriptionCallback {
+	return func(m client.Message, destination string) (err error) {
+		if m.Err != nil {
+			return next(m, destination)
+		}
+		key, ok := d.key(m)
+		if !ok {
+			return next(m, destination)
+		}
+		key = destination + "\n" + key
+
+		ctx := m.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		err = d.begin(ctx, key)
+		if err != nil {
+			return
+		}
+		defer d.end(key)
+
+		added, storeErr := d.store.Add(ctx, key)
+		if storeErr != nil {
+			d.logger.Error(
+				"Can't check if message was processed",
+				client.DestinationField, destination,
+				"error", storeErr,
+			)
+		} else if !added {
+			d.logger.Debug(
+				"Skipping message already processed",
+				client.DestinationField, destination,
+			)
+			return nil
+		}
+
+		err = next(m, destination)
+		if err == nil || storeErr != nil {
+			return
+		}
+		storeErr = d.store.Remove(ctx, key)
+		if storeErr != nil {
+			d.logger.Error(
+				"Can't remove message that failed",
+				client.DestinationField, destination,
+				"error", storeErr,
+			)
+		}
+		return
+	}
+}
+
+// begin waits till no other message with the same key is being processed, and marks the key as
+// being processed.
+func (d *Deduplicator) begin(ctx context.Context, key string) error {
+	for {
+		d.processingMutex.Lock()
+		done, busy := d.processing[key]
+		if !busy {
+			d.processing[key] = make(chan struct{})
+			d.processingMutex.Unlock()
+			return nil
+		}
+		d.processingMutex.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// end marks a key as no longer being processed.
+func (d *Deduplicator) end(key string) {
+	d.processingMutex.Lock()
+	done := d.processing[key]
+	delete(d.processing, key)
+	d.processingMutex.Unlock()
+	close(done)
+}
@@ -0,0 +1,271 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dedup
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// clock is a time source controlled by the tests.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+// checkStore checks the behavior common to all the stores.
+func checkStore(t *testing.T, store Store, c *clock, ttl time.Duration) {
+	ctx := context.Background()
+	found, err := store.Contains(ctx, "a")
+	if err != nil || found {
+		t.Fatalf("Expected empty store, got %v, %v", found, err)
+	}
+	added, err := store.Add(ctx, "a")
+	if err != nil || !added {
+		t.Fatalf("Can't add key: %v, %v", added, err)
+	}
+	found, _ = store.Contains(ctx, "a")
+	if !found {
+		t.Error("Expected key to be found")
+	}
+
+	// Keys already recorded aren't added again.
+	added, _ = store.Add(ctx, "a")
+	if added {
+		t.Error("Expected key to be added only once")
+	}
+
+	// Keys removed can be added again.
+	err = store.Remove(ctx, "a")
+	if err != nil {
+		t.Fatalf("Can't remove key: %s", err.Error())
+	}
+	added, _ = store.Add(ctx, "a")
+	if !added {
+		t.Error("Expected removed key to be added again")
+	}
+
+	// Keys expire after the TTL.
+	c.now = c.now.Add(ttl)
+	found, _ = store.Contains(ctx, "a")
+	if found {
+		t.Error("Expected key to expire")
+	}
+	added, _ = store.Add(ctx, "a")
+	if !added {
+		t.Error("Expected expired key to be added again")
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	c := &clock{now: time.Now()}
+	store := NewMemoryStore(MemorySpec{Size: 2, TTL: time.Minute})
+	store.now = c.Now
+	checkStore(t, store, c, time.Minute)
+
+	// The least recently used keys are removed when the store is full.
+	ctx := context.Background()
+	store.Add(ctx, "b")
+	store.Add(ctx, "c")
+	store.Contains(ctx, "b")
+	store.Add(ctx, "d")
+	if store.Len() != 2 {
+		t.Errorf("Expected 2 keys, got %d", store.Len())
+	}
+	for key, expected := range map[string]bool{"b": true, "c": false, "d": true} {
+		found, _ := store.Contains(ctx, key)
+		if found != expected {
+			t.Errorf("Key '%s' found %v, expected %v", key, found, expected)
+		}
+	}
+}
+
+func TestBoltStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatalf("Can't create directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "processed.db")
+
+	c := &clock{now: time.Now()}
+	store, err := NewBoltStore(BoltSpec{Path: path, TTL: time.Minute})
+	if err != nil {
+		t.Fatalf("Can't create store: %s", err.Error())
+	}
+	store.now = c.Now
+	checkStore(t, store, c, time.Minute)
+
+	// Keys survive reopening the store.
+	ctx := context.Background()
+	store.Add(ctx, "b")
+	store.Close()
+	store, err = NewBoltStore(BoltSpec{Path: path, TTL: time.Minute})
+	if err != nil {
+		t.Fatalf("Can't reopen store: %s", err.Error())
+	}
+	defer store.Close()
+	store.now = c.Now
+	found, _ := store.Contains(ctx, "b")
+	if !found {
+		t.Error("Expected key to survive reopening the store")
+	}
+
+	// Expired keys are removed from the file.
+	c.now = c.now.Add(time.Minute)
+	store.Add(ctx, "c")
+	err = store.purge(c.now)
+	if err != nil {
+		t.Fatalf("Can't purge store: %s", err.Error())
+	}
+	count := 0
+	store.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(boltBucket).Stats().KeyN
+		return nil
+	})
+	if count != 1 {
+		t.Errorf("Expected 1 key after purging, got %d", count)
+	}
+}
+
+func TestDeduplicator(t *testing.T) {
+	deduplicator, err := NewDeduplicator(DeduplicatorSpec{
+		Store: NewMemoryStore(MemorySpec{}),
+		Key:   FieldKey("orderID"),
+	})
+	if err != nil {
+		t.Fatalf("Can't create deduplicator: %s", err.Error())
+	}
+	var processed []string
+	fail := true
+	callback := client.ChainSubscription(
+		func(m client.Message, destination string) error {
+			processed = append(processed, m.Data["orderID"].(string))
+			if m.Data["orderID"] == "b" && fail {
+				fail = false
+				return errors.New("Test error")
+			}
+			return nil
+		},
+		deduplicator.SubscriptionMiddleware,
+	)
+
+	// Duplicates are skipped, and messages that failed are processed again.
+	for _, key := range []string{"a", "a", "b", "b", "b"} {
+		callback(client.Message{Data: client.MessageData{"orderID": key}}, "/queue/orders")
+	}
+	// Keys are scoped to the destination.
+	callback(client.Message{Data: client.MessageData{"orderID": "a"}}, "/queue/other")
+
+	expected := []string{"a", "b", "b", "a"}
+	if len(processed) != len(expected) {
+		t.Fatalf("Processed %v, expected %v", processed, expected)
+	}
+	for i := range expected {
+		if processed[i] != expected[i] {
+			t.Errorf("Processed %v, expected %v", processed, expected)
+		}
+	}
+}
+
+func TestConcurrentDuplicates(t *testing.T) {
+	deduplicator, err := NewDeduplicator(DeduplicatorSpec{
+		Store: NewMemoryStore(MemorySpec{}),
+		Key:   FieldKey("orderID"),
+	})
+	if err != nil {
+		t.Fatalf("Can't create deduplicator: %s", err.Error())
+	}
+
+	// The first message fails while the duplicate is waiting, so the duplicate is processed.
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var processed int32
+	callback := client.ChainSubscription(
+		func(m client.Message, destination string) error {
+			if atomic.AddInt32(&processed, 1) == 1 {
+				close(started)
+				<-release
+				return errors.New("Test error")
+			}
+			return nil
+		},
+		deduplicator.SubscriptionMiddleware,
+	)
+	m := client.Message{Data: client.MessageData{"orderID": "a"}}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		callback(m, "/queue/orders")
+	}()
+	<-started
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+	}()
+	callback(m, "/queue/orders")
+	<-done
+
+	// Once processed successfully, the duplicates are skipped.
+	callback(m, "/queue/orders")
+	if processed != 2 {
+		t.Errorf("Processed %d messages, expected 2", processed)
+	}
+}
+
+func TestMandatoryKey(t *testing.T) {
+	_, err := NewDeduplicator(DeduplicatorSpec{Store: NewMemoryStore(MemorySpec{})})
+	if err == nil {
+		t.Error("Expected an error creating a deduplicator without key")
+	}
+}
+
+func TestKeys(t *testing.T) {
+	m := client.Message{
+		Header: map[string]string{"message-id": "id-1", "order-id": "order-1"},
+		Data:   client.MessageData{"count": 42.0},
+	}
+	for _, test := range []struct {
+		key      KeyFunc
+		expected string
+		ok       bool
+	}{
+		{MessageIDKey, "id-1", true},
+		{HeaderKey("order-id"), "order-1", true},
+		{HeaderKey("missing"), "", false},
+		{FieldKey("count"), "42", true},
+		{FieldKey("missing"), "", false},
+	} {
+		key, ok := test.key(m)
+		if key != test.expected || ok != test.ok {
+			t.Errorf("Got '%s', %v expected '%s', %v", key, ok, test.expected, test.ok)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dedup
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Store records the keys of the messages already processed, or being processed.
+type Store interface {
+	// Contains checks if a key was recorded, and didn't expire.
+	Contains(ctx context.Context, key string) (bool, error)
+
+	// Add records a key, unless it was already recorded and didn't expire. It returns false if
+	// the key was already recorded. Checking and recording the key must be atomic, so that only
+	// one of the consumers that add the same key at the same time gets true.
+	Add(ctx context.Context, key string) (bool, error)
+
+	// Remove removes a key, so that it can be added again.
+	Remove(ctx context.Context, key string) error
+}
+
+// MemorySpec is a helper struct for building memory stores.
+type MemorySpec struct {
+	// Size is the maximum number of keys kept. When it is reached the least recently used keys
+	// are removed. The default is 10000.
+	Size int
+
+	// TTL is the time that keys are kept. The default is to keep them till they are removed
+	// because of the size.
+	TTL time.Duration
+}
+
+// MemoryStore keeps the keys in memory, so they are lost when the program stops.
+type MemoryStore struct {
+	mutex sync.Mutex
+	size  int
+	ttl   time.Duration
+
+	// the entries ordered from the most recently used to the least recently used, and indexed
+	// by key
+	entries *list.List
+	index   map[string]*list.Element
+
+	// returns the current time, replaced by tests
+	now func() time.Time
+}
+
+// memoryEntry is an entry of the memory store.
+type memoryEntry struct {
+	key     string
+	expires time.Time
+}
+
+// NewMemoryStore creates a store that keeps the keys in memory.
+func NewMemoryStore(spec MemorySpec) *MemoryStore {
+	size := spec.Size
+	if size <= 0 {
+		size = 10000
+	}
+	return &MemoryStore{
+		size:    size,
+		ttl:     spec.TTL,
+		entries: list.New(),
+		index:   make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+// Contains checks if a key was recorded, and didn't expire.
+func (s *MemoryStore) Contains(ctx context.Context, key string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	element, ok := s.index[key]
+	if !ok {
+		return false, nil
+	}
+	entry := element.Value.(*memoryEntry)
+	if s.expired(entry) {
+		s.entries.Remove(element)
+		delete(s.index, key)
+		return false, nil
+	}
+	s.entries.MoveToFront(element)
+	return true, nil
+}
+
+// Add records a key unless it was already recorded and didn't expire, removing the least
+// recently used keys if the store is full.
+func (s *MemoryStore) Add(ctx context.Context, key string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var expires time.Time
+	if s.ttl > 0 {
+		expires = s.now().Add(s.ttl)
+	}
+	if element, ok := s.index[key]; ok {
+		entry := element.Value.(*memoryEntry)
+		s.entries.MoveToFront(element)
+		if !s.expired(entry) {
+			return false, nil
+		}
+		entry.expires = expires
+		return true, nil
+	}
+	s.index[key] = s.entries.PushFront(&memoryEntry{key: key, expires: expires})
+	for s.entries.Len() > s.size {
+		oldest := s.entries.Back()
+		s.entries.Remove(oldest)
+		delete(s.index, oldest.Value.(*memoryEntry).key)
+	}
+	return true, nil
+}
+
+// Remove removes a key.
+func (s *MemoryStore) Remove(ctx context.Context, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if element, ok := s.index[key]; ok {
+		s.entries.Remove(element)
+		delete(s.index, key)
+	}
+	return nil
+}
+
+// Len returns the number of keys in the store, including the expired ones that weren't removed
+// yet.
+func (s *MemoryStore) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.entries.Len()
+}
+
+// expired checks if an entry expired.
+func (s *MemoryStore) expired(entry *memoryEntry) bool {
+	return !entry.expires.IsZero() && !s.now().Before(entry.expires)
+}
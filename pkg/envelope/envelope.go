@@ -0,0 +1,358 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package envelope signs and encrypts the bodies of messages, so that they can't be read or
+// modified by the brokers and the other clients that they cross.
+package envelope
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+)
+
+// SigningAlgorithm is the algorithm used to sign messages.
+type SigningAlgorithm string
+
+// Supported signing algorithms.
+const (
+	// HMACSHA256 signs with HMAC and SHA-256, using a secret shared by the senders and the
+	// receivers.
+	HMACSHA256 SigningAlgorithm = "hmac-sha256"
+
+	// Ed25519 signs with the private key of the sender, and the receivers verify with the
+	// public key.
+	Ed25519 SigningAlgorithm = "ed25519"
+)
+
+// EncryptionAlgorithm is the algorithm used to encrypt messages.
+type EncryptionAlgorithm string
+
+// Supported encryption algorithms.
+const (
+	// AESGCM encrypts with AES in Galois/Counter Mode, using a random nonce for each message.
+	AESGCM EncryptionAlgorithm = "aes-gcm"
+)
+
+// Names of the message headers that describe the envelope.
+const (
+	// SignatureHeader contains the signature of the message, encoded with base64.
+	SignatureHeader = "signature"
+
+	// SignatureAlgorithmHeader contains the algorithm used to sign the message.
+	SignatureAlgorithmHeader = "signature-algorithm"
+
+	// SignatureKeyHeader contains the identifier of the key used to sign the message.
+	SignatureKeyHeader = "signature-key-id"
+
+	// EncryptionHeader contains the algorithm used to encrypt the body of the message.
+	EncryptionHeader = "encryption"
+
+	// EncryptionKeyHeader contains the identifier of the key used to encrypt the body of the
+	// message.
+	EncryptionKeyHeader = "encryption-key-id"
+)
+
+// signedHeaders are the headers protected by the signature, besides the body. They describe how
+// to read the body, where it is stored, and how requests and responses are routed, so changing
+// them would change the meaning of the message or send the responses elsewhere.
+var signedHeaders = []string{
+	"content-type",
+	"content-encoding",
+	"claim-check",
+	"claim-check-digest",
+	"kind",
+	"correlation-id",
+	"reply-to",
+	"responder-id",
+	EncryptionHeader,
+	EncryptionKeyHeader,
+	SignatureAlgorithmHeader,
+	SignatureKeyHeader,
+}
+
+// Envelope signs and encrypts the bodies of the messages sent, and verifies and decrypts the
+// bodies of the messages received.
+type Envelope struct {
+	keys       KeyProvider
+	signing    SigningAlgorithm
+	encryption EncryptionAlgorithm
+}
+
+// New creates an envelope that uses the given algorithms, either of which may be empty to
+// disable signing or encryption.
+func New(keys KeyProvider, signing SigningAlgorithm, encryption EncryptionAlgorithm) (e *Envelope,
+	err error) {
+	if keys == nil {
+		err = fmt.Errorf("A key provider is required")
+		return
+	}
+	switch signing {
+	case "", HMACSHA256, Ed25519:
+	default:
+		err = fmt.Errorf("Unsupported signing algorithm '%s'", signing)
+		return
+	}
+	switch encryption {
+	case "", AESGCM:
+	default:
+		err = fmt.Errorf("Unsupported encryption algorithm '%s'", encryption)
+		return
+	}
+	e = &Envelope{
+		keys:       keys,
+		signing:    signing,
+		encryption: encryption,
+	}
+	return
+}
+
+// Seal encrypts and signs the body of a message. The header contains the headers that will be
+// sent with the message, including the content type and encoding and the routing headers, and
+// the headers of the envelope are added to it.
+func (e *Envelope) Seal(header map[string]string, body []byte) (result []byte, err error) {
+	result, err = e.Encrypt(header, body)
+	if err != nil {
+		return
+	}
+	err = e.Sign(header, result)
+	return
+}
+
+// Encrypt encrypts the body of a message, adding the headers of the encryption to the header.
+// It is the first half of Seal, for messages whose body is moved elsewhere before signing, so
+// that the signature only covers what the broker delivers.
+func (e *Envelope) Encrypt(header map[string]string, body []byte) (result []byte, err error) {
+	result = body
+	if e.encryption == "" {
+		return
+	}
+	id, key, err := e.keys.EncryptionKey()
+	if err != nil {
+		return
+	}
+	result, err = encrypt(key, id, result)
+	if err != nil {
+		return
+	}
+	header[EncryptionHeader] = string(e.encryption)
+	header[EncryptionKeyHeader] = id
+	return
+}
+
+// Sign signs the header and the body of a message, including the headers of the encryption,
+// adding the headers of the signature to the header. It is the second half of Seal.
+func (e *Envelope) Sign(header map[string]string, body []byte) (err error) {
+	if e.signing == "" {
+		return
+	}
+	id, key, err := e.keys.SigningKey()
+	if err != nil {
+		return
+	}
+	header[SignatureAlgorithmHeader] = string(e.signing)
+	header[SignatureKeyHeader] = id
+	signature, err := sign(e.signing, key, signedData(header, body))
+	if err != nil {
+		return
+	}
+	header[SignatureHeader] = base64.StdEncoding.EncodeToString(signature)
+	return
+}
+
+// Open verifies and decrypts the body of a received message. Messages that aren't signed or
+// encrypted with the algorithms of the envelope are rejected. The headers of the envelope are
+// removed from the header when the message is opened successfully.
+func (e *Envelope) Open(header map[string]string, body []byte) (result []byte, err error) {
+	err = e.Verify(header, body)
+	if err != nil {
+		return
+	}
+	result, err = e.Decrypt(header, body)
+	return
+}
+
+// Verify checks the signature of a received message, rejecting the messages that aren't signed
+// with the algorithm of the envelope. It is the first half of Open, so that the signed headers
+// can be trusted before the body is fetched from elsewhere.
+func (e *Envelope) Verify(header map[string]string, body []byte) (err error) {
+	if e.signing == "" {
+		return
+	}
+	algorithm := SigningAlgorithm(header[SignatureAlgorithmHeader])
+	if algorithm != e.signing {
+		err = fmt.Errorf("Message isn't signed with '%s'", e.signing)
+		return
+	}
+	signature, err := base64.StdEncoding.DecodeString(header[SignatureHeader])
+	if err != nil {
+		err = fmt.Errorf("Can't decode signature: %s", err.Error())
+		return
+	}
+	key, err := e.keys.VerificationKey(header[SignatureKeyHeader])
+	if err != nil {
+		return
+	}
+	err = verify(algorithm, key, signedData(header, body), signature)
+	return
+}
+
+// Decrypt decrypts the body of a received message, rejecting the messages that aren't encrypted
+// with the algorithm of the envelope. It is the second half of Open, and removes the headers of
+// the envelope from the header when it succeeds.
+func (e *Envelope) Decrypt(header map[string]string, body []byte) (result []byte, err error) {
+	result = body
+	encryption, encrypted := header[EncryptionHeader]
+	if e.encryption != "" && !encrypted {
+		err = fmt.Errorf("Message isn't encrypted with '%s'", e.encryption)
+		return
+	}
+	if encrypted {
+		if EncryptionAlgorithm(encryption) != AESGCM {
+			err = fmt.Errorf("Unsupported encryption algorithm '%s'", encryption)
+			return
+		}
+		id := header[EncryptionKeyHeader]
+		var key []byte
+		key, err = e.keys.DecryptionKey(id)
+		if err != nil {
+			return
+		}
+		result, err = decrypt(key, id, body)
+		if err != nil {
+			return
+		}
+	}
+
+	// Remove the headers of the envelope:
+	for _, name := range []string{
+		SignatureHeader,
+		SignatureAlgorithmHeader,
+		SignatureKeyHeader,
+		EncryptionHeader,
+		EncryptionKeyHeader,
+	} {
+		delete(header, name)
+	}
+	return
+}
+
+// signedData returns the data protected by the signature: the signed headers followed by the
+// body.
+func signedData(header map[string]string, body []byte) []byte {
+	var buffer bytes.Buffer
+	for _, name := range signedHeaders {
+		fmt.Fprintf(&buffer, "%s:%s\n", name, header[name])
+	}
+	buffer.Write(body)
+	return buffer.Bytes()
+}
+
+// sign calculates the signature of data.
+func sign(algorithm SigningAlgorithm, key []byte, data []byte) (signature []byte, err error) {
+	switch algorithm {
+	case HMACSHA256:
+		mac := hmac.New(sha256.New, key)
+		mac.Write(data)
+		signature = mac.Sum(nil)
+	case Ed25519:
+		if len(key) != ed25519.PrivateKeySize {
+			err = fmt.Errorf("Ed25519 private key should have %d bytes", ed25519.PrivateKeySize)
+			return
+		}
+		signature = ed25519.Sign(ed25519.PrivateKey(key), data)
+	}
+	return
+}
+
+// verify checks the signature of data.
+func verify(algorithm SigningAlgorithm, key []byte, data []byte, signature []byte) (err error) {
+	valid := false
+	switch algorithm {
+	case HMACSHA256:
+		var expected []byte
+		expected, err = sign(algorithm, key, data)
+		if err != nil {
+			return
+		}
+		valid = hmac.Equal(signature, expected)
+	case Ed25519:
+		// Accept the private key too, as it contains the public key:
+		if len(key) == ed25519.PrivateKeySize {
+			key = ed25519.PrivateKey(key).Public().(ed25519.PublicKey)
+		}
+		if len(key) != ed25519.PublicKeySize {
+			err = fmt.Errorf("Ed25519 public key should have %d bytes", ed25519.PublicKeySize)
+			return
+		}
+		valid = ed25519.Verify(ed25519.PublicKey(key), data, signature)
+	}
+	if !valid {
+		err = fmt.Errorf("Signature of message isn't valid")
+	}
+	return
+}
+
+// encrypt encrypts data with AES-GCM. The result contains the random nonce followed by the
+// encrypted data, and the identifier of the key is authenticated as additional data.
+func encrypt(key []byte, id string, data []byte) (result []byte, err error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return
+	}
+	result = aead.Seal(nonce, nonce, data, []byte(id))
+	return
+}
+
+// decrypt decrypts data encrypted with encrypt.
+func decrypt(key []byte, id string, data []byte) (result []byte, err error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return
+	}
+	if len(data) < aead.NonceSize() {
+		err = fmt.Errorf("Encrypted body is too short")
+		return
+	}
+	nonce, data := data[:aead.NonceSize()], data[aead.NonceSize():]
+	result, err = aead.Open(nil, nonce, data, []byte(id))
+	if err != nil {
+		err = fmt.Errorf("Can't decrypt body: %s", err.Error())
+	}
+	return
+}
+
+// newAEAD creates the AES-GCM cipher for a key.
+func newAEAD(key []byte) (aead cipher.AEAD, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return
+	}
+	aead, err = cipher.NewGCM(block)
+	return
+}
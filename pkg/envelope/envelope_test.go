@@ -0,0 +1,210 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envelope
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+)
+
+// newKeys creates a key provider with random keys.
+func newKeys() *StaticKeys {
+	secret := make([]byte, 32)
+	aesKey := make([]byte, 32)
+	rand.Read(secret)
+	rand.Read(aesKey)
+	return &StaticKeys{
+		SigningKeyID:    "s1",
+		SigningKeys:     map[string][]byte{"s1": secret},
+		EncryptionKeyID: "e1",
+		EncryptionKeys:  map[string][]byte{"e1": aesKey},
+	}
+}
+
+func TestSealAndOpen(t *testing.T) {
+	keys := newKeys()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Can't generate Ed25519 key: %s", err.Error())
+	}
+	edKeys := &StaticKeys{
+		SigningKeyID:     "ed1",
+		SigningKeys:      map[string][]byte{"ed1": private},
+		VerificationKeys: map[string][]byte{"ed1": public},
+	}
+	// The receivers of Ed25519 signatures only need the public key.
+	edReceiverKeys := &StaticKeys{
+		VerificationKeys: map[string][]byte{"ed1": public},
+	}
+
+	tests := []struct {
+		name       string
+		sender     KeyProvider
+		receiver   KeyProvider
+		signing    SigningAlgorithm
+		encryption EncryptionAlgorithm
+	}{
+		{"hmac", keys, keys, HMACSHA256, ""},
+		{"aes", keys, keys, "", AESGCM},
+		{"hmac and aes", keys, keys, HMACSHA256, AESGCM},
+		{"ed25519", edKeys, edReceiverKeys, Ed25519, ""},
+	}
+	body := []byte(`{"kind": "Secret"}`)
+	for _, test := range tests {
+		sender, err := New(test.sender, test.signing, test.encryption)
+		if err != nil {
+			t.Fatalf("%s: can't create envelope: %s", test.name, err.Error())
+		}
+		receiver, err := New(test.receiver, test.signing, test.encryption)
+		if err != nil {
+			t.Fatalf("%s: can't create envelope: %s", test.name, err.Error())
+		}
+
+		header := map[string]string{
+			"content-type": "application/json",
+			"reply-to":     "/queue/responses",
+		}
+		sealed, err := sender.Seal(header, body)
+		if err != nil {
+			t.Fatalf("%s: can't seal: %s", test.name, err.Error())
+		}
+		if test.encryption != "" && bytes.Contains(sealed, []byte("Secret")) {
+			t.Errorf("%s: body isn't encrypted", test.name)
+		}
+
+		// Any change of the body or of the signed headers is detected.
+		if test.signing != "" {
+			tampered := append([]byte{}, sealed...)
+			tampered[len(tampered)-1] ^= 1
+			_, err = receiver.Open(copyHeader(header), tampered)
+			if err == nil {
+				t.Errorf("%s: expected tampered body to be rejected", test.name)
+			}
+			for name, value := range map[string]string{
+				"content-type":   "text/plain",
+				"reply-to":       "/queue/attacker",
+				"correlation-id": "other",
+				"claim-check":    "other",
+			} {
+				changed := copyHeader(header)
+				changed[name] = value
+				_, err = receiver.Open(changed, sealed)
+				if err == nil {
+					t.Errorf("%s: expected tampered '%s' header to be rejected", test.name, name)
+				}
+			}
+		}
+
+		opened, err := receiver.Open(header, sealed)
+		if err != nil {
+			t.Fatalf("%s: can't open: %s", test.name, err.Error())
+		}
+		if !bytes.Equal(opened, body) {
+			t.Errorf("%s: opened body is different", test.name)
+		}
+		if len(header) != 2 {
+			t.Errorf("%s: expected envelope headers to be removed, got %v", test.name, header)
+		}
+	}
+}
+
+func TestRejectsPlainMessages(t *testing.T) {
+	keys := newKeys()
+	e, err := New(keys, HMACSHA256, AESGCM)
+	if err != nil {
+		t.Fatalf("Can't create envelope: %s", err.Error())
+	}
+	_, err = e.Open(map[string]string{}, []byte("{}"))
+	if err == nil {
+		t.Error("Expected unsigned message to be rejected")
+	}
+
+	// Signed but not encrypted messages are rejected too.
+	signer, _ := New(keys, HMACSHA256, "")
+	header := map[string]string{}
+	body, _ := signer.Seal(header, []byte("{}"))
+	_, err = e.Open(header, body)
+	if err == nil {
+		t.Error("Expected unencrypted message to be rejected")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	keys := newKeys()
+	e, _ := New(keys, HMACSHA256, AESGCM)
+	header := map[string]string{}
+	sealed, err := e.Seal(header, []byte("old"))
+	if err != nil {
+		t.Fatalf("Can't seal: %s", err.Error())
+	}
+
+	// Rotate the keys, the old messages can still be opened while the old keys are kept.
+	newSecret := make([]byte, 32)
+	newAESKey := make([]byte, 16)
+	rand.Read(newSecret)
+	rand.Read(newAESKey)
+	keys.SigningKeyID = "s2"
+	keys.SigningKeys["s2"] = newSecret
+	keys.EncryptionKeyID = "e2"
+	keys.EncryptionKeys["e2"] = newAESKey
+
+	newHeader := map[string]string{}
+	_, err = e.Seal(newHeader, []byte("new"))
+	if err != nil {
+		t.Fatalf("Can't seal: %s", err.Error())
+	}
+	if newHeader[SignatureKeyHeader] != "s2" || newHeader[EncryptionKeyHeader] != "e2" {
+		t.Errorf("Expected the new keys to be used, got %v", newHeader)
+	}
+	opened, err := e.Open(header, sealed)
+	if err != nil || string(opened) != "old" {
+		t.Errorf("Can't open message sealed with the old keys: %v", err)
+	}
+
+	// Once the old keys are removed the old messages can't be opened.
+	delete(keys.SigningKeys, "s1")
+	_, err = e.Open(copyHeader(header), sealed)
+	if err == nil {
+		t.Error("Expected message signed with a removed key to be rejected")
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(nil, HMACSHA256, "")
+	if err == nil {
+		t.Error("Expected an error without key provider")
+	}
+	_, err = New(&StaticKeys{}, "md5", "")
+	if err == nil {
+		t.Error("Expected an error for an unsupported signing algorithm")
+	}
+	_, err = New(&StaticKeys{}, "", "rot13")
+	if err == nil {
+		t.Error("Expected an error for an unsupported encryption algorithm")
+	}
+}
+
+// copyHeader returns a copy of a header.
+func copyHeader(header map[string]string) map[string]string {
+	result := make(map[string]string, len(header))
+	for key, value := range header {
+		result[key] = value
+	}
+	return result
+}
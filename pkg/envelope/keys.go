@@ -0,0 +1,121 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envelope
+
+import (
+	"fmt"
+)
+
+// KeyProvider supplies the keys used to sign, verify, encrypt and decrypt messages. Keys are
+// identified by name, and the identifier of the key used for a message is sent with it, so
+// that keys can be rotated: new messages use the current key, and the messages sent before the
+// rotation can still be opened with the previous keys.
+//
+// For HMAC signatures the signing and verification keys are the same secret, for Ed25519
+// signatures they are the ed25519.PrivateKey and the ed25519.PublicKey. Encryption keys are
+// AES keys of 16, 24 or 32 bytes.
+type KeyProvider interface {
+	// SigningKey returns the identifier and the value of the key used to sign new messages.
+	SigningKey() (id string, key []byte, err error)
+
+	// VerificationKey returns the key used to verify the signatures made with the signing key
+	// with the given identifier.
+	VerificationKey(id string) (key []byte, err error)
+
+	// EncryptionKey returns the identifier and the value of the key used to encrypt new
+	// messages.
+	EncryptionKey() (id string, key []byte, err error)
+
+	// DecryptionKey returns the key with the given identifier, used to decrypt messages.
+	DecryptionKey(id string) (key []byte, err error)
+}
+
+// StaticKeys is a key provider that keeps the keys in memory.
+//
+// For example:
+//
+//	keys := &envelope.StaticKeys{
+//	  SigningKeyID: "2018-06",
+//	  SigningKeys: map[string][]byte{
+//	    "2018-05": oldSecret,
+//	    "2018-06": newSecret,
+//	  },
+//	  EncryptionKeyID: "2018-06",
+//	  EncryptionKeys: map[string][]byte{
+//	    "2018-06": aesKey,
+//	  },
+//	}
+type StaticKeys struct {
+	// SigningKeyID is the identifier of the key used to sign new messages.
+	SigningKeyID string
+
+	// SigningKeys are the keys used to sign messages, indexed by identifier.
+	SigningKeys map[string][]byte
+
+	// VerificationKeys are the keys used to verify signatures, indexed by identifier. When a
+	// key isn't found here the signing key with the same identifier is used, as needed for
+	// HMAC. Ed25519 signatures need the public keys here, unless the private keys are also
+	// available.
+	VerificationKeys map[string][]byte
+
+	// EncryptionKeyID is the identifier of the key used to encrypt new messages.
+	EncryptionKeyID string
+
+	// EncryptionKeys are the keys used to encrypt and decrypt messages, indexed by identifier.
+	EncryptionKeys map[string][]byte
+}
+
+// Make sure we implement the key provider interface.
+var _ KeyProvider = &StaticKeys{}
+
+// SigningKey returns the current signing key.
+func (k *StaticKeys) SigningKey() (id string, key []byte, err error) {
+	id = k.SigningKeyID
+	key, err = lookupKey(k.SigningKeys, id, "signing")
+	return
+}
+
+// VerificationKey returns the verification key with the given identifier.
+func (k *StaticKeys) VerificationKey(id string) (key []byte, err error) {
+	if key, ok := k.VerificationKeys[id]; ok {
+		return key, nil
+	}
+	key, err = lookupKey(k.SigningKeys, id, "verification")
+	return
+}
+
+// EncryptionKey returns the current encryption key.
+func (k *StaticKeys) EncryptionKey() (id string, key []byte, err error) {
+	id = k.EncryptionKeyID
+	key, err = lookupKey(k.EncryptionKeys, id, "encryption")
+	return
+}
+
+// DecryptionKey returns the encryption key with the given identifier.
+func (k *StaticKeys) DecryptionKey(id string) (key []byte, err error) {
+	key, err = lookupKey(k.EncryptionKeys, id, "decryption")
+	return
+}
+
+// lookupKey finds a key in a map, or returns an error explaining which key is missing.
+func lookupKey(keys map[string][]byte, id string, purpose string) (key []byte, err error) {
+	key, ok := keys[id]
+	if !ok {
+		err = fmt.Errorf("Can't find %s key '%s'", purpose, id)
+	}
+	return
+}
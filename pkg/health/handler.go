@@ -0,0 +1,67 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package health contains an HTTP handler that serves the health reports of connections, for
+// use by liveness and readiness probes.
+//
+// For example:
+//
+//	http.Handle("/", health.Handler(c))
+//	go http.ListenAndServe(":8080", nil)
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// Handler returns an HTTP handler that serves the health reports of the given connections, in
+// JSON format, at the "/healthz" and "/readyz" paths.
+//
+// The "/healthz" path responds with status 200 if all the connections are alive, and the
+// "/readyz" path responds with status 200 if all the connections are alive and all their
+// subscriptions are receiving messages. Otherwise they respond with status 503.
+func Handler(connections ...client.Connection) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		serve(w, connections, func(health client.Health) bool {
+			return health.Connected
+		})
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		serve(w, connections, client.Health.Ready)
+	})
+	return mux
+}
+
+// serve writes the health reports of the connections, with a status that depends on the result
+// of the check for each one of them.
+func serve(w http.ResponseWriter, connections []client.Connection, check func(client.Health) bool) {
+	status := http.StatusOK
+	reports := make([]client.Health, len(connections))
+	for i, connection := range connections {
+		reports[i] = connection.Health()
+		if !check(reports[i]) {
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(reports)
+}
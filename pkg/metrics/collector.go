@@ -0,0 +1,291 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics contains a Prometheus collector that measures the activity of the connections,
+// requestors and responders of the messaging library.
+//
+// For example:
+//
+//	collector := metrics.NewCollector(metrics.CollectorSpec{})
+//	prometheus.MustRegister(collector)
+//
+//	spec := &client.ConnectionSpec{
+//		BrokerHost: "localhost",
+//		BrokerPort: 61613,
+//	}
+//	collector.Instrument(spec)
+//	c, err := stomp.NewConnection(spec)
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// CollectorSpec is a helper struct for building collectors.
+type CollectorSpec struct {
+	// Namespace is the prefix of the names of the metrics. The default is "messaging".
+	Namespace string
+
+	// Buckets are the upper bounds, in seconds, of the buckets of the histograms. The default
+	// is prometheus.DefBuckets.
+	Buckets []float64
+}
+
+// Collector measures the messages published and received, the time spent publishing and handling
+// them, and the requests sent by requestors. It is a prometheus.Collector, so it can be
+// registered in a Prometheus registry.
+//
+// The following metrics are collected, all of them with the "messaging" prefix by default:
+//
+//	messaging_messages_published_total{destination}
+//	messaging_publish_errors_total{destination}
+//	messaging_publish_duration_seconds{destination}
+//	messaging_messages_received_total{destination}
+//	messaging_handler_duration_seconds{destination}
+//	messaging_handler_errors_total{destination}
+//	messaging_connections_total{broker}
+//	messaging_pending_requests{destination}
+//	messaging_request_duration_seconds{destination}
+//	messaging_throttled_seconds_total{destination}
+//
+// The destination of the request metrics is the requests queue. The connections don't reconnect
+// automatically, so each new connection to a broker is counted, not reconnects.
+type Collector struct {
+	published       *prometheus.CounterVec
+	publishErrors   *prometheus.CounterVec
+	publishDuration *prometheus.HistogramVec
+	received        *prometheus.CounterVec
+	handlerDuration *prometheus.HistogramVec
+	handlerErrors   *prometheus.CounterVec
+	connections     *prometheus.CounterVec
+	pendingRequests *prometheus.GaugeVec
+	requestDuration *prometheus.HistogramVec
+	throttled       *prometheus.CounterVec
+}
+
+// NewCollector creates a new collector without measurements.
+func NewCollector(spec CollectorSpec) *Collector {
+	// Init the values that weren't given:
+	namespace := spec.Namespace
+	if namespace == "" {
+		namespace = "messaging"
+	}
+	buckets := spec.Buckets
+	if buckets == nil {
+		buckets = prometheus.DefBuckets
+	}
+
+	destination := []string{"destination"}
+
+	return &Collector{
+		published: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "messages_published_total",
+				Help:      "Number of messages published.",
+			},
+			destination,
+		),
+		publishErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "publish_errors_total",
+				Help:      "Number of messages that couldn't be published.",
+			},
+			destination,
+		),
+		publishDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "publish_duration_seconds",
+				Help:      "Time spent publishing messages.",
+				Buckets:   buckets,
+			},
+			destination,
+		),
+		received: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "messages_received_total",
+				Help:      "Number of messages received.",
+			},
+			destination,
+		),
+		handlerDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "handler_duration_seconds",
+				Help:      "Time spent handling received messages.",
+				Buckets:   buckets,
+			},
+			destination,
+		),
+		handlerErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "handler_errors_total",
+				Help:      "Number of received messages whose handler returned an error.",
+			},
+			destination,
+		),
+		connections: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "connections_total",
+				Help:      "Number of connections established to a broker.",
+			},
+			[]string{"broker"},
+		),
+		pendingRequests: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "pending_requests",
+				Help:      "Number of requests waiting for responses.",
+			},
+			destination,
+		),
+		requestDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "request_duration_seconds",
+				Help:      "Time between sending a request and receiving a response.",
+				Buckets:   buckets,
+			},
+			destination,
+		),
+		throttled: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "throttled_seconds_total",
+				Help:      "Time spent waiting for rate limiters.",
+			},
+			destination,
+		),
+	}
+}
+
+// collectors returns the Prometheus collectors of all the metrics.
+func (c *Collector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.published,
+		c.publishErrors,
+		c.publishDuration,
+		c.received,
+		c.handlerDuration,
+		c.handlerErrors,
+		c.connections,
+		c.pendingRequests,
+		c.requestDuration,
+		c.throttled,
+	}
+}
+
+// Describe sends the descriptors of the metrics to the given channel. It is part of the
+// prometheus.Collector interface.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, collector := range c.collectors() {
+		collector.Describe(ch)
+	}
+}
+
+// Collect sends the current values of the metrics to the given channel. It is part of the
+// prometheus.Collector interface.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, collector := range c.collectors() {
+		collector.Collect(ch)
+	}
+}
+
+// Instrument adds the middleware of the collector to a connection specification, and sets the
+// collector as its metrics receiver, so that the connection created with it, and its requestors
+// and responders, are measured.
+func (c *Collector) Instrument(spec *client.ConnectionSpec) {
+	spec.PublishMiddleware = append(
+		[]client.PublishMiddleware{c.PublishMiddleware},
+		spec.PublishMiddleware...,
+	)
+	spec.SubscriptionMiddleware = append(
+		[]client.SubscriptionMiddleware{c.SubscriptionMiddleware},
+		spec.SubscriptionMiddleware...,
+	)
+	spec.Metrics = c
+}
+
+// PublishMiddleware counts the published messages and measures the time spent publishing them.
+func (c *Collector) PublishMiddleware(next client.PublishHandler) client.PublishHandler {
+	return func(m client.Message, destination string) (err error) {
+		start := time.Now()
+		err = next(m, destination)
+		c.publishDuration.WithLabelValues(destination).Observe(time.Since(start).Seconds())
+		c.published.WithLabelValues(destination).Inc()
+		if err != nil {
+			c.publishErrors.WithLabelValues(destination).Inc()
+		}
+		return
+	}
+}
+
+// SubscriptionMiddleware counts the received messages and measures the time spent handling them.
+// The errors reported by the broker aren't counted as received messages.
+func (c *Collector) SubscriptionMiddleware(next client.SubscriptionCallback) client.SubscriptionCallback {
+	return func(m client.Message, destination string) (err error) {
+		if m.Err != nil {
+			return next(m, destination)
+		}
+		c.received.WithLabelValues(destination).Inc()
+		start := time.Now()
+		err = next(m, destination)
+		c.handlerDuration.WithLabelValues(destination).Observe(time.Since(start).Seconds())
+		if err != nil {
+			c.handlerErrors.WithLabelValues(destination).Inc()
+		}
+		return
+	}
+}
+
+// Connected counts the connections established to a broker. It is part of the client.Metrics
+// interface.
+func (c *Collector) Connected(broker string) {
+	c.connections.WithLabelValues(broker).Inc()
+}
+
+// RequestStarted increases the number of pending requests. It is part of the client.Metrics
+// interface.
+func (c *Collector) RequestStarted(destination string) {
+	c.pendingRequests.WithLabelValues(destination).Inc()
+}
+
+// RequestFinished decreases the number of pending requests. It is part of the client.Metrics
+// interface.
+func (c *Collector) RequestFinished(destination string) {
+	c.pendingRequests.WithLabelValues(destination).Dec()
+}
+
+// ResponseReceived measures the round trip time of a request. It is part of the client.Metrics
+// interface.
+func (c *Collector) ResponseReceived(destination string, roundTrip time.Duration) {
+	c.requestDuration.WithLabelValues(destination).Observe(roundTrip.Seconds())
+}
+
+// Throttled adds the time spent waiting for a rate limiter. It is part of the client.Metrics
+// interface.
+func (c *Collector) Throttled(destination string, wait time.Duration) {
+	c.throttled.WithLabelValues(destination).Add(wait.Seconds())
+}
@@ -0,0 +1,100 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+func TestMiddleware(t *testing.T) {
+	collector := NewCollector(CollectorSpec{})
+
+	publish := collector.PublishMiddleware(func(m client.Message, destination string) error {
+		if m.Data["fail"] == true {
+			return fmt.Errorf("Publish failed")
+		}
+		return nil
+	})
+	publish(client.Message{Data: client.MessageData{}}, "queue")
+	publish(client.Message{Data: client.MessageData{"fail": true}}, "queue")
+
+	deliver := collector.SubscriptionMiddleware(func(m client.Message, destination string) error {
+		return fmt.Errorf("Handler failed")
+	})
+	deliver(client.Message{Data: client.MessageData{}}, "queue")
+	deliver(client.Message{Err: fmt.Errorf("Connection closed")}, "queue")
+
+	checks := []struct {
+		name     string
+		value    float64
+		expected float64
+	}{
+		{"published", testutil.ToFloat64(collector.published.WithLabelValues("queue")), 2},
+		{"publish errors", testutil.ToFloat64(collector.publishErrors.WithLabelValues("queue")), 1},
+		{"received", testutil.ToFloat64(collector.received.WithLabelValues("queue")), 1},
+		{"handler errors", testutil.ToFloat64(collector.handlerErrors.WithLabelValues("queue")), 1},
+	}
+	for _, check := range checks {
+		if check.value != check.expected {
+			t.Errorf("Expected %v %s messages, got %v", check.expected, check.name, check.value)
+		}
+	}
+}
+
+func TestRequestsAndConnections(t *testing.T) {
+	collector := NewCollector(CollectorSpec{})
+
+	collector.Connected("localhost:61613")
+	collector.Connected("localhost:61613")
+	collector.Connected("localhost:61614")
+	connections := testutil.ToFloat64(collector.connections.WithLabelValues("localhost:61613"))
+	if connections != 2 {
+		t.Errorf("Expected 2 connections, got %v", connections)
+	}
+
+	collector.RequestStarted("requests")
+	collector.RequestStarted("requests")
+	collector.ResponseReceived("requests", 10*time.Millisecond)
+	collector.RequestFinished("requests")
+	pending := testutil.ToFloat64(collector.pendingRequests.WithLabelValues("requests"))
+	if pending != 1 {
+		t.Errorf("Expected 1 pending request, got %v", pending)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	collector := NewCollector(CollectorSpec{Namespace: "test"})
+	collector.RequestStarted("requests")
+
+	recorder := httptest.NewRecorder()
+	Handler(collector).ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(recorder.Body)
+
+	expected := `test_pending_requests{destination="requests"} 1`
+	if !strings.Contains(string(body), expected) {
+		t.Errorf("Expected metrics to contain '%s', got:\n%s", expected, body)
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package protobuf sends and receives messages whose bodies are Protocol Buffers, decoding the
+// received bodies into the concrete types registered by the receiver.
+package protobuf
+
+import (
+	"fmt"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// ContentType is the content type of the messages whose bodies are Protocol Buffers.
+const ContentType = "application/x-protobuf"
+
+// MessageTypeHeader is the header containing the full name of the type of the body, for example
+// "google.protobuf.Timestamp".
+const MessageTypeHeader = "message-type"
+
+// Encode converts a Protocol Buffers message into a message that can be published.
+//
+// For example:
+//
+//	m, err := protobuf.Encode(&pb.OrderCreated{Id: id})
+//	err = c.Publish(m, "/queue/orders")
+func Encode(pm proto.Message) (m client.Message, err error) {
+	body, err := proto.Marshal(pm)
+	if err != nil {
+		err = fmt.Errorf(
+			"Can't marshal message of type '%s': %s",
+			pm.ProtoReflect().Descriptor().FullName(),
+			err.Error(),
+		)
+		return
+	}
+	m = client.Message{
+		ContentType: ContentType,
+		Data:        client.MessageData{"byteArray": body},
+		Header: map[string]string{
+			MessageTypeHeader: string(pm.ProtoReflect().Descriptor().FullName()),
+		},
+	}
+	return
+}
+
+// Registry contains the types of the Protocol Buffers messages that a receiver can decode,
+// identified by their full names.
+//
+// For example:
+//
+//	registry := protobuf.NewRegistry()
+//	registry.Register(&pb.OrderCreated{}, &pb.OrderCancelled{})
+type Registry struct {
+	mutex sync.RWMutex
+	types map[protoreflect.FullName]protoreflect.MessageType
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		types: make(map[protoreflect.FullName]protoreflect.MessageType),
+	}
+}
+
+// Register adds the types of the given messages to the registry. The values of the messages
+// aren't used, only their types.
+func (r *Registry) Register(prototypes ...proto.Message) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, prototype := range prototypes {
+		messageType := prototype.ProtoReflect().Type()
+		r.types[messageType.Descriptor().FullName()] = messageType
+	}
+}
+
+// Decode converts a received message into a new Protocol Buffers message of the type given by
+// its MessageTypeHeader header, which must be registered.
+func (r *Registry) Decode(m client.Message) (pm proto.Message, err error) {
+	if m.ContentType != ContentType {
+		err = fmt.Errorf("Content type '%s' isn't '%s'", m.ContentType, ContentType)
+		return
+	}
+	name, ok := m.Header[MessageTypeHeader]
+	if !ok {
+		err = fmt.Errorf("Message doesn't contain header '%s'", MessageTypeHeader)
+		return
+	}
+	r.mutex.RLock()
+	messageType, ok := r.types[protoreflect.FullName(name)]
+	r.mutex.RUnlock()
+	if !ok {
+		err = fmt.Errorf("Message type '%s' isn't registered", name)
+		return
+	}
+	body, ok := m.Data["byteArray"].([]byte)
+	if !ok {
+		err = fmt.Errorf("Message of type '%s' doesn't contain a byte array body", name)
+		return
+	}
+
+	pm = messageType.New().Interface()
+	err = proto.Unmarshal(body, pm)
+	if err != nil {
+		err = fmt.Errorf("Can't unmarshal message of type '%s': %s", name, err.Error())
+		pm = nil
+	}
+	return
+}
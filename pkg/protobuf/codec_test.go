@@ -0,0 +1,116 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protobuf
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// receive simulates receiving a message, which the connections try to decode as JSON.
+func receive(m client.Message) client.Message {
+	received := client.Message{ContentType: m.ContentType, Header: m.Header}
+	body := m.Data["byteArray"].([]byte)
+	received.Err = json.Unmarshal(body, &received.Data)
+	if received.Err != nil {
+		received.Data = client.MessageData{"byteArray": body}
+	}
+	return received
+}
+
+func TestRoundTrip(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(&timestamppb.Timestamp{}, &wrapperspb.StringValue{})
+
+	sent := []proto.Message{
+		timestamppb.New(time.Date(2018, 5, 1, 10, 30, 0, 0, time.UTC)),
+		wrapperspb.String("my-value"),
+	}
+	var received []proto.Message
+	callback := Callback(registry, func(pm proto.Message, destination string, err error) error {
+		if err != nil {
+			t.Fatalf("Can't receive message: %s", err.Error())
+		}
+		received = append(received, pm)
+		return nil
+	})
+	for _, pm := range sent {
+		m, err := Encode(pm)
+		if err != nil {
+			t.Fatalf("Can't encode message: %s", err.Error())
+		}
+		if m.ContentType != ContentType {
+			t.Errorf("Unexpected content type '%s'", m.ContentType)
+		}
+		callback(receive(m), "my-destination")
+	}
+
+	// The handler receives the concrete types.
+	if _, ok := received[0].(*timestamppb.Timestamp); !ok {
+		t.Errorf("Expected a timestamp, got %T", received[0])
+	}
+	if value, ok := received[1].(*wrapperspb.StringValue); !ok || value.Value != "my-value" {
+		t.Errorf("Expected a string value, got %v", received[1])
+	}
+	for i := range sent {
+		if !proto.Equal(sent[i], received[i]) {
+			t.Errorf("Received '%v' expected '%v'", received[i], sent[i])
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(&timestamppb.Timestamp{})
+
+	// Types that aren't registered can't be decoded.
+	m, _ := Encode(wrapperspb.String("my-value"))
+	_, err := registry.Decode(receive(m))
+	if err == nil {
+		t.Error("Expected an error for a type that isn't registered")
+	}
+
+	// Messages must have the content type and the type header.
+	m, _ = Encode(timestamppb.Now())
+	delete(m.Header, MessageTypeHeader)
+	_, err = registry.Decode(receive(m))
+	if err == nil {
+		t.Error("Expected an error for a message without type")
+	}
+	_, err = registry.Decode(client.Message{Data: client.MessageData{"name": "my-object"}})
+	if err == nil {
+		t.Error("Expected an error for a JSON message")
+	}
+
+	// Bodies that aren't valid are reported.
+	m = client.Message{
+		ContentType: ContentType,
+		Header:      map[string]string{MessageTypeHeader: "google.protobuf.Timestamp"},
+		Data:        client.MessageData{"byteArray": []byte{0xff, 0xff}},
+	}
+	_, err = registry.Decode(m)
+	if err == nil {
+		t.Error("Expected an error for an invalid body")
+	}
+}
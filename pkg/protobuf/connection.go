@@ -0,0 +1,72 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protobuf
+
+import (
+	"google.golang.org/protobuf/proto"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// Handler is the type of the functions that receive the Protocol Buffers messages of a
+// subscription. Messages that can't be received or decoded are delivered with the error in err.
+//
+// For example:
+//
+//	func handler(pm proto.Message, destination string, err error) error {
+//		if err != nil {
+//			return err
+//		}
+//		switch order := pm.(type) {
+//		case *pb.OrderCreated:
+//			glog.Infof("Order '%s' created", order.Id)
+//		case *pb.OrderCancelled:
+//			glog.Infof("Order '%s' cancelled", order.Id)
+//		}
+//		return nil
+//	}
+type Handler func(pm proto.Message, destination string, err error) error
+
+// Publish sends a Protocol Buffers message to a destination.
+func Publish(c client.Connection, pm proto.Message, destination string) (err error) {
+	m, err := Encode(pm)
+	if err != nil {
+		return
+	}
+	err = c.Publish(m, destination)
+	return
+}
+
+// Subscribe creates a subscription that decodes the messages received from a destination with
+// the types of the registry, and delivers them to a handler.
+func Subscribe(c client.Connection, destination string, registry *Registry,
+	handler Handler) error {
+	return c.Subscribe(destination, Callback(registry, handler))
+}
+
+// Callback returns a subscription callback that decodes the received messages with the types of
+// the registry and delivers them to a handler. It can be used to receive messages with the
+// additional options of SubscribeWithSpec.
+func Callback(registry *Registry, handler Handler) client.SubscriptionCallback {
+	return client.TolerateDecodeErrors(func(m client.Message, destination string) error {
+		if m.Err != nil {
+			return handler(nil, destination, m.Err)
+		}
+		pm, err := registry.Decode(m)
+		return handler(pm, destination, err)
+	})
+}
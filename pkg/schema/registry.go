@@ -0,0 +1,143 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package schema validates the data of messages with JSON schemas.
+package schema
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Registry contains JSON schemas identified by name. Schemas can be added from byte slices, for
+// example embedded in the program, or loaded from files.
+//
+// For example:
+//
+//	registry := schema.NewRegistry()
+//	err = registry.Add("Event", []byte(`{
+//	  "type": "object",
+//	  "required": ["kind", "spec"]
+//	}`))
+type Registry struct {
+	mutex   sync.RWMutex
+	schemas map[string]*gojsonschema.Schema
+}
+
+// ValidationError is the error returned when data doesn't match a schema.
+type ValidationError struct {
+	// Schema is the name of the schema.
+	Schema string
+
+	// Problems describes the parts of the data that don't match the schema.
+	Problems []string
+}
+
+// Error returns a description of the error, including all the problems found.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf(
+		"Data doesn't match schema '%s': %s",
+		e.Schema,
+		strings.Join(e.Problems, "; "),
+	)
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		schemas: make(map[string]*gojsonschema.Schema),
+	}
+}
+
+// Add compiles a schema and adds it to the registry, replacing the schema with the same name if
+// it exists.
+func (r *Registry) Add(name string, schema []byte) (err error) {
+	compiled, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(schema))
+	if err != nil {
+		err = fmt.Errorf("Can't compile schema '%s': %s", name, err.Error())
+		return
+	}
+	r.mutex.Lock()
+	r.schemas[name] = compiled
+	r.mutex.Unlock()
+	return
+}
+
+// LoadFile adds the schema contained in a file.
+func (r *Registry) LoadFile(name string, path string) (err error) {
+	schema, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	err = r.Add(name, schema)
+	return
+}
+
+// LoadDir adds the schemas contained in the .json files of a directory, named after the files
+// without the extension. For example, the schema in "Event.json" is named "Event".
+func (r *Registry) LoadDir(dir string) (err error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return
+	}
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		err = r.LoadFile(name, path)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Has checks if the registry contains a schema.
+func (r *Registry) Has(name string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	_, ok := r.schemas[name]
+	return ok
+}
+
+// Validate checks data with a schema. If the data doesn't match the schema the returned error is
+// a *ValidationError.
+func (r *Registry) Validate(name string, data interface{}) (err error) {
+	r.mutex.RLock()
+	compiled, ok := r.schemas[name]
+	r.mutex.RUnlock()
+	if !ok {
+		err = fmt.Errorf("Can't find schema '%s'", name)
+		return
+	}
+
+	result, err := compiled.Validate(gojsonschema.NewGoLoader(data))
+	if err != nil {
+		err = fmt.Errorf("Can't validate data with schema '%s': %s", name, err.Error())
+		return
+	}
+	if !result.Valid() {
+		validationErr := &ValidationError{Schema: name}
+		for _, problem := range result.Errors() {
+			validationErr.Problems = append(validationErr.Problems, problem.String())
+		}
+		err = validationErr
+	}
+	return
+}
@@ -0,0 +1,104 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const eventSchema = `{
+	"type": "object",
+	"required": ["kind", "spec"],
+	"properties": {
+		"kind": {"const": "Event"},
+		"spec": {
+			"type": "object",
+			"required": ["priority"],
+			"properties": {
+				"priority": {"type": "integer", "minimum": 1}
+			}
+		}
+	}
+}`
+
+func TestValidate(t *testing.T) {
+	registry := NewRegistry()
+	err := registry.Add("Event", []byte(eventSchema))
+	if err != nil {
+		t.Fatalf("Can't add schema: %s", err.Error())
+	}
+
+	valid := map[string]interface{}{
+		"kind": "Event",
+		"spec": map[string]interface{}{"priority": 5.0},
+	}
+	err = registry.Validate("Event", valid)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+
+	invalid := map[string]interface{}{
+		"kind": "Event",
+		"spec": map[string]interface{}{"priority": 0.0},
+	}
+	err = registry.Validate("Event", invalid)
+	validationErr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+	if validationErr.Schema != "Event" || len(validationErr.Problems) != 1 {
+		t.Errorf("Unexpected validation error: %s", validationErr.Error())
+	}
+
+	// Unknown schemas and invalid schemas are reported.
+	err = registry.Validate("Unknown", valid)
+	if err == nil {
+		t.Error("Expected an error for an unknown schema")
+	}
+	err = registry.Add("Broken", []byte(`{"type": 42}`))
+	if err == nil {
+		t.Error("Expected an error for an invalid schema")
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schemas")
+	if err != nil {
+		t.Fatalf("Can't create directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "Event.json"), []byte(eventSchema), 0600)
+	if err != nil {
+		t.Fatalf("Can't write schema: %s", err.Error())
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "README.txt"), []byte("Not a schema"), 0600)
+	if err != nil {
+		t.Fatalf("Can't write file: %s", err.Error())
+	}
+
+	registry := NewRegistry()
+	err = registry.LoadDir(dir)
+	if err != nil {
+		t.Fatalf("Can't load directory: %s", err.Error())
+	}
+	if !registry.Has("Event") || registry.Has("README") {
+		t.Error("Expected only the 'Event' schema to be loaded")
+	}
+}
@@ -0,0 +1,331 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package selector
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// node is a node of the tree of a selector expression. Evaluating a node returns a float64, a
+// string, a bool, or nil when the value is unknown.
+type node interface {
+	eval(m client.Message) interface{}
+}
+
+// comparisons are the comparison operators.
+var comparisons = map[string]bool{
+	"=":  true,
+	"<>": true,
+	"<":  true,
+	">":  true,
+	"<=": true,
+	">=": true,
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n literalNode) eval(m client.Message) interface{} {
+	return n.value
+}
+
+type identifierNode struct {
+	name string
+}
+
+// eval returns the value of the header with the name of the identifier, or the value of the
+// top level data field if there is no such header. Values that aren't numbers, strings or
+// booleans are unknown.
+func (n identifierNode) eval(m client.Message) interface{} {
+	if value, ok := m.Header[n.name]; ok {
+		return value
+	}
+	switch value := m.Data[n.name].(type) {
+	case float64, string, bool:
+		return value
+	case int:
+		return float64(value)
+	case int64:
+		return float64(value)
+	}
+	return nil
+}
+
+type andNode struct {
+	left, right node
+}
+
+func (n andNode) eval(m client.Message) interface{} {
+	left := toBool(n.left.eval(m))
+	if left == false {
+		return false
+	}
+	right := toBool(n.right.eval(m))
+	if right == false {
+		return false
+	}
+	if left == true && right == true {
+		return true
+	}
+	return nil
+}
+
+type orNode struct {
+	left, right node
+}
+
+func (n orNode) eval(m client.Message) interface{} {
+	left := toBool(n.left.eval(m))
+	if left == true {
+		return true
+	}
+	right := toBool(n.right.eval(m))
+	if right == true {
+		return true
+	}
+	if left == false && right == false {
+		return false
+	}
+	return nil
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n notNode) eval(m client.Message) interface{} {
+	switch value := toBool(n.operand.eval(m)).(type) {
+	case bool:
+		return !value
+	}
+	return nil
+}
+
+type comparisonNode struct {
+	operator    string
+	left, right node
+}
+
+func (n comparisonNode) eval(m client.Message) interface{} {
+	left, right := coerce(n.left.eval(m), n.right.eval(m))
+	if left == nil || right == nil {
+		return nil
+	}
+
+	// Equality applies to all the types:
+	switch n.operator {
+	case "=":
+		return left == right
+	case "<>":
+		return left != right
+	}
+
+	// Order applies only to numbers:
+	x, ok := left.(float64)
+	if !ok {
+		return nil
+	}
+	y, ok := right.(float64)
+	if !ok {
+		return nil
+	}
+	switch n.operator {
+	case "<":
+		return x < y
+	case ">":
+		return x > y
+	case "<=":
+		return x <= y
+	default:
+		return x >= y
+	}
+}
+
+type arithmeticNode struct {
+	operator    string
+	left, right node
+}
+
+func (n arithmeticNode) eval(m client.Message) interface{} {
+	x, ok := toNumber(n.left.eval(m)).(float64)
+	if !ok {
+		return nil
+	}
+	y, ok := toNumber(n.right.eval(m)).(float64)
+	if !ok {
+		return nil
+	}
+	switch n.operator {
+	case "+":
+		return x + y
+	case "-":
+		return x - y
+	case "*":
+		return x * y
+	default:
+		if y == 0 {
+			return nil
+		}
+		return x / y
+	}
+}
+
+type betweenNode struct {
+	operand, low, high node
+}
+
+func (n betweenNode) eval(m client.Message) interface{} {
+	low := comparisonNode{operator: ">=", left: n.operand, right: n.low}.eval(m)
+	high := comparisonNode{operator: "<=", left: n.operand, right: n.high}.eval(m)
+	return andNode{left: literalNode{value: low}, right: literalNode{value: high}}.eval(m)
+}
+
+type inNode struct {
+	operand node
+	values  []interface{}
+}
+
+func (n inNode) eval(m client.Message) interface{} {
+	operand := n.operand.eval(m)
+	if operand == nil {
+		return nil
+	}
+	for _, value := range n.values {
+		left, right := coerce(operand, value)
+		if left != nil && left == right {
+			return true
+		}
+	}
+	return false
+}
+
+type likeNode struct {
+	operand node
+	pattern *regexp.Regexp
+}
+
+// newLikeNode translates the pattern of a LIKE predicate into a regular expression, where '%'
+// matches any sequence of characters and '_' matches any single character.
+func newLikeNode(operand node, pattern string, escape string) (result node, err error) {
+	var buffer strings.Builder
+	buffer.WriteString("^(?s:")
+	escaped := false
+	for _, c := range pattern {
+		switch {
+		case escaped:
+			buffer.WriteString(regexp.QuoteMeta(string(c)))
+			escaped = false
+		case escape != "" && string(c) == escape:
+			escaped = true
+		case c == '%':
+			buffer.WriteString(".*")
+		case c == '_':
+			buffer.WriteString(".")
+		default:
+			buffer.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	buffer.WriteString(")$")
+
+	compiled, err := regexp.Compile(buffer.String())
+	if err != nil {
+		return
+	}
+	result = likeNode{operand: operand, pattern: compiled}
+	return
+}
+
+func (n likeNode) eval(m client.Message) interface{} {
+	value, ok := n.operand.eval(m).(string)
+	if !ok {
+		return nil
+	}
+	return n.pattern.MatchString(value)
+}
+
+type nullNode struct {
+	operand node
+	negated bool
+}
+
+func (n nullNode) eval(m client.Message) interface{} {
+	return (n.operand.eval(m) == nil) != n.negated
+}
+
+// toBool converts the strings "true" and "false", used in headers, to booleans. Other values are
+// returned unchanged.
+func toBool(value interface{}) interface{} {
+	if text, ok := value.(string); ok {
+		if parsed, err := strconv.ParseBool(text); err == nil {
+			return parsed
+		}
+	}
+	return value
+}
+
+// toNumber converts strings that contain numbers, used in headers, to numbers. Other values are
+// returned unchanged.
+func toNumber(value interface{}) interface{} {
+	if text, ok := value.(string); ok {
+		if parsed, err := strconv.ParseFloat(text, 64); err == nil {
+			return parsed
+		}
+	}
+	return value
+}
+
+// coerce converts a string to the type of the other value of a comparison, when the other value
+// is a number or a boolean. If the conversion isn't possible the result is unknown.
+func coerce(left, right interface{}) (interface{}, interface{}) {
+	switch right.(type) {
+	case float64:
+		left = toNumber(left)
+	case bool:
+		left = toBool(left)
+	}
+	switch left.(type) {
+	case float64:
+		right = toNumber(right)
+	case bool:
+		right = toBool(right)
+	}
+	if !sameType(left, right) {
+		return nil, nil
+	}
+	return left, right
+}
+
+// sameType checks if two values have the same type.
+func sameType(left, right interface{}) bool {
+	switch left.(type) {
+	case float64:
+		_, ok := right.(float64)
+		return ok
+	case string:
+		_, ok := right.(string)
+		return ok
+	case bool:
+		_, ok := right.(bool)
+		return ok
+	}
+	return false
+}
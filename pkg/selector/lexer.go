@@ -0,0 +1,178 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package selector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// tokenKind is the kind of the tokens of a selector expression.
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdentifier
+	tokenKeyword
+	tokenString
+	tokenNumber
+	tokenOperator
+)
+
+// token is a lexical unit of a selector expression.
+type token struct {
+	kind tokenKind
+
+	// text is the text of identifiers and operators, the upper case text of keywords, and the
+	// unquoted value of strings.
+	text string
+
+	// number is the value of numbers.
+	number float64
+
+	// position is the offset of the token in the expression, used in error messages.
+	position int
+}
+
+// keywords are the reserved words of the selector syntax.
+var keywords = map[string]bool{
+	"AND":     true,
+	"OR":      true,
+	"NOT":     true,
+	"BETWEEN": true,
+	"IN":      true,
+	"LIKE":    true,
+	"ESCAPE":  true,
+	"IS":      true,
+	"NULL":    true,
+	"TRUE":    true,
+	"FALSE":   true,
+}
+
+// operators are the symbols of the selector syntax, the longer ones first, so that they are
+// preferred.
+var operators = []string{"<>", "<=", ">=", "=", "<", ">", "+", "-", "*", "/", "(", ")", ","}
+
+// tokenize splits a selector expression into tokens.
+func tokenize(expression string) (tokens []token, err error) {
+	position := 0
+	for position < len(expression) {
+		c := rune(expression[position])
+		switch {
+		case unicode.IsSpace(c):
+			position++
+
+		case c == '\'':
+			var text string
+			start := position
+			text, position, err = scanString(expression, position)
+			if err != nil {
+				return
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, position: start})
+
+		case unicode.IsDigit(c) || (c == '.' && position+1 < len(expression) &&
+			unicode.IsDigit(rune(expression[position+1]))):
+			start := position
+			for position < len(expression) && isNumberChar(expression, position) {
+				position++
+			}
+			var number float64
+			number, err = strconv.ParseFloat(expression[start:position], 64)
+			if err != nil {
+				err = fmt.Errorf("Invalid number '%s' at position %d", expression[start:position], start)
+				return
+			}
+			tokens = append(tokens, token{kind: tokenNumber, number: number, position: start})
+
+		case isIdentifierStart(c):
+			start := position
+			for position < len(expression) && isIdentifierPart(rune(expression[position])) {
+				position++
+			}
+			text := expression[start:position]
+			if keywords[strings.ToUpper(text)] {
+				tokens = append(tokens, token{kind: tokenKeyword, text: strings.ToUpper(text), position: start})
+			} else {
+				tokens = append(tokens, token{kind: tokenIdentifier, text: text, position: start})
+			}
+
+		default:
+			found := false
+			for _, operator := range operators {
+				if strings.HasPrefix(expression[position:], operator) {
+					tokens = append(tokens, token{kind: tokenOperator, text: operator, position: position})
+					position += len(operator)
+					found = true
+					break
+				}
+			}
+			if !found {
+				err = fmt.Errorf("Unexpected character '%c' at position %d", c, position)
+				return
+			}
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEOF, position: position})
+	return
+}
+
+// scanString reads the string that starts at the given position. Strings are quoted with single
+// quotes, and a quote inside a string is written as two quotes.
+func scanString(expression string, start int) (text string, next int, err error) {
+	var buffer strings.Builder
+	for next = start + 1; next < len(expression); next++ {
+		if expression[next] != '\'' {
+			buffer.WriteByte(expression[next])
+			continue
+		}
+		if next+1 < len(expression) && expression[next+1] == '\'' {
+			buffer.WriteByte('\'')
+			next++
+			continue
+		}
+		text = buffer.String()
+		next++
+		return
+	}
+	err = fmt.Errorf("Unterminated string at position %d", start)
+	return
+}
+
+// isNumberChar checks if the character at the given position is part of a number, including the
+// sign of the exponent.
+func isNumberChar(expression string, position int) bool {
+	c := expression[position]
+	switch {
+	case c >= '0' && c <= '9', c == '.', c == 'e', c == 'E':
+		return true
+	case c == '+' || c == '-':
+		previous := expression[position-1]
+		return previous == 'e' || previous == 'E'
+	}
+	return false
+}
+
+func isIdentifierStart(c rune) bool {
+	return unicode.IsLetter(c) || c == '_' || c == '$'
+}
+
+func isIdentifierPart(c rune) bool {
+	return isIdentifierStart(c) || unicode.IsDigit(c) || c == '.'
+}
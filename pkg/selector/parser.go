@@ -0,0 +1,302 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package selector
+
+import (
+	"fmt"
+)
+
+// parser builds the tree of a selector expression from its tokens, using recursive descent with
+// one function for each precedence level.
+type parser struct {
+	tokens   []token
+	position int
+}
+
+// peek returns the next token, without consuming it.
+func (p *parser) peek() token {
+	return p.tokens[p.position]
+}
+
+// next consumes the next token.
+func (p *parser) next() token {
+	t := p.tokens[p.position]
+	if t.kind != tokenEOF {
+		p.position++
+	}
+	return t
+}
+
+// accept consumes the next token if it is the given keyword or operator.
+func (p *parser) accept(text string) bool {
+	t := p.peek()
+	if (t.kind == tokenKeyword || t.kind == tokenOperator) && t.text == text {
+		p.position++
+		return true
+	}
+	return false
+}
+
+// expect consumes the next token, that must be the given keyword or operator.
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return fmt.Errorf("Expected '%s' at position %d, found %s", text, p.peek().position,
+			p.peek().describe())
+	}
+	return nil
+}
+
+// describe returns a description of the token for error messages.
+func (t token) describe() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return fmt.Sprintf("string '%s'", t.text)
+	case tokenNumber:
+		return fmt.Sprintf("number %v", t.number)
+	default:
+		return fmt.Sprintf("'%s'", t.text)
+	}
+}
+
+// parseOr parses:
+//
+//	or := and { OR and }
+func (p *parser) parseOr() (result node, err error) {
+	result, err = p.parseAnd()
+	for err == nil && p.accept("OR") {
+		var right node
+		right, err = p.parseAnd()
+		result = orNode{left: result, right: right}
+	}
+	return
+}
+
+// parseAnd parses:
+//
+//	and := not { AND not }
+func (p *parser) parseAnd() (result node, err error) {
+	result, err = p.parseNot()
+	for err == nil && p.accept("AND") {
+		var right node
+		right, err = p.parseNot()
+		result = andNode{left: result, right: right}
+	}
+	return
+}
+
+// parseNot parses:
+//
+//	not := NOT not | predicate
+func (p *parser) parseNot() (result node, err error) {
+	if p.accept("NOT") {
+		result, err = p.parseNot()
+		result = notNode{operand: result}
+		return
+	}
+	return p.parsePredicate()
+}
+
+// parsePredicate parses:
+//
+//	predicate := additive [ comparison additive
+//	                      | [NOT] BETWEEN additive AND additive
+//	                      | [NOT] IN '(' literal { ',' literal } ')'
+//	                      | [NOT] LIKE string [ ESCAPE string ]
+//	                      | IS [NOT] NULL ]
+func (p *parser) parsePredicate() (result node, err error) {
+	result, err = p.parseAdditive()
+	if err != nil {
+		return
+	}
+
+	// Comparisons:
+	t := p.peek()
+	if t.kind == tokenOperator && comparisons[t.text] {
+		p.next()
+		var right node
+		right, err = p.parseAdditive()
+		result = comparisonNode{operator: t.text, left: result, right: right}
+		return
+	}
+
+	// Null checks:
+	if p.accept("IS") {
+		negated := p.accept("NOT")
+		err = p.expect("NULL")
+		result = nullNode{operand: result, negated: negated}
+		return
+	}
+
+	// The rest of the predicates can be negated:
+	negated := false
+	if p.peek().kind == tokenKeyword && p.peek().text == "NOT" {
+		p.next()
+		negated = true
+	}
+	switch {
+	case p.accept("BETWEEN"):
+		var low, high node
+		low, err = p.parseAdditive()
+		if err == nil {
+			err = p.expect("AND")
+		}
+		if err == nil {
+			high, err = p.parseAdditive()
+		}
+		result = betweenNode{operand: result, low: low, high: high}
+	case p.accept("IN"):
+		var values []interface{}
+		values, err = p.parseList()
+		result = inNode{operand: result, values: values}
+	case p.accept("LIKE"):
+		result, err = p.parseLike(result)
+	default:
+		if negated {
+			err = fmt.Errorf("Expected 'BETWEEN', 'IN' or 'LIKE' at position %d, found %s",
+				p.peek().position, p.peek().describe())
+		}
+		return
+	}
+	if negated {
+		result = notNode{operand: result}
+	}
+	return
+}
+
+// parseList parses the list of literals of the IN predicate.
+func (p *parser) parseList() (values []interface{}, err error) {
+	err = p.expect("(")
+	for err == nil {
+		t := p.next()
+		switch t.kind {
+		case tokenString:
+			values = append(values, t.text)
+		case tokenNumber:
+			values = append(values, t.number)
+		default:
+			err = fmt.Errorf("Expected literal at position %d, found %s", t.position, t.describe())
+			return
+		}
+		if !p.accept(",") {
+			err = p.expect(")")
+			return
+		}
+	}
+	return
+}
+
+// parseLike parses the pattern and the optional escape character of the LIKE predicate.
+func (p *parser) parseLike(operand node) (result node, err error) {
+	t := p.next()
+	if t.kind != tokenString {
+		err = fmt.Errorf("Expected pattern at position %d, found %s", t.position, t.describe())
+		return
+	}
+	pattern := t.text
+	escape := ""
+	if p.accept("ESCAPE") {
+		t = p.next()
+		if t.kind != tokenString || len(t.text) != 1 {
+			err = fmt.Errorf("Expected escape character at position %d, found %s", t.position,
+				t.describe())
+			return
+		}
+		escape = t.text
+	}
+	result, err = newLikeNode(operand, pattern, escape)
+	return
+}
+
+// parseAdditive parses:
+//
+//	additive := multiplicative { ('+' | '-') multiplicative }
+func (p *parser) parseAdditive() (result node, err error) {
+	result, err = p.parseMultiplicative()
+	for err == nil {
+		t := p.peek()
+		if t.kind != tokenOperator || (t.text != "+" && t.text != "-") {
+			return
+		}
+		p.next()
+		var right node
+		right, err = p.parseMultiplicative()
+		result = arithmeticNode{operator: t.text, left: result, right: right}
+	}
+	return
+}
+
+// parseMultiplicative parses:
+//
+//	multiplicative := unary { ('*' | '/') unary }
+func (p *parser) parseMultiplicative() (result node, err error) {
+	result, err = p.parseUnary()
+	for err == nil {
+		t := p.peek()
+		if t.kind != tokenOperator || (t.text != "*" && t.text != "/") {
+			return
+		}
+		p.next()
+		var right node
+		right, err = p.parseUnary()
+		result = arithmeticNode{operator: t.text, left: result, right: right}
+	}
+	return
+}
+
+// parseUnary parses:
+//
+//	unary := ('+' | '-') unary | primary
+func (p *parser) parseUnary() (result node, err error) {
+	if p.accept("-") {
+		result, err = p.parseUnary()
+		result = arithmeticNode{operator: "-", left: literalNode{value: 0.0}, right: result}
+		return
+	}
+	if p.accept("+") {
+		return p.parseUnary()
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary parses:
+//
+//	primary := '(' or ')' | identifier | string | number | TRUE | FALSE
+func (p *parser) parsePrimary() (result node, err error) {
+	t := p.next()
+	switch {
+	case t.kind == tokenOperator && t.text == "(":
+		result, err = p.parseOr()
+		if err == nil {
+			err = p.expect(")")
+		}
+	case t.kind == tokenIdentifier:
+		result = identifierNode{name: t.text}
+	case t.kind == tokenString:
+		result = literalNode{value: t.text}
+	case t.kind == tokenNumber:
+		result = literalNode{value: t.number}
+	case t.kind == tokenKeyword && t.text == "TRUE":
+		result = literalNode{value: true}
+	case t.kind == tokenKeyword && t.text == "FALSE":
+		result = literalNode{value: false}
+	default:
+		err = fmt.Errorf("Unexpected %s at position %d", t.describe(), t.position)
+	}
+	return
+}
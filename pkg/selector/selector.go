@@ -0,0 +1,90 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package selector implements message selectors, expressions that decide which messages a
+// subscription receives, using a syntax based on the conditional expressions of SQL-92, like
+// the selectors of JMS.
+//
+// The identifiers of an expression are the names of the headers of the messages, or, for
+// messages that don't have the header, the names of the top level fields of their data.
+//
+// For example:
+//
+//	kind = 'Event' AND priority > 5
+//	region IN ('us-east', 'us-west') AND NOT (name LIKE 'test-%')
+//	retries BETWEEN 1 AND 3 OR owner IS NULL
+//
+// Comparisons with missing values are unknown, as in SQL, and messages match only when the
+// expression is true. Header values are strings, they are converted to numbers or booleans when
+// compared with them.
+package selector
+
+import (
+	"fmt"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// Selector is a parsed selector expression.
+type Selector struct {
+	expression string
+	root       node
+}
+
+// Parse parses a selector expression.
+func Parse(expression string) (selector *Selector, err error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		err = fmt.Errorf("Invalid selector '%s': %s", expression, err.Error())
+		return
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.peek().kind != tokenEOF {
+		err = fmt.Errorf("Unexpected %s at position %d", p.peek().describe(), p.peek().position)
+	}
+	if err != nil {
+		err = fmt.Errorf("Invalid selector '%s': %s", expression, err.Error())
+		return
+	}
+
+	selector = &Selector{
+		expression: expression,
+		root:       root,
+	}
+	return
+}
+
+// MustParse is like Parse, but it panics if the expression isn't valid. It is intended for
+// expressions that are constants of the program.
+func MustParse(expression string) *Selector {
+	selector, err := Parse(expression)
+	if err != nil {
+		panic(err)
+	}
+	return selector
+}
+
+// String returns the expression of the selector.
+func (s *Selector) String() string {
+	return s.expression
+}
+
+// Matches checks if a message is selected by the expression.
+func (s *Selector) Matches(m client.Message) bool {
+	return toBool(s.root.eval(m)) == true
+}
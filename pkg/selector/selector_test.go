@@ -0,0 +1,105 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package selector
+
+import (
+	"testing"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+func TestMatches(t *testing.T) {
+	m := client.Message{
+		Header: map[string]string{
+			"kind":     "Event",
+			"priority": "7",
+			"urgent":   "true",
+		},
+		Data: client.MessageData{
+			"region":  "us-east",
+			"name":    "test_1%",
+			"retries": 2.0,
+			"nested":  map[string]interface{}{"a": 1},
+		},
+	}
+
+	tests := []struct {
+		expression string
+		expected   bool
+	}{
+		{"kind = 'Event'", true},
+		{"kind <> 'Event'", false},
+		{"priority > 5", true},
+		{"priority + 1 = 8", true},
+		{"priority * 2 >= 15", false},
+		{"-priority < 0", true},
+		{"urgent", true},
+		{"urgent = TRUE AND NOT (kind = 'Command')", true},
+		{"region IN ('us-east', 'us-west')", true},
+		{"region NOT IN ('us-east', 'us-west')", false},
+		{"retries BETWEEN 1 AND 3", true},
+		{"retries NOT BETWEEN 1 AND 3", false},
+		{"name LIKE 'test%'", true},
+		{"name LIKE 'test__%'", true},
+		{"name LIKE 'test_1!%' ESCAPE '!'", true},
+		{"name LIKE 'prod%'", false},
+		{"name NOT LIKE 'prod%'", true},
+		{"owner IS NULL", true},
+		{"region IS NOT NULL", true},
+		{"nested IS NULL", true},
+
+		// Unknown values don't match, not even when negated:
+		{"owner = 'me'", false},
+		{"NOT (owner = 'me')", false},
+		{"owner = 'me' OR kind = 'Event'", true},
+		{"owner = 'me' AND kind = 'Event'", false},
+		{"region > 5", false},
+		{"kind = 'it''s'", false},
+	}
+	for _, test := range tests {
+		selector, err := Parse(test.expression)
+		if err != nil {
+			t.Errorf("Can't parse '%s': %s", test.expression, err.Error())
+			continue
+		}
+		if selector.Matches(m) != test.expected {
+			t.Errorf("Expected '%s' to be %v", test.expression, test.expected)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	expressions := []string{
+		"",
+		"kind =",
+		"kind = 'Event",
+		"(kind = 'Event'",
+		"kind = 'Event')",
+		"region IN ()",
+		"region IN (name)",
+		"name LIKE 5",
+		"retries BETWEEN 1",
+		"kind NOT = 'Event'",
+		"kind # 'Event'",
+	}
+	for _, expression := range expressions {
+		_, err := Parse(expression)
+		if err == nil {
+			t.Errorf("Expected an error parsing '%s'", expression)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+/*
+Copyright (c) 2018 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing contains middleware that propagates OpenTelemetry traces across the messages
+// sent and received by the messaging library, using the W3C trace context headers.
+//
+// For example:
+//
+//	tracer := tracing.NewTracer(tracing.TracerSpec{})
+//
+//	spec := &client.ConnectionSpec{
+//		BrokerHost: "localhost",
+//		BrokerPort: 61613,
+//	}
+//	tracer.Instrument(spec)
+//	c, err := stomp.NewConnection(spec)
+//
+//	// The trace of the context is propagated to the consumers of the message:
+//	err = c.Publish(client.Message{Context: ctx, Data: data}, "my-queue")
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/container-mgmt/messaging-library/pkg/client"
+)
+
+// InstrumentationName is the name of the OpenTelemetry tracer used to create the spans.
+const InstrumentationName = "github.com/container-mgmt/messaging-library/pkg/tracing"
+
+// TracerSpec is a helper struct for building tracers.
+type TracerSpec struct {
+	// TracerProvider creates the tracer used to start the spans. The default is the global
+	// tracer provider of OpenTelemetry.
+	TracerProvider trace.TracerProvider
+
+	// Propagator injects the trace context into the headers of the messages sent, and extracts
+	// it from the headers of the messages received. The default is the W3C trace context
+	// propagator, which uses the "traceparent" and "tracestate" headers.
+	Propagator propagation.TextMapPropagator
+
+	// System is the value of the "messaging.system" attribute of the spans. The default is
+	// "stomp".
+	System string
+}
+
+// Tracer starts a producer span for each message published, and a consumer span for each message
+// received. The trace context is propagated in the headers of the messages, so the spans of a
+// request sent by a requestor, the spans of the responder that handles it, and the spans of its
+// response, are part of the same trace.
+//
+// The context of the caller is taken from the Context field of the message published. The context
+// of the consumer span is stored in the Context field of the message received, so that handlers,
+// and the responses sent by responders, continue the trace.
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+	system     string
+}
+
+// NewTracer creates a new tracer.
+func NewTracer(spec TracerSpec) *Tracer {
+	// Init the values that weren't given:
+	provider := spec.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	propagator := spec.Propagator
+	if propagator == nil {
+		propagator = propagation.TraceContext{}
+	}
+	system := spec.System
+	if system == "" {
+		system = "stomp"
+	}
+
+	return &Tracer{
+		tracer:     provider.Tracer(InstrumentationName),
+		propagator: propagator,
+		system:     system,
+	}
+}
+
+// Instrument adds the middleware of the tracer to a connection specification, so that the
+// messages sent and received by the connection created with it, and by its requestors and
+// responders, are traced.
+func (t *Tracer) Instrument(spec *client.ConnectionSpec) {
+	spec.PublishMiddleware = append(
+		[]client.PublishMiddleware{t.PublishMiddleware},
+		spec.PublishMiddleware...,
+	)
+	spec.SubscriptionMiddleware = append(
+		[]client.SubscriptionMiddleware{t.SubscriptionMiddleware},
+		spec.SubscriptionMiddleware...,
+	)
+}
+
+// PublishMiddleware starts a producer span, child of the context of the message, and injects its
+// trace context into the headers of the message.
+func (t *Tracer) PublishMiddleware(next client.PublishHandler) client.PublishHandler {
+	return func(m client.Message, destination string) (err error) {
+		ctx := m.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		ctx, span := t.tracer.Start(
+			ctx,
+			"send "+destination,
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(t.attributes(m, destination, "send")...),
+		)
+		defer span.End()
+
+		// Copy the headers, so that we don't modify the message of the caller:
+		header := make(map[string]string, len(m.Header)+2)
+		for key, value := range m.Header {
+			header[key] = value
+		}
+		t.propagator.Inject(ctx, propagation.MapCarrier(header))
+		m.Header = header
+		m.Context = ctx
+
+		err = next(m, destination)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return
+	}
+}
+
+// SubscriptionMiddleware extracts the trace context from the headers of the message, and starts a
+// consumer span, child of that context, that lasts till the message is handled. The errors
+// reported by the broker aren't traced.
+func (t *Tracer) SubscriptionMiddleware(next client.SubscriptionCallback) client.SubscriptionCallback {
+	return func(m client.Message, destination string) (err error) {
+		if m.Err != nil {
+			return next(m, destination)
+		}
+
+		ctx := m.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		ctx = t.propagator.Extract(ctx, propagation.MapCarrier(m.Header))
+		ctx, span := t.tracer.Start(
+			ctx,
+			"process "+destination,
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(t.attributes(m, destination, "process")...),
+		)
+		defer span.End()
+		m.Context = ctx
+
+		err = next(m, destination)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return
+	}
+}
+
+// attributes returns the attributes of the span of a message.
+func (t *Tracer) attributes(m client.Message, destination string, operation string) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{
+		attribute.String("messaging.system", t.system),
+		attribute.String("messaging.destination.name", destination),
+		attribute.String("messaging.operation.type", operation),
+	}
+	if id, ok := m.Header[client.CorrelationIDHeader]; ok {
+		attributes = append(attributes, attribute.String("messaging.message.conversation_id", id))
+	}
+	return attributes
+}